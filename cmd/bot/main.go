@@ -1,9 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"syscall"
+	"time"
+	_ "time/tzdata" // часовые пояса для расписания рассылок, даже если в образе нет zoneinfo
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 
@@ -22,10 +32,20 @@ func main() {
 		os.Exit(1)
 	}
 
+	// SIGTERM/SIGINT останавливают приём апдейтов, после чего in-flight задачи дорабатываются
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// healthcheck и (в режиме вебхука) приём апдейтов на одном HTTP-сервере
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+	srv := &http.Server{Addr: ":8080", Handler: mux}
 	go func() {
-		_ = http.ListenAndServe(":8080", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			_, _ = w.Write([]byte("ok"))
-		}))
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("http server failed", "error", err)
+		}
 	}()
 
 	bot, err := tgbotapi.NewBotAPI(token)
@@ -48,26 +68,58 @@ func main() {
 		logger.Error("users sqlite init error", "error", err)
 		os.Exit(1)
 	}
-	dialog := usecase.NewDialog()
+	scenarioPath := os.Getenv("SCENARIO_PATH")
+	if scenarioPath == "" {
+		scenarioPath = "scenario.json"
+	}
+	scenario, err := usecase.LoadScenario(scenarioPath)
+	if err != nil {
+		logger.Error("scenario load error", "error", err)
+		os.Exit(1)
+	}
+	dialog := usecase.NewDialog(scenario)
+	sessionTTL := 72 * time.Hour
+	if raw := os.Getenv("SESSION_TTL"); raw != "" {
+		if d, err := time.ParseDuration(raw); err == nil {
+			sessionTTL = d
+		} else {
+			logger.Warn("invalid SESSION_TTL, using default", "value", raw, "error", err)
+		}
+	}
+	sessionStore, err := sqliteRepo.NewSessionStore(dsn, sessionTTL)
+	if err != nil {
+		logger.Error("sessions sqlite init error", "error", err)
+		os.Exit(1)
+	}
 	sender := telegramAdapter.NewSender(bot)
 	statRepo, err := sqliteRepo.NewBroadcastStatRepo(dsn)
 	if err != nil {
 		logger.Error("broadcast stat sqlite init error", "error", err)
 		os.Exit(1)
 	}
-	broadcastUC := usecase.NewBroadcastUsecase(userRepo, sender, statRepo)
-	funnelSQLRepo, err := sqliteRepo.NewFunnelRepo(dsn)
+	jobRepo, err := sqliteRepo.NewBroadcastJobRepo(dsn)
 	if err != nil {
-		logger.Error("funnel sqlite init error", "error", err)
+		logger.Error("broadcast jobs sqlite init error", "error", err)
 		os.Exit(1)
 	}
-	funnelUC := usecase.NewFunnelUsecase(funnelSQLRepo)
-	leadRepo, err := sqliteRepo.NewLeadRepo(dsn)
+	// общий лимит Telegram ~30 сообщений/с на бота; по умолчанию берём с запасом
+	broadcastRate := 25.0
+	if raw := os.Getenv("BROADCAST_RATE"); raw != "" {
+		if v, err := strconv.ParseFloat(raw, 64); err == nil && v > 0 {
+			broadcastRate = v
+		} else {
+			logger.Warn("invalid BROADCAST_RATE, using default", "value", raw)
+		}
+	}
+	limiter := usecase.NewRateLimiter(broadcastRate, int(broadcastRate))
+	broadcastUC := usecase.NewBroadcastUsecase(userRepo, sender, statRepo, jobRepo, sender, limiter)
+	broadcastUC.Logger = logger
+	funnelSQLRepo, err := sqliteRepo.NewFunnelRepo(dsn)
 	if err != nil {
-		logger.Error("leads sqlite init error", "error", err)
+		logger.Error("funnel sqlite init error", "error", err)
 		os.Exit(1)
 	}
-
+	funnelUC := usecase.NewFunnelUsecase(funnelSQLRepo)
 	// MacroCRM client
 	macroDomain := os.Getenv("MACROCRM_DOMAIN")
 	macroSecret := os.Getenv("MACROCRM_APP_SECRET")
@@ -78,17 +130,243 @@ func main() {
 		if macroBase != "" {
 			opts = append(opts, macrocrm.WithBaseURL(macroBase))
 		}
+		// обновление отправленной заявки; без него повтор уходит новой заявкой с пометкой «Повторная»
+		if action := os.Getenv("MACROCRM_UPDATE_ACTION"); action != "" {
+			opts = append(opts, macrocrm.WithUpdateAction(action))
+		}
 		macroClient = macrocrm.NewClient(macroDomain, macroSecret, opts...)
 	} else {
 		logger.Warn("macrocrm is not configured: set MACROCRM_DOMAIN and MACROCRM_APP_SECRET to enable CRM sending")
 	}
 
+	// лиды пишутся в outbox в одной транзакции с сохранением, если есть куда их доставлять
+	leadOpts := []func(*sqliteRepo.LeadRepo){}
+	if macroClient != nil {
+		leadOpts = append(leadOpts, sqliteRepo.WithOutbox())
+	}
+	// повторные заявки в пределах окна объединяются с предыдущей; 0 отключает объединение
+	dedupWindow := 24 * time.Hour
+	if raw := os.Getenv("LEAD_DEDUP_WINDOW"); raw != "" {
+		if d, err := time.ParseDuration(raw); err == nil && d >= 0 {
+			dedupWindow = d
+		} else {
+			logger.Warn("invalid LEAD_DEDUP_WINDOW, using default", "value", raw, "error", err)
+		}
+	}
+	leadOpts = append(leadOpts, sqliteRepo.WithDedupWindow(dedupWindow))
+	// пока клиент отвечает на вопросы после номера, отправка в CRM придерживается
+	var followUpTimeout time.Duration
+	if scenario.FollowUp != nil {
+		followUpTimeout = 10 * time.Minute
+		if raw := os.Getenv("LEAD_FOLLOWUP_TIMEOUT"); raw != "" {
+			if d, err := time.ParseDuration(raw); err == nil && d > 0 {
+				followUpTimeout = d
+			} else {
+				logger.Warn("invalid LEAD_FOLLOWUP_TIMEOUT, using default", "value", raw, "error", err)
+			}
+		}
+		leadOpts = append(leadOpts, sqliteRepo.WithDeliveryHold(followUpTimeout))
+	}
+	leadRepo, err := sqliteRepo.NewLeadRepo(dsn, leadOpts...)
+	if err != nil {
+		logger.Error("leads sqlite init error", "error", err)
+		os.Exit(1)
+	}
+	// сегменты, динамика и выгрузка лидов читают users, funnel_hits и leads — создаём после их миграций
+	segmentRepo, err := sqliteRepo.NewSegmentRepo(dsn)
+	if err != nil {
+		logger.Error("segments sqlite init error", "error", err)
+		os.Exit(1)
+	}
+	broadcastUC.Segments = segmentRepo
+	activityRepo, err := sqliteRepo.NewActivityRepo(dsn, sqliteRepo.WithQuizStart(scenario.FirstQuestion()))
+	if err != nil {
+		logger.Error("activity sqlite init error", "error", err)
+		os.Exit(1)
+	}
+	funnelUC.Daily = activityRepo
+	leadExportRepo, err := sqliteRepo.NewLeadExportRepo(dsn)
+	if err != nil {
+		logger.Error("lead export sqlite init error", "error", err)
+		os.Exit(1)
+	}
+	broadcastUC.AnswerOptions = scenario.FieldOptions()
+	scheduleRepo, err := sqliteRepo.NewBroadcastScheduleRepo(dsn)
+	if err != nil {
+		logger.Error("broadcast schedules sqlite init error", "error", err)
+		os.Exit(1)
+	}
+	broadcastUC.Schedules = scheduleRepo
+	broadcastUC.Ops = jobRepo
+	broadcastUC.Editor = sender
+	broadcastUC.Tracker = jobRepo
+	broadcastUC.ABTests = jobRepo
+	if raw := os.Getenv("BROADCAST_ATTRIBUTION_WINDOW"); raw != "" {
+		if d, err := time.ParseDuration(raw); err == nil && d > 0 {
+			broadcastUC.AttributionWindow = d
+		} else {
+			logger.Warn("invalid BROADCAST_ATTRIBUTION_WINDOW, using default", "value", raw, "error", err)
+		}
+	}
+	tzName := os.Getenv("BROADCAST_TZ")
+	if tzName == "" {
+		tzName = "Europe/Samara"
+	}
+	if loc, err := time.LoadLocation(tzName); err == nil {
+		broadcastUC.Location = loc
+	} else {
+		logger.Warn("invalid BROADCAST_TZ, using Europe/Samara", "value", tzName)
+		broadcastUC.Location, _ = time.LoadLocation("Europe/Samara")
+	}
+	// дни и недели в отчётах воронки считаем в том же часовом поясе
+	funnelUC.Location = broadcastUC.Location
+	if raw := os.Getenv("FUNNEL_STUCK_AFTER"); raw != "" {
+		if d, err := time.ParseDuration(raw); err == nil && d > 0 {
+			funnelUC.StuckAfter = d
+		} else {
+			logger.Warn("invalid FUNNEL_STUCK_AFTER, using default", "value", raw, "error", err)
+		}
+	}
+
 	adminIDs := telegramAdapter.ParseAdminIDsFromEnv()
-	handler := telegramAdapter.NewHandler(bot, dialog, userRepo, broadcastUC, adminIDs, funnelUC, logger)
+	admins := make([]int64, 0, len(adminIDs))
+	for id := range adminIDs {
+		admins = append(admins, id)
+	}
+	sort.Slice(admins, func(i, j int) bool { return admins[i] < admins[j] })
+	// тестовая рассылка уходит в отдельную группу, если она задана, иначе всем админам
+	broadcastUC.TestChatIDs = admins
+	if testChats := telegramAdapter.ParseChatIDs(os.Getenv("BROADCAST_TEST_CHAT_IDS")); len(testChats) > 0 {
+		broadcastUC.TestChatIDs = testChats
+	}
+	var approvalRepo *sqliteRepo.BroadcastApprovalRepo
+	if raw := os.Getenv("BROADCAST_APPROVAL_THRESHOLD"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		switch {
+		case err != nil || n <= 0:
+			logger.Warn("invalid BROADCAST_APPROVAL_THRESHOLD, approval disabled", "value", raw)
+		case len(admins) < 2:
+			logger.Warn("BROADCAST_APPROVAL_THRESHOLD needs at least two ADMIN_CHAT_IDS, approval disabled")
+		default:
+			approvalRepo, err = sqliteRepo.NewBroadcastApprovalRepo(dsn)
+			if err != nil {
+				logger.Error("broadcast approvals sqlite init error", "error", err)
+				os.Exit(1)
+			}
+			broadcastUC.Approvals = approvalRepo
+			broadcastUC.ApprovalAsker = sender
+			broadcastUC.ApprovalThreshold = n
+			broadcastUC.Approvers = admins
+		}
+	}
+	handler := telegramAdapter.NewHandler(bot, dialog, sessionStore, userRepo, broadcastUC, adminIDs, funnelUC, logger)
+	if raw := os.Getenv("UPDATE_WORKERS"); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+			handler.SetWorkers(n)
+		} else {
+			logger.Warn("invalid UPDATE_WORKERS, using default", "value", raw)
+		}
+	}
+	if raw := os.Getenv("BACKGROUND_JOBS"); raw != "" {
+		if on, err := strconv.ParseBool(raw); err == nil {
+			handler.SetBackgroundJobs(on)
+		} else {
+			logger.Warn("invalid BACKGROUND_JOBS, using default", "value", raw)
+		}
+	}
 	handler.SetLeadRepository(leadRepo)
+	if followUpTimeout > 0 {
+		handler.SetFollowUpTimeout(followUpTimeout)
+	}
+	leadExport := usecase.NewLeadExport(leadExportRepo)
+	leadExport.Location = broadcastUC.Location
+	handler.SetLeadExport(leadExport)
+	if raw := os.Getenv("LEADS_CHAT_ID"); raw != "" {
+		if id, err := strconv.ParseInt(raw, 10, 64); err == nil && id != 0 {
+			leadDesk := usecase.NewLeadDesk(leadRepo, sender, id)
+			leadDesk.Location = broadcastUC.Location
+			handler.SetLeadDesk(leadDesk)
+		} else {
+			logger.Warn("invalid LEADS_CHAT_ID, lead notifications disabled", "value", raw)
+		}
+	}
 	if macroClient != nil {
-		// внедряем как абстракцию доставки лида
-		handler.SetLeadDelivery(macroClient)
+		// внедряем как абстракцию доставки лида через durable-очередь
+		leadDispatcher := usecase.NewLeadDispatcher(leadRepo, macroClient, logger)
+		if raw := os.Getenv("CRM_MAX_ATTEMPTS"); raw != "" {
+			if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+				leadDispatcher.MaxAttempts = n
+			} else {
+				logger.Warn("invalid CRM_MAX_ATTEMPTS, using default", "value", raw)
+			}
+		}
+		handler.SetLeadDispatcher(leadDispatcher)
+	}
+
+	var webhook *telegramAdapter.Webhook
+	if webhookURL := os.Getenv("TELEGRAM_WEBHOOK_URL"); webhookURL != "" {
+		webhook = setupWebhook(logger, bot, mux, webhookURL)
+		handler.Serve(ctx, webhook.Updates())
+	} else {
+		handler.Run(ctx)
+	}
+
+	shutdownTimeout := 30 * time.Second
+	if raw := os.Getenv("SHUTDOWN_TIMEOUT"); raw != "" {
+		if d, err := time.ParseDuration(raw); err == nil {
+			shutdownTimeout = d
+		} else {
+			logger.Warn("invalid SHUTDOWN_TIMEOUT, using default", "value", raw, "error", err)
+		}
+	}
+	logger.Info("shutting down", "timeout", shutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if webhook != nil {
+		webhook.Close()
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("http server shutdown", "error", err)
+	}
+	if err := handler.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("background work interrupted by shutdown deadline", "error", err)
+	}
+	closers := []io.Closer{userRepo, statRepo, jobRepo, funnelSQLRepo, leadRepo, segmentRepo, activityRepo, leadExportRepo, scheduleRepo, sessionStore}
+	if approvalRepo != nil {
+		closers = append(closers, approvalRepo)
+	}
+	for _, c := range closers {
+		if err := c.Close(); err != nil {
+			logger.Warn("sqlite close failed", "error", err)
+		}
+	}
+	logger.Info("bot stopped")
+}
+
+// setupWebhook регистрирует вебхук в Telegram и вешает его обработчик на общий HTTP-сервер
+func setupWebhook(logger *slog.Logger, bot *tgbotapi.BotAPI, mux *http.ServeMux, webhookURL string) *telegramAdapter.Webhook {
+	webhookSecret := os.Getenv("TELEGRAM_WEBHOOK_SECRET")
+	if webhookSecret == "" {
+		// без секрета любой, кто знает URL, может слать боту поддельные апдейты
+		logger.Error("TELEGRAM_WEBHOOK_SECRET is required in webhook mode")
+		os.Exit(1)
+	}
+	parsed, err := url.Parse(webhookURL)
+	if err != nil {
+		logger.Error("invalid TELEGRAM_WEBHOOK_URL", "error", err)
+		os.Exit(1)
+	}
+	if parsed.Path == "" || parsed.Path == "/" {
+		parsed.Path = "/telegram/webhook"
+		webhookURL = parsed.String()
+	}
+	webhookPath := parsed.Path
+	webhook := telegramAdapter.NewWebhook(bot, webhookSecret, logger)
+	mux.Handle(webhookPath, webhook)
+	if err := webhook.Register(webhookURL); err != nil {
+		logger.Error("webhook register failed", "error", err)
+		os.Exit(1)
 	}
-	handler.Run()
+	logger.Info("webhook mode", "url", webhookURL, "path", webhookPath)
+	return webhook
 }
@@ -0,0 +1,219 @@
+package telegram
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"math"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	chart "github.com/wcharczuk/go-chart/v2"
+	"github.com/wcharczuk/go-chart/v2/drawing"
+
+	"alliance-management-telegram-bot/internal/usecase"
+)
+
+func activityKeyboard() tgbotapi.InlineKeyboardMarkup {
+	row := make([]tgbotapi.InlineKeyboardButton, 0, len(usecase.ActivityDays))
+	for _, d := range usecase.ActivityDays {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d дней", d), activityPrefix+strconv.Itoa(d)))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(row, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("Недельный дайджест", activityPrefix+usecase.ActivityDigest),
+	))
+}
+
+// activityMetric — линия графика динамики: подпись, цвет и значение за день
+type activityMetric struct {
+	name  string
+	color drawing.Color
+	value func(usecase.DailyActivity) int
+}
+
+var activityMetrics = []activityMetric{
+	{"Новые пользователи", chart.ColorBlue, func(d usecase.DailyActivity) int { return d.NewUsers }},
+	{"Начали квиз", chart.ColorOrange, func(d usecase.DailyActivity) int { return d.QuizStarts }},
+	{"Лиды", chart.ColorGreen, func(d usecase.DailyActivity) int { return d.Leads }},
+}
+
+// sendActivity отправляет график динамики за key дней или недельный дайджест
+func (h *Handler) sendActivity(chatID int64, key string) {
+	days := 14
+	if key != usecase.ActivityDigest {
+		n, err := strconv.Atoi(key)
+		if err != nil {
+			return
+		}
+		days = n
+	}
+	series, err := h.funnel.DailySeries(days, time.Now())
+	if err != nil {
+		if h.logger != nil {
+			h.logger.Error("activity load failed", "period", key, "error", err)
+		}
+		h.sendText(chatID, "Не удалось получить динамику")
+		return
+	}
+	var img []byte
+	caption := usecase.ActivitySummary(series)
+	if key == usecase.ActivityDigest {
+		var prev, cur []usecase.DailyActivity
+		prev, cur, caption = usecase.WeeklyDigest(series)
+		img, err = renderDigest(prev, cur)
+	} else {
+		img, err = renderActivity(series)
+	}
+	if err == nil {
+		err = h.sendPNG(chatID, img, caption, tgbotapi.InlineKeyboardMarkup{})
+	}
+	if err != nil {
+		if h.logger != nil {
+			h.logger.Error("activity chart failed", "period", key, "error", err)
+		}
+		h.sendText(chatID, usecase.ActivityTable(series))
+	}
+}
+
+// renderActivity рисует все метрики линиями на одном графике с легендой
+func renderActivity(series []usecase.DailyActivity) ([]byte, error) {
+	xs := make([]time.Time, len(series))
+	for i, d := range series {
+		xs[i] = d.Day
+	}
+	graph := chart.Chart{
+		Title:  "Динамика по дням",
+		Width:  1100,
+		Height: 600,
+		Background: chart.Style{Padding: chart.Box{
+			Top:    50,
+			Left:   16,
+			Right:  16,
+			Bottom: 40,
+		}},
+		XAxis: chart.XAxis{Ticks: dayTicks(xs)},
+	}
+	top := 0
+	for _, m := range activityMetrics {
+		ys := make([]float64, len(series))
+		for i, d := range series {
+			v := m.value(d)
+			ys[i] = float64(v)
+			top = max(top, v)
+		}
+		graph.Series = append(graph.Series, chart.TimeSeries{
+			Name:    m.name,
+			Style:   chart.Style{StrokeColor: m.color, StrokeWidth: 3, DotColor: m.color, DotWidth: 3},
+			XValues: xs,
+			YValues: ys,
+		})
+	}
+	graph.YAxis = countAxis(top)
+	graph.Elements = []chart.Renderable{chart.Legend(&graph)}
+	buf := bytes.NewBuffer(nil)
+	if err := graph.Render(chart.PNG, buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderDigest склеивает по панели на метрику: текущая неделя цветной линией, прошлая — серой пунктирной
+func renderDigest(prev, cur []usecase.DailyActivity) ([]byte, error) {
+	const width, height = 1000, 320
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height*len(activityMetrics)))
+	xs := make([]float64, len(cur))
+	ticks := make([]chart.Tick, len(cur))
+	for i, d := range cur {
+		xs[i] = float64(i)
+		ticks[i] = chart.Tick{Value: float64(i), Label: weekdayShort(d.Day) + " " + d.Day.Format("02.01")}
+	}
+	for n, m := range activityMetrics {
+		curY, curSum, top := metricValues(m, cur)
+		panel := chart.Chart{
+			Title:  fmt.Sprintf("%s: %d", m.name, curSum),
+			Width:  width,
+			Height: height,
+			Background: chart.Style{Padding: chart.Box{
+				Top:    45,
+				Left:   16,
+				Right:  16,
+				Bottom: 10,
+			}},
+			XAxis: chart.XAxis{Ticks: ticks},
+		}
+		if len(prev) == len(cur) {
+			prevY, prevSum, prevTop := metricValues(m, prev)
+			top = max(top, prevTop)
+			panel.Title += fmt.Sprintf(" (неделей ранее: %d)", prevSum)
+			panel.Series = append(panel.Series, chart.ContinuousSeries{
+				Style:   chart.Style{StrokeColor: chart.ColorAlternateGray, StrokeWidth: 2, StrokeDashArray: []float64{6, 4}},
+				XValues: xs,
+				YValues: prevY,
+			})
+		}
+		panel.Series = append(panel.Series, chart.ContinuousSeries{
+			Style:   chart.Style{StrokeColor: m.color, StrokeWidth: 3, DotColor: m.color, DotWidth: 4},
+			XValues: xs,
+			YValues: curY,
+		})
+		panel.YAxis = countAxis(top)
+		buf := bytes.NewBuffer(nil)
+		if err := panel.Render(chart.PNG, buf); err != nil {
+			return nil, err
+		}
+		img, err := png.Decode(buf)
+		if err != nil {
+			return nil, err
+		}
+		draw.Draw(canvas, img.Bounds().Add(image.Pt(0, n*height)), img, img.Bounds().Min, draw.Src)
+	}
+	out := bytes.NewBuffer(nil)
+	if err := png.Encode(out, canvas); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func metricValues(m activityMetric, days []usecase.DailyActivity) (ys []float64, sum, top int) {
+	ys = make([]float64, len(days))
+	for i, d := range days {
+		v := m.value(d)
+		ys[i] = float64(v)
+		sum += v
+		top = max(top, v)
+	}
+	return ys, sum, top
+}
+
+// dayTicks подписывает дни по оси X; на длинных периодах — не чаще 15 подписей.
+// go-chart обрезает ось по крайним делениям, поэтому отсчёт идёт от последнего дня.
+func dayTicks(days []time.Time) []chart.Tick {
+	step := (len(days) + 14) / 15
+	ticks := make([]chart.Tick, 0, 16)
+	for i := len(days) - 1; i >= 0; i -= step {
+		ticks = append([]chart.Tick{{Value: float64(days[i].UnixNano()), Label: days[i].Format("02.01")}}, ticks...)
+	}
+	if ticks[0].Value != float64(days[0].UnixNano()) {
+		ticks = append([]chart.Tick{{Value: float64(days[0].UnixNano())}}, ticks...)
+	}
+	return ticks
+}
+
+// countAxis — ось Y с целыми делениями от нуля; нулевой диапазон go-chart не рисует
+func countAxis(top int) chart.YAxis {
+	top = max(top, 1)
+	step := int(math.Ceil(float64(top) / 5))
+	top = (top + step - 1) / step * step
+	ticks := make([]chart.Tick, 0, 6)
+	for v := 0; v <= top; v += step {
+		ticks = append(ticks, chart.Tick{Value: float64(v), Label: strconv.Itoa(v)})
+	}
+	return chart.YAxis{Range: &chart.ContinuousRange{Min: 0, Max: float64(top)}, Ticks: ticks}
+}
+
+func weekdayShort(t time.Time) string {
+	return [...]string{"вс", "пн", "вт", "ср", "чт", "пт", "сб"}[t.Weekday()]
+}
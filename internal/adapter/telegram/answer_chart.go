@@ -0,0 +1,142 @@
+package telegram
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	chart "github.com/wcharczuk/go-chart/v2"
+	"github.com/wcharczuk/go-chart/v2/drawing"
+
+	"alliance-management-telegram-bot/internal/usecase"
+)
+
+// sendAnswerChart рисует по панели на вопрос квиза: у каждого ответа два столбца —
+// сколько пользователей выбрали ответ и сколько из них оставили заявку
+func (h *Handler) sendAnswerChart(chatID int64, p usecase.FunnelPeriod, list []usecase.AnswerConversion) error {
+	img, err := renderAnswers(list)
+	if err != nil {
+		return err
+	}
+	caption := "Конверсия в лид по ответам, " + strings.ToLower(p.Label) +
+		"\nСиние столбцы — выбрали ответ, зелёные — оставили заявку из них"
+	return h.sendPNG(chatID, img, caption, tgbotapi.InlineKeyboardMarkup{})
+}
+
+func renderAnswers(list []usecase.AnswerConversion) ([]byte, error) {
+	// ответы одного вопроса идут подряд
+	var groups [][]usecase.AnswerConversion
+	for i, c := range list {
+		if i == 0 || c.Field != list[i-1].Field {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], c)
+	}
+	const height = 380
+	width := 1000
+	for _, g := range groups {
+		width = max(width, 120+len(g)*180)
+	}
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height*len(groups)))
+	for n, g := range groups {
+		users := make([]int, len(g))
+		leads := make([]int, len(g))
+		// крайние деления без подписи оставляют место под половины крайних групп
+		ticks := []chart.Tick{{Value: -0.5}}
+		top, sumUsers, sumLeads := 0, 0, 0
+		for i, c := range g {
+			users[i], leads[i] = c.Users, c.Leads
+			ticks = append(ticks, chart.Tick{Value: float64(i), Label: c.Answer})
+			top = max(top, c.Users, c.Leads)
+			sumUsers += c.Users
+			sumLeads += c.Leads
+		}
+		ticks = append(ticks, chart.Tick{Value: float64(len(g)) - 0.5})
+		panel := chart.Chart{
+			Title:  fmt.Sprintf("%s: ответили %d, оставили заявку %d", usecase.FieldLabel(g[0].Field), sumUsers, sumLeads),
+			Width:  width,
+			Height: height,
+			Background: chart.Style{Padding: chart.Box{
+				Top:    45,
+				Left:   16,
+				Right:  16,
+				Bottom: 10,
+			}},
+			XAxis: chart.XAxis{Ticks: ticks},
+			// запас сверху — под подписи над столбцами; цвета серий объясняет подпись к картинке
+			YAxis: countAxis(top + top/6 + 1),
+			Series: []chart.Series{
+				answerBars{name: "Выбрали ответ", color: chart.ColorBlue, slot: 0, values: users},
+				answerBars{name: "Оставили заявку", color: chart.ColorGreen, slot: 1, values: leads, of: users},
+			},
+		}
+		buf := bytes.NewBuffer(nil)
+		if err := panel.Render(chart.PNG, buf); err != nil {
+			return nil, err
+		}
+		img, err := png.Decode(buf)
+		if err != nil {
+			return nil, err
+		}
+		draw.Draw(canvas, img.Bounds().Add(image.Pt(0, n*height)), img, img.Bounds().Min, draw.Src)
+	}
+	out := bytes.NewBuffer(nil)
+	if err := png.Encode(out, canvas); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// answerBarSlots — столбцов в группе одного ответа; группа занимает answerBarGroup деления оси X,
+// но столбец не шире answerBarMaxWidth точек
+const (
+	answerBarSlots    = 2
+	answerBarGroup    = 0.7
+	answerBarMaxWidth = 110
+)
+
+// answerBars — одна серия сгруппированных столбцов: значение i-го ответа рисуется в позиции slot
+// группы i. Если задано of, над столбцом кроме значения пишется его доля от of[i]
+type answerBars struct {
+	name   string
+	color  drawing.Color
+	slot   int
+	values []int
+	of     []int
+}
+
+func (b answerBars) GetName() string           { return b.name }
+func (b answerBars) GetYAxis() chart.YAxisType { return chart.YAxisPrimary }
+func (b answerBars) GetStyle() chart.Style {
+	return chart.Style{FillColor: b.color, StrokeColor: b.color}
+}
+func (b answerBars) Validate() error                { return nil }
+func (b answerBars) Len() int                       { return len(b.values) }
+func (b answerBars) GetValues(i int) (x, y float64) { return float64(i), float64(b.values[i]) }
+
+func (b answerBars) Render(r chart.Renderer, box chart.Box, xrange, yrange chart.Range, defaults chart.Style) {
+	bar := b.GetStyle()
+	bar.StrokeWidth = 1
+	text := chart.Style{FontColor: chart.DefaultTextColor, FontSize: 10}.InheritFrom(defaults)
+	w := min(xrange.Translate(answerBarGroup/answerBarSlots)-xrange.Translate(0), answerBarMaxWidth)
+	for i, v := range b.values {
+		center := box.Left + xrange.Translate(float64(i))
+		left := center + (b.slot-answerBarSlots/2)*w
+		right := left + w
+		top := box.Bottom - yrange.Translate(float64(v))
+		if v > 0 {
+			chart.Draw.Box(r, chart.Box{Top: top, Left: left, Right: right, Bottom: box.Bottom}, bar)
+		}
+		label := strconv.Itoa(v)
+		if b.of != nil {
+			label += fmt.Sprintf(" (%.0f%%)", float64(v)*100/float64(max(b.of[i], 1)))
+		}
+		tb := chart.Draw.MeasureText(r, label, text)
+		chart.Draw.Text(r, label, (left+right-tb.Width())/2, top-6, text)
+	}
+}
@@ -0,0 +1,123 @@
+package telegram
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"alliance-management-telegram-bot/internal/usecase"
+)
+
+// broadcastPost переводит сообщение админа в пост рассылки с сохранением форматирования
+func broadcastPost(m *tgbotapi.Message) usecase.BroadcastPost {
+	p := usecase.BroadcastPost{Text: m.Text, Entities: fromEntities(m.Entities), MediaGroupID: m.MediaGroupID}
+	switch {
+	case len(m.Photo) > 0:
+		p.Media = &usecase.BroadcastMedia{Kind: usecase.MediaPhoto, FileID: m.Photo[len(m.Photo)-1].FileID}
+	case m.Video != nil:
+		p.Media = &usecase.BroadcastMedia{Kind: usecase.MediaVideo, FileID: m.Video.FileID}
+	case m.Document != nil:
+		p.Media = &usecase.BroadcastMedia{Kind: usecase.MediaDocument, FileID: m.Document.FileID}
+	}
+	if p.Media != nil {
+		p.Text, p.Entities = m.Caption, fromEntities(m.CaptionEntities)
+	}
+	return p
+}
+
+func fromEntities(in []tgbotapi.MessageEntity) []usecase.TextEntity {
+	if len(in) == 0 {
+		return nil
+	}
+	out := make([]usecase.TextEntity, 0, len(in))
+	for _, e := range in {
+		out = append(out, usecase.TextEntity{Type: e.Type, Offset: e.Offset, Length: e.Length, URL: e.URL, Language: e.Language})
+	}
+	return out
+}
+
+// toEntities возвращает форматирование для отправки; при явной разметке Telegram разбирает текст сам
+func toEntities(c usecase.BroadcastContent) []tgbotapi.MessageEntity {
+	if c.ParseMode != "" || len(c.Entities) == 0 {
+		return nil
+	}
+	out := make([]tgbotapi.MessageEntity, 0, len(c.Entities))
+	for _, e := range c.Entities {
+		out = append(out, tgbotapi.MessageEntity{Type: e.Type, Offset: e.Offset, Length: e.Length, URL: e.URL, Language: e.Language})
+	}
+	return out
+}
+
+func buttonsMarkup(buttons []usecase.BroadcastButton) *tgbotapi.InlineKeyboardMarkup {
+	if len(buttons) == 0 {
+		return nil
+	}
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(buttons))
+	for _, b := range buttons {
+		btn := tgbotapi.NewInlineKeyboardButtonData(b.Text, b.Data)
+		if b.URL != "" {
+			btn = tgbotapi.NewInlineKeyboardButtonURL(b.Text, b.URL)
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(btn))
+	}
+	return &tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
+
+// singleMessage собирает пост без альбома: текст или одно вложение с подписью
+func singleMessage(chatID int64, c usecase.BroadcastContent) tgbotapi.Chattable {
+	entities := toEntities(c)
+	markup := buttonsMarkup(c.Buttons)
+	if len(c.Media) == 0 {
+		msg := tgbotapi.NewMessage(chatID, c.Text)
+		msg.Entities, msg.ParseMode, msg.ReplyMarkup = entities, c.ParseMode, markup
+		return msg
+	}
+	file := tgbotapi.FileID(c.Media[0].FileID)
+	switch c.Media[0].Kind {
+	case usecase.MediaVideo:
+		msg := tgbotapi.NewVideo(chatID, file)
+		msg.Caption, msg.CaptionEntities, msg.ParseMode, msg.ReplyMarkup = c.Text, entities, c.ParseMode, markup
+		return msg
+	case usecase.MediaDocument:
+		msg := tgbotapi.NewDocument(chatID, file)
+		msg.Caption, msg.CaptionEntities, msg.ParseMode, msg.ReplyMarkup = c.Text, entities, c.ParseMode, markup
+		return msg
+	}
+	msg := tgbotapi.NewPhoto(chatID, file)
+	msg.Caption, msg.CaptionEntities, msg.ParseMode, msg.ReplyMarkup = c.Text, entities, c.ParseMode, markup
+	return msg
+}
+
+// mediaGroup собирает альбом; подпись с форматированием ставится на первый файл
+func mediaGroup(chatID int64, c usecase.BroadcastContent) tgbotapi.MediaGroupConfig {
+	files := make([]interface{}, 0, len(c.Media))
+	for i, m := range c.Media {
+		base := tgbotapi.BaseInputMedia{Type: string(m.Kind), Media: tgbotapi.FileID(m.FileID), CaptionEntities: []tgbotapi.MessageEntity{}}
+		if i == 0 {
+			base.Caption, base.ParseMode = c.Text, c.ParseMode
+			if e := toEntities(c); e != nil {
+				base.CaptionEntities = e
+			}
+		}
+		switch m.Kind {
+		case usecase.MediaVideo:
+			files = append(files, tgbotapi.InputMediaVideo{BaseInputMedia: base})
+		case usecase.MediaDocument:
+			files = append(files, tgbotapi.InputMediaDocument{BaseInputMedia: base})
+		default:
+			files = append(files, tgbotapi.InputMediaPhoto{BaseInputMedia: base})
+		}
+	}
+	return tgbotapi.NewMediaGroup(chatID, files)
+}
+
+// editMessage меняет текст поста или подпись к медиа; кнопки передаются заново, иначе Telegram их уберёт
+func editMessage(chatID int64, messageID int, c usecase.BroadcastContent) tgbotapi.Chattable {
+	markup := buttonsMarkup(c.Buttons)
+	if len(c.Media) == 0 {
+		msg := tgbotapi.NewEditMessageText(chatID, messageID, c.Text)
+		msg.Entities, msg.ParseMode, msg.ReplyMarkup = toEntities(c), c.ParseMode, markup
+		return msg
+	}
+	msg := tgbotapi.NewEditMessageCaption(chatID, messageID, c.Text)
+	msg.CaptionEntities, msg.ParseMode, msg.ReplyMarkup = toEntities(c), c.ParseMode, markup
+	return msg
+}
@@ -0,0 +1,133 @@
+package telegram
+
+import (
+	"sync"
+	"time"
+
+	"alliance-management-telegram-bot/internal/usecase"
+)
+
+const (
+	defaultWorkers = 8
+	shardQueueSize = 64
+
+	// через сколько после сохранения лида сессия сбрасывается в начало квиза
+	sessionResetDelay = 2 * time.Minute
+
+	// сколько ждать отменённые фоновые задачи после истечения дедлайна остановки
+	shutdownGrace = 5 * time.Second
+)
+
+// dispatcher распределяет задачи по шардам по chat_id: задачи одного чата
+// выполняются строго последовательно, задачи разных чатов — параллельно.
+type dispatcher struct {
+	mu     sync.RWMutex
+	closed bool
+	shards []chan func()
+	wg     sync.WaitGroup
+}
+
+func newDispatcher(workers int) *dispatcher {
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	d := &dispatcher{shards: make([]chan func(), workers)}
+	for i := range d.shards {
+		d.shards[i] = make(chan func(), shardQueueSize)
+	}
+	return d
+}
+
+func (d *dispatcher) start() {
+	for _, ch := range d.shards {
+		d.wg.Add(1)
+		go func(ch chan func()) {
+			defer d.wg.Done()
+			for job := range ch {
+				job()
+			}
+		}(ch)
+	}
+}
+
+// stop закрывает очереди и ждёт выполнения уже поставленных задач
+func (d *dispatcher) stop() {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		for _, ch := range d.shards {
+			close(ch)
+		}
+	}
+	d.mu.Unlock()
+	d.wg.Wait()
+}
+
+// dispatch ставит задачу в очередь шарда чата; после stop задачи отбрасываются
+func (d *dispatcher) dispatch(chatID int64, job func()) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return false
+	}
+	d.shards[uint64(chatID)%uint64(len(d.shards))] <- job
+	return true
+}
+
+type scheduledReset struct {
+	id    uint64
+	timer *time.Timer
+}
+
+// scheduleSessionReset откладывает сброс сессии чата; повторный вызов переносит сброс.
+// Сам сброс выполняется в шарде чата, поэтому не пересекается с обработкой апдейтов.
+// Вызывается из шарда чата: срок сброса сохраняется в сессии, и если таймер пропадёт
+// вместе с остановкой бота, getSession сбросит сессию при следующем обращении.
+func (h *Handler) scheduleSessionReset(chatID int64, after time.Duration) {
+	s := h.getSession(chatID)
+	s.ResetAt = time.Now().Add(after)
+	h.saveSession(chatID, s)
+
+	h.resetMu.Lock()
+	defer h.resetMu.Unlock()
+	if prev, ok := h.resets[chatID]; ok {
+		prev.timer.Stop()
+	}
+	h.resetSeq++
+	id := h.resetSeq
+	h.resets[chatID] = &scheduledReset{id: id, timer: time.AfterFunc(after, func() {
+		h.jobs.dispatch(chatID, func() { h.runSessionReset(chatID, id) })
+	})}
+}
+
+// cancelSessionReset отменяет запланированный сброс, если он ещё не выполнился
+func (h *Handler) cancelSessionReset(chatID int64) {
+	h.resetMu.Lock()
+	defer h.resetMu.Unlock()
+	if r, ok := h.resets[chatID]; ok {
+		r.timer.Stop()
+		delete(h.resets, chatID)
+	}
+}
+
+func (h *Handler) cancelAllSessionResets() {
+	h.resetMu.Lock()
+	defer h.resetMu.Unlock()
+	for chatID, r := range h.resets {
+		r.timer.Stop()
+		delete(h.resets, chatID)
+	}
+}
+
+func (h *Handler) runSessionReset(chatID int64, id uint64) {
+	h.resetMu.Lock()
+	r, ok := h.resets[chatID]
+	if !ok || r.id != id {
+		// сброс отменён или перепланирован, пока задача стояла в очереди
+		h.resetMu.Unlock()
+		return
+	}
+	delete(h.resets, chatID)
+	h.resetMu.Unlock()
+	h.saveSession(chatID, &usecase.Session{State: usecase.StateStart})
+}
@@ -0,0 +1,154 @@
+package telegram
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"alliance-management-telegram-bot/internal/usecase"
+)
+
+func TestDispatcherKeepsChatOrder(t *testing.T) {
+	const chats, jobs = 16, 500
+	d := newDispatcher(4)
+	d.start()
+	// каждый срез пишет только шард своего чата
+	seen := make([][]int, chats)
+	for i := 0; i < jobs; i++ {
+		for c := 0; c < chats; c++ {
+			d.dispatch(int64(c), func() { seen[c] = append(seen[c], i) })
+		}
+	}
+	d.stop()
+
+	for c, got := range seen {
+		if len(got) != jobs {
+			t.Fatalf("chat %d: %d jobs done, want %d", c, len(got), jobs)
+		}
+		for i, v := range got {
+			if v != i {
+				t.Fatalf("chat %d: job %d ran at position %d", c, v, i)
+			}
+		}
+	}
+}
+
+func TestDispatcherRunsChatsInParallel(t *testing.T) {
+	d := newDispatcher(2)
+	d.start()
+	defer d.stop()
+	// чаты 0 и 1 попадают в разные шарды: первый ждёт второго и без параллельности зависнет
+	released := make(chan struct{})
+	done := make(chan bool, 1)
+	d.dispatch(0, func() {
+		select {
+		case <-released:
+			done <- true
+		case <-time.After(5 * time.Second):
+			done <- false
+		}
+	})
+	d.dispatch(1, func() { close(released) })
+	if !<-done {
+		t.Fatal("job of another chat did not run while the first one was blocked")
+	}
+}
+
+func TestDispatcherDropsJobsAfterStop(t *testing.T) {
+	d := newDispatcher(1)
+	d.start()
+	d.stop()
+	if d.dispatch(1, func() { t.Error("job ran after stop") }) {
+		t.Fatal("dispatch accepted a job after stop")
+	}
+}
+
+// Сброс сессии срабатывает в шарде чата, пока для того же чата обрабатываются апдейты:
+// -race проверяет, что таймер не трогает сессию в обход шарда
+func TestSessionResetRunsInChatShard(t *testing.T) {
+	h, sessions, _ := newTestHandler(t, 4)
+	h.jobs.start()
+	const chats, jobs = 8, 200
+
+	var wg sync.WaitGroup
+	for c := int64(1); c <= chats; c++ {
+		h.jobs.dispatch(c, func() {
+			h.saveSession(c, &usecase.Session{State: usecase.StatePayment, Purpose: "Для жизни"})
+			h.scheduleSessionReset(c, time.Millisecond)
+		})
+		for i := 0; i < jobs; i++ {
+			wg.Add(1)
+			h.jobs.dispatch(c, func() {
+				defer wg.Done()
+				s := h.getSession(c)
+				s.Bedrooms = strconv.Itoa(i)
+				h.saveSession(c, s)
+			})
+		}
+	}
+	wg.Wait()
+	waitResets(t, h)
+	h.jobs.stop()
+
+	for c := int64(1); c <= chats; c++ {
+		s, _ := sessions.GetSession(c)
+		if s == nil || s.State != usecase.StateStart || s.Purpose != "" || !s.ResetAt.IsZero() {
+			t.Errorf("chat %d: session was not reset: %+v", c, s)
+		}
+	}
+}
+
+func TestSessionResetRescheduleKeepsLatest(t *testing.T) {
+	h, sessions, _ := newTestHandler(t, 1)
+	h.jobs.start()
+	done := make(chan struct{})
+	h.jobs.dispatch(1, func() {
+		h.saveSession(1, &usecase.Session{State: usecase.StatePayment})
+		h.scheduleSessionReset(1, time.Millisecond)
+		// повторный вызов переносит сброс: первый таймер не должен сбросить сессию
+		h.scheduleSessionReset(1, time.Hour)
+		close(done)
+	})
+	<-done
+	time.Sleep(20 * time.Millisecond)
+	h.cancelAllSessionResets()
+	h.jobs.stop()
+
+	s, _ := sessions.GetSession(1)
+	if s == nil || s.State != usecase.StatePayment {
+		t.Fatalf("session reset by a rescheduled timer: %+v", s)
+	}
+}
+
+// Таймер сброса пропадает вместе с процессом; срок в сессии сбрасывает её при следующем чтении
+func TestSessionResetDeadlineSurvivesRestart(t *testing.T) {
+	h, sessions, _ := newTestHandler(t, 1)
+	_ = sessions.SaveSession(1, &usecase.Session{State: usecase.StateAskName, LeadID: 7, ResetAt: time.Now().Add(-time.Second)})
+	_ = sessions.SaveSession(2, &usecase.Session{State: usecase.StateAskName, LeadID: 8, ResetAt: time.Now().Add(time.Hour)})
+
+	if s := h.getSession(1); s.State != usecase.StateStart || s.LeadID != 0 {
+		t.Errorf("expired session was not reset: %+v", s)
+	}
+	if s := h.getSession(2); s.State != usecase.StateAskName || s.LeadID != 8 {
+		t.Errorf("pending session was reset early: %+v", s)
+	}
+}
+
+// waitResets ждёт, пока все запланированные сбросы выполнятся в своих шардах
+func waitResets(t *testing.T, h *Handler) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		h.resetMu.Lock()
+		n := len(h.resets)
+		h.resetMu.Unlock()
+		if n == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d session resets did not run", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,67 @@
+package telegram
+
+import (
+	"strings"
+	"time"
+
+	"alliance-management-telegram-bot/internal/domain"
+	"alliance-management-telegram-bot/internal/usecase"
+)
+
+// startFollowUp благодарит за номер и спрашивает, как обращаться, предлагая имя из Telegram
+func (h *Handler) startFollowUp(chatID int64, s *usecase.Session, leadID int64, p domain.Profile) {
+	suggested := p.ContactName
+	if suggested == "" {
+		suggested = strings.TrimSpace(p.FirstName + " " + p.LastName)
+	}
+	reply := h.dialog.StartFollowUp(s, leadID, suggested)
+	h.saveSession(chatID, s)
+	// убираем кнопку «Отправить номер» вместе с благодарностью
+	h.sendTextRemoveKeyboard(chatID, reply.Notice)
+	h.sendTextWithKeyboard(chatID, reply.Text, reply.Options)
+	h.scheduleSessionReset(chatID, h.followUpWait())
+}
+
+// followUpInput дописывает ответ в лид; после последнего вопроса лид сразу уходит в CRM
+func (h *Handler) followUpInput(chatID int64, s *usecase.Session, text string) {
+	reply, done := h.dialog.FollowUpInput(s, text)
+	h.saveSession(chatID, s)
+	if h.leadRepo != nil && s.LeadID != 0 {
+		if err := h.leadRepo.SaveLeadDetails(s.LeadID, s.ClientName, s.CallTime); err != nil {
+			if h.logger != nil {
+				h.logger.Error("lead details save failed", "chat_id", chatID, "lead_id", s.LeadID, "error", err)
+			}
+		} else if h.leadDesk != nil {
+			// карточка ушла менеджерам сразу после номера — дописываем в неё имя и время звонка
+			leadID := s.LeadID
+			h.goBackground(func() {
+				if err := h.leadDesk.Refresh(leadID); err != nil && h.logger != nil {
+					h.logger.Error("lead card refresh failed", "lead_id", leadID, "error", err)
+				}
+			})
+		}
+	}
+	if !done {
+		h.sendTextWithKeyboard(chatID, reply.Text, reply.Options)
+		h.scheduleSessionReset(chatID, h.followUpWait())
+		return
+	}
+	if h.leadDispatcher != nil && s.LeadID != 0 {
+		if err := h.leadDispatcher.Release(s.LeadID); err != nil && h.logger != nil {
+			h.logger.Error("lead release failed", "chat_id", chatID, "lead_id", s.LeadID, "error", err)
+		}
+	}
+	if h.logger != nil {
+		h.logger.Info("lead follow-up finished", "chat_id", chatID, "lead_id", s.LeadID,
+			"has_name", s.ClientName != "", "has_call_time", s.CallTime != "")
+	}
+	h.sendText(chatID, reply.Text)
+	h.scheduleSessionReset(chatID, sessionResetDelay)
+}
+
+func (h *Handler) followUpWait() time.Duration {
+	if h.followUpTimeout > 0 {
+		return h.followUpTimeout
+	}
+	return sessionResetDelay
+}
@@ -3,6 +3,7 @@ package telegram
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
@@ -25,12 +26,28 @@ type Handler struct {
 	broadcastUC *usecase.BroadcastUsecase
 	adminIDs    map[int64]struct{}
 
-	sessions      map[int64]*usecase.Session
-	bcastSessions map[int64]*usecase.BroadcastSession
-	funnel        *usecase.FunnelUsecase
-	leadRepo      domain.LeadRepository
-	leadDelivery  usecase.LeadDelivery
-	logger        *slog.Logger
+	sessions       usecase.SessionStore
+	funnel         *usecase.FunnelUsecase
+	leadRepo       domain.LeadRepository
+	leadDispatcher *usecase.LeadDispatcher
+	leadDesk       *usecase.LeadDesk
+	leadExport     *usecase.LeadExport
+	// followUpTimeout — сколько ждать ответов на необязательные вопросы после номера
+	followUpTimeout time.Duration
+	// noBackgroundJobs — реплика только обрабатывает апдейты, рассылки и доставку в CRM ведёт другая
+	noBackgroundJobs bool
+	logger           *slog.Logger
+
+	jobs     *dispatcher
+	resetMu  sync.Mutex
+	resets   map[int64]*scheduledReset
+	resetSeq uint64
+
+	// фоновые задачи (доставка в CRM, отправка каталогов, рассылки) живут в workCtx;
+	// Shutdown ждёт их завершения и отменяет контекст по истечении дедлайна
+	bg         sync.WaitGroup
+	workCtx    context.Context
+	workCancel context.CancelFunc
 
 	// cache for telegram file_ids to speed up repeated sends
 	catalogMu      sync.RWMutex
@@ -38,239 +55,746 @@ type Handler struct {
 	catalogPhotoID map[string]string
 }
 
-func NewHandler(bot *tgbotapi.BotAPI, dialog *usecase.Dialog, userRepo domain.UserRepository, broadcastUC *usecase.BroadcastUsecase, adminIDs map[int64]struct{}, funnel *usecase.FunnelUsecase, logger *slog.Logger) *Handler {
+func NewHandler(bot *tgbotapi.BotAPI, dialog *usecase.Dialog, sessions usecase.SessionStore, userRepo domain.UserRepository, broadcastUC *usecase.BroadcastUsecase, adminIDs map[int64]struct{}, funnel *usecase.FunnelUsecase, logger *slog.Logger) *Handler {
+	workCtx, workCancel := context.WithCancel(context.Background())
 	return &Handler{
 		bot:            bot,
 		dialog:         dialog,
+		sessions:       sessions,
 		userRepo:       userRepo,
 		broadcastUC:    broadcastUC,
 		adminIDs:       adminIDs,
-		sessions:       make(map[int64]*usecase.Session),
-		bcastSessions:  make(map[int64]*usecase.BroadcastSession),
 		funnel:         funnel,
 		logger:         logger,
 		catalogFileID:  make(map[string]string),
 		catalogPhotoID: make(map[string]string),
+		jobs:           newDispatcher(defaultWorkers),
+		resets:         make(map[int64]*scheduledReset),
+		workCtx:        workCtx,
+		workCancel:     workCancel,
 	}
 }
 
 func (h *Handler) SetLeadRepository(repo domain.LeadRepository) { h.leadRepo = repo }
 
-func (h *Handler) SetLeadDelivery(d usecase.LeadDelivery) { h.leadDelivery = d }
+func (h *Handler) SetLeadDispatcher(d *usecase.LeadDispatcher) { h.leadDispatcher = d }
+
+// SetLeadDesk включает работу менеджеров с лидами в их чате
+func (h *Handler) SetLeadDesk(d *usecase.LeadDesk) { h.leadDesk = d }
+
+// SetLeadExport включает выгрузку лидов в CSV и XLSX из админ-меню
+func (h *Handler) SetLeadExport(e *usecase.LeadExport) { h.leadExport = e }
+
+// SetFollowUpTimeout задаёт, сколько сессия ждёт ответов на вопросы после номера телефона
+func (h *Handler) SetFollowUpTimeout(d time.Duration) { h.followUpTimeout = d }
+
+// SetBackgroundJobs включает или выключает на этом экземпляре фоновые задачи: продолжение рассылок,
+// планировщик, A/B-тесты и доставку лидов в CRM. При нескольких репликах их запускает только одна
+func (h *Handler) SetBackgroundJobs(enabled bool) { h.noBackgroundJobs = !enabled }
+
+// SetWorkers задаёт число параллельных обработчиков апдейтов; вызывать до Run
+func (h *Handler) SetWorkers(n int) { h.jobs = newDispatcher(n) }
 
 // trackFunnel — небольшой хелпер, чтобы не дублировать проверку на nil
-func (h *Handler) trackFunnel(chatID int64, state usecase.State) {
+func (h *Handler) trackFunnel(chatID int64, state usecase.State, s *usecase.Session) {
 	if h.funnel != nil {
-		h.funnel.Reach(chatID, state)
+		h.funnel.Reach(chatID, state, s)
 	}
 }
 
 func ParseAdminIDsFromEnv() map[int64]struct{} {
 	ids := map[int64]struct{}{}
-	raw := strings.TrimSpace(os.Getenv("ADMIN_CHAT_IDS"))
-	if raw == "" {
-		return ids
+	for _, id := range ParseChatIDs(os.Getenv("ADMIN_CHAT_IDS")) {
+		ids[id] = struct{}{}
 	}
+	return ids
+}
+
+// ParseChatIDs разбирает список ID чатов через запятую; некорректные значения пропускаются
+func ParseChatIDs(raw string) []int64 {
+	var ids []int64
 	for _, part := range strings.Split(raw, ",") {
 		part = strings.TrimSpace(part)
 		if part == "" {
 			continue
 		}
 		if id, err := strconv.ParseInt(part, 10, 64); err == nil {
-			ids[id] = struct{}{}
+			ids = append(ids, id)
 		}
 	}
 	return ids
 }
 
-func (h *Handler) Run() {
+// Run получает апдейты через long polling до отмены ctx
+func (h *Handler) Run(ctx context.Context) {
+	// вебхук, оставшийся от запуска в режиме вебхука, блокирует getUpdates ошибкой 409;
+	// накопившиеся апдейты не сбрасываются и придут через long polling
+	if _, err := h.bot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil && h.logger != nil {
+		h.logger.Error("delete webhook failed", "error", err)
+	}
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 30
-	updates := h.bot.GetUpdatesChan(u)
-	for update := range updates {
-		if update.Message == nil && update.CallbackQuery == nil {
-			continue
+	h.Serve(ctx, h.bot.GetUpdatesChan(u))
+	h.bot.StopReceivingUpdates()
+}
+
+// Serve — общий конвейер обработки апдейтов для long polling и вебхука.
+// Возвращается при отмене ctx или закрытии канала; уже принятые апдейты дорабатывает Shutdown.
+func (h *Handler) Serve(ctx context.Context, updates <-chan tgbotapi.Update) {
+	if n, err := h.sessions.PurgeExpired(); err != nil {
+		if h.logger != nil {
+			h.logger.Error("sessions purge failed", "error", err)
 		}
-		var chatID int64
-		var text string
-		if update.Message != nil {
-			chatID = update.Message.Chat.ID
-			text = update.Message.Text
-		} else if update.CallbackQuery != nil {
-			chatID = update.CallbackQuery.Message.Chat.ID
-			text = update.CallbackQuery.Data
+	} else if n > 0 && h.logger != nil {
+		h.logger.Info("expired sessions purged", "count", n)
+	}
+	h.jobs.start()
+	if !h.noBackgroundJobs {
+		h.startBackgroundJobs(ctx)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case update, ok := <-updates:
+			if !ok {
+				return
+			}
+			chatID, ok := updateChatID(update)
+			if !ok {
+				continue
+			}
+			// апдейты одного чата обрабатываются строго по очереди, разных чатов — параллельно
+			h.jobs.dispatch(chatID, func() { h.handleUpdate(update) })
 		}
-		// сохраняем только не-админов
-		if !h.isAdmin(chatID) {
-			_ = h.userRepo.SaveUser(chatID)
+	}
+}
+
+// startBackgroundJobs запускает задачи, которые должны работать ровно на одном экземпляре бота
+func (h *Handler) startBackgroundJobs(ctx context.Context) {
+	// рассылки, прерванные прошлой остановкой, продолжаются с первого неотправленного получателя
+	if n, err := h.broadcastUC.Resume(h.workCtx); err != nil {
+		if h.logger != nil {
+			h.logger.Error("broadcast resume failed", "error", err)
+		}
+	} else if n > 0 && h.logger != nil {
+		h.logger.Info("broadcasts resumed", "count", n)
+	}
+	if h.broadcastUC.Schedules != nil {
+		// планировщик останавливается вместе с приёмом апдейтов; запущенные им рассылки живут в workCtx
+		h.goBackground(func() { h.broadcastUC.RunSchedules(ctx, h.workCtx) })
+	}
+	if h.broadcastUC.ABTests != nil {
+		h.goBackground(func() { h.broadcastUC.RunABTests(ctx, h.workCtx) })
+	}
+	if h.leadDispatcher != nil {
+		// доставка лидов останавливается вместе с приёмом апдейтов и продолжится после рестарта
+		h.goBackground(func() { h.leadDispatcher.Run(ctx) })
+	}
+}
+
+// Shutdown дожидается обработки принятых апдейтов и фоновых задач. Если ctx истекает раньше,
+// фоновые задачи отменяются (рассылка сохраняет частичную статистику) и возвращается ошибка ctx.
+func (h *Handler) Shutdown(ctx context.Context) error {
+	h.cancelAllSessionResets()
+	done := make(chan struct{})
+	go func() {
+		h.jobs.stop()
+		h.bg.Wait()
+		h.broadcastUC.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		h.workCancel()
+		return nil
+	case <-ctx.Done():
+	}
+	h.workCancel()
+	// короткая пауза, чтобы отменённые задачи успели записать результат
+	select {
+	case <-done:
+	case <-time.After(shutdownGrace):
+	}
+	return ctx.Err()
+}
+
+// goBackground запускает фоновую задачу, завершения которой дождётся Shutdown
+func (h *Handler) goBackground(fn func()) {
+	h.bg.Add(1)
+	go func() {
+		defer h.bg.Done()
+		fn()
+	}()
+}
+
+// updateChatID извлекает чат апдейта; апдейты без сообщения, колбэка и смены статуса бота пропускаются
+func updateChatID(update tgbotapi.Update) (int64, bool) {
+	if update.MyChatMember != nil {
+		return update.MyChatMember.Chat.ID, true
+	}
+	if update.Message != nil {
+		return update.Message.Chat.ID, true
+	}
+	if update.CallbackQuery != nil && update.CallbackQuery.Message != nil {
+		return update.CallbackQuery.Message.Chat.ID, true
+	}
+	return 0, false
+}
+
+// handleUpdate обрабатывает один апдейт; вызывается только из шарда его чата
+func (h *Handler) handleUpdate(update tgbotapi.Update) {
+	chatID, ok := updateChatID(update)
+	if !ok {
+		return
+	}
+	if update.MyChatMember != nil {
+		h.handleMyChatMember(chatID, update.MyChatMember)
+		return
+	}
+	var text string
+	if update.Message != nil {
+		text = update.Message.Text
+	} else {
+		text = update.CallbackQuery.Data
+	}
+	if update.CallbackQuery != nil && usecase.IsTrackedClick(text) {
+		// кнопка рассылки: фиксируем клик и обрабатываем её исходные данные как обычный ввод
+		_, _ = h.bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, ""))
+		data, err := h.broadcastUC.Click(chatID, text)
+		if err != nil && h.logger != nil {
+			h.logger.Error("broadcast click failed", "chat_id", chatID, "data", text, "error", err)
 		}
+		if data == "" {
+			return
+		}
+		text = data
+	}
+	if h.leadDesk != nil && (chatID == h.leadDesk.ChatID || h.isAdmin(chatID)) && h.handleLeadDesk(chatID, update, text) {
+		return
+	}
+	if h.leadDesk != nil && chatID == h.leadDesk.ChatID {
+		// чат менеджеров — не пользователь квиза и не получатель рассылок
+		return
+	}
+	// сохраняем только не-админов
+	if !h.isAdmin(chatID) {
+		_ = h.userRepo.SaveUser(chatID)
+		if update.SentFrom() != nil {
+			if err := h.userRepo.SaveProfile(chatID, profileOf(update)); err != nil && h.logger != nil {
+				h.logger.Error("user profile save failed", "chat_id", chatID, "error", err)
+			}
+		}
+		if text == "/start" {
+			// пользователь разблокировал бота и начал заново — снова получает рассылки
+			if err := h.userRepo.Reactivate(chatID); err != nil && h.logger != nil {
+				h.logger.Error("user reactivate failed", "chat_id", chatID, "error", err)
+			}
+		}
+	}
 
-		if text == "/admin" {
-			if !h.isAdmin(chatID) {
-				h.sendText(chatID, "Доступ запрещен")
+	if text == "/admin" {
+		if !h.isAdmin(chatID) {
+			h.sendText(chatID, "Доступ запрещен")
+			if h.logger != nil {
+				h.logger.Warn("admin denied", "chat_id", chatID)
+			}
+			return
+		}
+		msg := tgbotapi.NewMessage(chatID, "Админ-меню")
+		msg.ReplyMarkup = inlineKeyboard(h.adminMenu())
+		_, _ = h.bot.Send(msg)
+		if h.logger != nil {
+			h.logger.Info("admin opened menu", "chat_id", chatID)
+		}
+		return
+	}
+	if h.isAdmin(chatID) {
+		if text == "Создать рассылку" {
+			s := h.getBSession(chatID)
+			msg := h.broadcastUC.Start(s)
+			h.saveBSession(chatID, s)
+			h.sendTextWithKeyboard(chatID, msg, nil)
+			if h.logger != nil {
+				h.logger.Info("broadcast start", "chat_id", chatID)
+			}
+			return
+		}
+		if text == "Статистика" {
+			report, ids := h.broadcastUC.StatsSummary(5)
+			msg := tgbotapi.NewMessage(chatID, report)
+			if len(ids) > 0 {
+				msg.ReplyMarkup = idKeyboard(failuresCSVPrefix, "Ошибки #%d в CSV", ids)
+			}
+			_, _ = h.bot.Send(msg)
+			return
+		}
+		if strings.HasPrefix(text, failuresCSVPrefix) {
+			id, err := strconv.ParseInt(strings.TrimPrefix(text, failuresCSVPrefix), 10, 64)
+			if err != nil {
+				return
+			}
+			data, err := h.broadcastUC.FailuresCSV(id)
+			if err == nil {
+				doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: fmt.Sprintf("broadcast_%d_failures.csv", id), Bytes: data})
+				_, err = h.bot.Send(doc)
+			}
+			if err != nil {
 				if h.logger != nil {
-					h.logger.Warn("admin denied", "chat_id", chatID)
+					h.logger.Error("failures export failed", "chat_id", chatID, "broadcast_id", id, "error", err)
 				}
-				continue
+				h.sendText(chatID, "Не удалось выгрузить ошибки рассылки")
+			}
+			return
+		}
+		if text == "Доставка в CRM" && h.leadDispatcher != nil {
+			report, ids := h.leadDispatcher.Stuck(10)
+			msg := tgbotapi.NewMessage(chatID, report)
+			if len(ids) > 0 {
+				msg.ReplyMarkup = idKeyboard(crmRetryPrefix, "Повторить #%d", ids)
 			}
-			msg := tgbotapi.NewMessage(chatID, "Админ-меню")
-			msg.ReplyMarkup = inlineKeyboard([]string{"Создать рассылку", "Статистика", "Воронка"})
 			_, _ = h.bot.Send(msg)
+			return
+		}
+		if text == "Расписание рассылок" && h.broadcastUC.Schedules != nil {
+			report, ids := h.broadcastUC.ScheduleList(10)
+			msg := tgbotapi.NewMessage(chatID, report)
+			if len(ids) > 0 {
+				msg.ReplyMarkup = idKeyboard(scheduleCancelPrefix, "Отменить #%d", ids)
+			}
+			_, _ = h.bot.Send(msg)
+			return
+		}
+		if strings.HasPrefix(text, scheduleCancelPrefix) && h.broadcastUC.Schedules != nil {
+			id, err := strconv.ParseInt(strings.TrimPrefix(text, scheduleCancelPrefix), 10, 64)
+			if err != nil {
+				return
+			}
+			msg, err := h.broadcastUC.CancelSchedule(id)
 			if h.logger != nil {
-				h.logger.Info("admin opened menu", "chat_id", chatID)
+				if err != nil {
+					h.logger.Error("schedule cancel failed", "chat_id", chatID, "schedule_id", id, "error", err)
+				} else {
+					h.logger.Info("schedule cancelled", "chat_id", chatID, "schedule_id", id)
+				}
 			}
-			continue
+			h.sendText(chatID, msg)
+			return
+		}
+		if text == "A/B-тесты" && h.broadcastUC.ABTests != nil {
+			h.sendText(chatID, h.broadcastUC.ABTestReport(5))
+			return
+		}
+		if text == "Исправить рассылку" && h.broadcastUC.Ops != nil {
+			report, ids := h.broadcastUC.RecallList(5)
+			msg := tgbotapi.NewMessage(chatID, report)
+			if len(ids) > 0 {
+				msg.ReplyMarkup = recallKeyboard(ids)
+			}
+			_, _ = h.bot.Send(msg)
+			return
 		}
-		if h.isAdmin(chatID) {
-			if text == "Создать рассылку" {
-				s := h.getBSession(chatID)
-				msg := h.broadcastUC.Start(s)
-				h.sendTextWithKeyboard(chatID, msg, nil)
+		if (strings.HasPrefix(text, recallEditPrefix) || strings.HasPrefix(text, recallDeletePrefix)) && h.broadcastUC.Ops != nil {
+			kind, prefix := usecase.OpEdit, recallEditPrefix
+			if strings.HasPrefix(text, recallDeletePrefix) {
+				kind, prefix = usecase.OpDelete, recallDeletePrefix
+			}
+			id, err := strconv.ParseInt(strings.TrimPrefix(text, prefix), 10, 64)
+			if err != nil {
+				return
+			}
+			s := h.getBSession(chatID)
+			msg, opts := h.broadcastUC.StartRecall(s, id, kind)
+			h.saveBSession(chatID, s)
+			h.sendTextWithKeyboard(chatID, msg, opts)
+			return
+		}
+		if (strings.HasPrefix(text, approvePrefix) || strings.HasPrefix(text, rejectPrefix)) && h.broadcastUC.Approvals != nil {
+			approve, prefix := strings.HasPrefix(text, approvePrefix), rejectPrefix
+			if approve {
+				prefix = approvePrefix
+			}
+			id, err := strconv.ParseInt(strings.TrimPrefix(text, prefix), 10, 64)
+			if err != nil {
+				return
+			}
+			var msg string
+			if approve {
+				msg, err = h.broadcastUC.Approve(h.workCtx, chatID, id)
+			} else {
+				msg, err = h.broadcastUC.Reject(chatID, id)
+			}
+			if h.logger != nil {
+				if err != nil {
+					h.logger.Error("broadcast approval failed", "chat_id", chatID, "approval_id", id, "error", err)
+				} else {
+					h.logger.Info("broadcast approval decided", "chat_id", chatID, "approval_id", id, "approved", approve)
+				}
+			}
+			h.sendText(chatID, msg)
+			return
+		}
+		if strings.HasPrefix(text, crmRetryPrefix) && h.leadDispatcher != nil {
+			id, err := strconv.ParseInt(strings.TrimPrefix(text, crmRetryPrefix), 10, 64)
+			if err == nil {
+				err = h.leadDispatcher.RetryNow(id)
+			}
+			if err != nil {
 				if h.logger != nil {
-					h.logger.Info("broadcast start", "chat_id", chatID)
+					h.logger.Error("crm retry failed", "chat_id", chatID, "error", err)
 				}
-				continue
+				h.sendText(chatID, "Не удалось поставить лид в очередь")
+				return
 			}
-			if text == "Статистика" {
-				h.sendText(chatID, h.broadcastUC.StatsSummary(5))
-				continue
+			if h.logger != nil {
+				h.logger.Info("crm retry requested", "chat_id", chatID, "outbox_id", id)
 			}
-			if text == "Воронка" {
-				if h.funnel != nil {
-					labels, values := h.funnel.GraphData()
-					if err := h.sendFunnelChart(chatID, labels, values); err != nil {
-						if h.logger != nil {
-							h.logger.Error("funnel chart failed", "error", err)
-						}
-						h.sendText(chatID, h.funnel.Chart())
-					}
+			h.sendText(chatID, fmt.Sprintf("Лид #%d поставлен на повторную отправку", id))
+			return
+		}
+		if h.leadExport != nil && h.handleLeadExport(chatID, text) {
+			return
+		}
+		if text == "Воронка" {
+			if h.funnel == nil {
+				h.sendText(chatID, "Воронка недоступна")
+				return
+			}
+			msg := tgbotapi.NewMessage(chatID, "Воронка: выберите период")
+			msg.ReplyMarkup = funnelPeriodKeyboard()
+			_, _ = h.bot.Send(msg)
+			return
+		}
+		if h.funnel != nil {
+			switch {
+			case text == funnelPrefix+funnelCustom:
+				h.sendText(chatID, "Пришлите период командой: /funnel 01.09.2025-30.09.2025")
+				return
+			case strings.HasPrefix(text, funnelPrefix):
+				h.sendFunnel(chatID, strings.TrimPrefix(text, funnelPrefix))
+				return
+			case strings.HasPrefix(text, "/funnel"):
+				h.sendFunnel(chatID, strings.TrimSpace(strings.TrimPrefix(text, "/funnel")))
+				return
+			case strings.HasPrefix(text, funnelAnswersPrefix):
+				h.sendAnswerBreakdown(chatID, strings.TrimPrefix(text, funnelAnswersPrefix))
+				return
+			case strings.HasPrefix(text, funnelDropOffPrefix):
+				h.sendDropOff(chatID, strings.TrimPrefix(text, funnelDropOffPrefix))
+				return
+			case strings.HasPrefix(text, funnelTextPrefix), strings.HasPrefix(text, funnelCohortsPrefix):
+				cohorts := strings.HasPrefix(text, funnelCohortsPrefix)
+				key := strings.TrimPrefix(strings.TrimPrefix(text, funnelTextPrefix), funnelCohortsPrefix)
+				p, ok := h.funnel.Period(key, time.Now())
+				if !ok {
+					return
+				}
+				if cohorts {
+					h.sendText(chatID, h.funnel.CohortReport(p))
 				} else {
-					h.sendText(chatID, "Воронка недоступна")
+					h.sendText(chatID, h.funnel.ChartFor(p))
 				}
-				continue
+				return
 			}
-			if s := h.bcastSessions[chatID]; s != nil {
-				if m := update.Message; m != nil && len(m.Photo) > 0 {
-					ph := m.Photo[len(m.Photo)-1]
-					fileID := ph.FileID
-					caption := m.Caption
-					msg, opts := h.broadcastUC.ReceivePhoto(s, fileID, caption)
+		}
+		if h.funnel != nil && h.funnel.Daily != nil {
+			if text == "Динамика" {
+				msg := tgbotapi.NewMessage(chatID, "Динамика: выберите период")
+				msg.ReplyMarkup = activityKeyboard()
+				_, _ = h.bot.Send(msg)
+				return
+			}
+			if strings.HasPrefix(text, activityPrefix) {
+				h.sendActivity(chatID, strings.TrimPrefix(text, activityPrefix))
+				return
+			}
+		}
+		if s := h.findBSession(chatID); s != nil {
+			// в режиме черновика любое сообщение админа — это пост, а кнопки меню приходят callback'ами
+			if m := update.Message; m != nil && (s.State == usecase.BStateEnter || s.State == usecase.BStateCompose) {
+				msg, opts := h.broadcastUC.ReceivePost(s, broadcastPost(m))
+				h.saveBSession(chatID, s)
+				if msg != "" {
 					h.sendTextWithKeyboard(chatID, msg, opts)
-					continue
 				}
-				switch s.State {
-				case usecase.BStateEnter:
-					msg, opts, _ := h.broadcastUC.ReceiveText(s, text)
-					h.sendTextWithKeyboard(chatID, msg, opts)
-					continue
-				case usecase.BStateConfirm:
-					msg, _ := h.broadcastUC.ConfirmSend(s, text)
+				return
+			}
+			switch s.State {
+			case usecase.BStateCompose:
+				msg, opts := h.broadcastUC.ComposeInput(chatID, s, text)
+				h.saveBSession(chatID, s)
+				h.sendTextWithKeyboard(chatID, msg, opts)
+				return
+			case usecase.BStateButton:
+				msg, opts := h.broadcastUC.ButtonInput(s, text)
+				h.saveBSession(chatID, s)
+				h.sendTextWithKeyboard(chatID, msg, opts)
+				return
+			case usecase.BStateSplit:
+				msg, opts := h.broadcastUC.SplitInput(s, text)
+				h.saveBSession(chatID, s)
+				h.sendTextWithKeyboard(chatID, msg, opts)
+				return
+			case usecase.BStateWinnerDelay:
+				msg, opts := h.broadcastUC.WinnerDelayInput(s, text)
+				h.saveBSession(chatID, s)
+				h.sendTextWithKeyboard(chatID, msg, opts)
+				return
+			case usecase.BStateSegment, usecase.BStateSegmentValue:
+				msg, opts := h.broadcastUC.SegmentInput(s, text)
+				h.saveBSession(chatID, s)
+				h.sendTextWithKeyboard(chatID, msg, opts)
+				return
+			case usecase.BStateRecallText:
+				post := usecase.BroadcastPost{Text: text}
+				if update.Message != nil {
+					post = broadcastPost(update.Message)
+				}
+				msg, opts := h.broadcastUC.RecallText(s, post)
+				h.saveBSession(chatID, s)
+				h.sendTextWithKeyboard(chatID, msg, opts)
+				return
+			case usecase.BStateRecallConfirm:
+				msg, err := h.broadcastUC.RecallConfirm(h.workCtx, chatID, s, text)
+				h.saveBSession(chatID, s)
+				h.sendText(chatID, msg)
+				if h.logger != nil {
+					if err != nil {
+						h.logger.Error("broadcast recall failed", "chat_id", chatID, "error", err)
+					} else if s.State == usecase.BStateIdle {
+						h.logger.Info("broadcast recall started", "chat_id", chatID)
+					}
+				}
+				return
+			case usecase.BStateSchedule:
+				msg, opts := h.broadcastUC.ScheduleInput(chatID, s, text)
+				h.saveBSession(chatID, s)
+				h.sendTextWithKeyboard(chatID, msg, opts)
+				if h.logger != nil && s.State == usecase.BStateIdle {
+					h.logger.Info("broadcast scheduled", "chat_id", chatID)
+				}
+				return
+			case usecase.BStateConfirm:
+				msg, err := h.broadcastUC.ConfirmSend(h.workCtx, chatID, s, text)
+				h.saveBSession(chatID, s)
+				if s.State == usecase.BStateConfirm {
+					// после тестовой отправки черновик ждёт подтверждения дальше
+					h.sendTextWithKeyboard(chatID, msg, h.broadcastUC.ConfirmOptions(s))
+				} else {
 					h.sendTextRemoveKeyboard(chatID, msg)
-					if h.logger != nil {
-						h.logger.Info("broadcast confirm", "chat_id", chatID)
+				}
+				if h.logger != nil {
+					if err != nil {
+						h.logger.Error("broadcast confirm failed", "chat_id", chatID, "error", err)
+					} else {
+						h.logger.Info("broadcast confirm", "chat_id", chatID, "command", text)
 					}
-					continue
 				}
+				return
 			}
-			continue
 		}
+		return
+	}
 
-		if update.Message != nil && update.Message.Contact != nil {
-			s := h.getSession(chatID)
-			if s.State == usecase.StateRequestPhone {
-				s.Phone = update.Message.Contact.PhoneNumber
-				h.saveAndSendLead(chatID, s)
-				go func(id int64) {
-					time.Sleep(2 * time.Minute)
-					h.sessions[id] = &usecase.Session{State: usecase.StateStart}
-				}(chatID)
-				continue
+	if update.Message != nil && update.Message.Contact != nil {
+		s := h.getSession(chatID)
+		if s.State == usecase.StateRequestPhone {
+			s.Phone = update.Message.Contact.PhoneNumber
+			// номер из контакта приходит без «+» или с ним — храним в одном формате
+			if phone, ok := domain.NormalizePhone(s.Phone); ok {
+				s.Phone = phone
 			}
+			h.saveSession(chatID, s)
+			h.saveAndSendLead(chatID, s, profileOf(update))
+			return
 		}
+	}
 
-		// Принимаем номер текстом, если включен StateRequestPhone
-		if update.Message != nil {
-			rawText := strings.TrimSpace(update.Message.Text)
-			if rawText != "" && !strings.HasPrefix(rawText, "/") { // не перехватывать команды типа /start
-				s := h.getSession(chatID)
-				if s.State == usecase.StateRequestPhone {
-					candidate := rawText
-					if looksLikePhone(candidate) {
-						s.Phone = candidate
-						h.saveAndSendLead(chatID, s)
-						go func(id int64) {
-							time.Sleep(2 * time.Minute)
-							h.sessions[id] = &usecase.Session{State: usecase.StateStart}
-						}(chatID)
-						continue
-					} else {
-						h.sendText(chatID, "Похоже, это не номер телефона. Пришлите номер в формате +7XXXXXXXXXX или нажмите кнопку ‘Отправить номер’.")
-						h.trackFunnel(chatID, s.State)
-						continue
-					}
+	// Принимаем номер текстом, если включен StateRequestPhone
+	if update.Message != nil {
+		rawText := strings.TrimSpace(update.Message.Text)
+		if rawText != "" && !strings.HasPrefix(rawText, "/") { // не перехватывать команды типа /start
+			s := h.getSession(chatID)
+			if s.State == usecase.StateRequestPhone {
+				if phone, ok := domain.NormalizePhone(rawText); ok {
+					s.Phone = phone
+					h.saveSession(chatID, s)
+					h.saveAndSendLead(chatID, s, profileOf(update))
+					return
+				} else {
+					h.sendText(chatID, "Похоже, это не номер телефона. Пришлите номер в формате +7XXXXXXXXXX или нажмите кнопку ‘Отправить номер’.")
+					h.trackFunnel(chatID, s.State, s)
+					return
 				}
 			}
 		}
+	}
 
-		s := h.getSession(chatID)
-		reply := h.dialog.Handle(s, text)
-		if text == usecase.StartBtn {
-			h.sendText(chatID, "Несколько уточняющих вопросов, и мы отправим вам подходящее предложение уже через пару минут.")
+	// необязательные вопросы после номера: кнопки и свободный текст, команды идут в сценарий
+	if text != "" && !strings.HasPrefix(text, "/") && h.dialog.HasFollowUp() {
+		if s := h.getSession(chatID); usecase.IsFollowUpState(s.State) {
+			h.followUpInput(chatID, s, text)
+			return
 		}
-		if s.State == usecase.StateRequestPhone {
-			btn := tgbotapi.NewKeyboardButtonContact("Отправить номер")
-			kb := tgbotapi.NewReplyKeyboard(tgbotapi.NewKeyboardButtonRow(btn))
-			kb.ResizeKeyboard = true
-			msg := tgbotapi.NewMessage(chatID, reply.Text)
-			msg.ReplyMarkup = kb
-			_, _ = h.bot.Send(msg)
-			// Сразу приложим релевантный каталог (асинхронно с кэшем file_id)
-			h.sendCatalogPDF(chatID, s)
-			h.trackFunnel(chatID, s.State)
-			continue
+	}
+
+	s := h.getSession(chatID)
+	if text == "/start" {
+		// пользователь начал квиз заново — отложенный сброс больше не нужен
+		h.cancelSessionReset(chatID)
+		s.ResetAt = time.Time{}
+	}
+	answers := [3]string{s.Purpose, s.Bedrooms, s.Payment}
+	// то же условие, по которому Dialog начинает сценарий с первого шага
+	started := text == "/start" || s.State == usecase.StateStart || s.State == ""
+	reply := h.dialog.Handle(s, text)
+	h.saveSession(chatID, s)
+	if started {
+		h.attribute(chatID, usecase.ConversionQuizStart)
+	}
+	if answers != [3]string{s.Purpose, s.Bedrooms, s.Payment} {
+		// ответы дублируем в users, чтобы по ним можно было сегментировать рассылки
+		if err := h.userRepo.SaveAnswers(chatID, s.Purpose, s.Bedrooms, s.Payment); err != nil && h.logger != nil {
+			h.logger.Error("user answers save failed", "chat_id", chatID, "error", err)
+		}
+	}
+	if reply.Notice != "" {
+		h.sendText(chatID, reply.Notice)
+	}
+	if s.State == usecase.StateRequestPhone {
+		btn := tgbotapi.NewKeyboardButtonContact("Отправить номер")
+		kb := tgbotapi.NewReplyKeyboard(tgbotapi.NewKeyboardButtonRow(btn))
+		kb.ResizeKeyboard = true
+		msg := tgbotapi.NewMessage(chatID, reply.Text)
+		msg.ReplyMarkup = kb
+		_, _ = h.bot.Send(msg)
+		// Сразу приложим релевантный каталог (асинхронно с кэшем file_id)
+		h.sendCatalogPDF(chatID, s)
+		h.trackFunnel(chatID, s.State, s)
+		return
+	}
+	h.trackFunnel(chatID, s.State, s)
+	h.applyReply(chatID, s, reply)
+
+	// финального шага нет — очистку сессии выполняем после RequestPhone/LeadSaved
+}
+
+// attribute приписывает событие последней рассылке, полученной пользователем
+func (h *Handler) attribute(chatID int64, kind string) {
+	jobID, err := h.broadcastUC.Attribute(chatID, kind)
+	if h.logger == nil {
+		return
+	}
+	if err != nil {
+		h.logger.Error("broadcast attribution failed", "chat_id", chatID, "kind", kind, "error", err)
+	} else if jobID != 0 {
+		h.logger.Info("broadcast conversion", "chat_id", chatID, "kind", kind, "broadcast_id", jobID)
+	}
+}
+
+// handleMyChatMember отслеживает блокировку и разблокировку бота пользователем
+func (h *Handler) handleMyChatMember(chatID int64, m *tgbotapi.ChatMemberUpdated) {
+	if h.isAdmin(chatID) {
+		return
+	}
+	var err error
+	switch m.NewChatMember.Status {
+	case "kicked", "left":
+		err = h.userRepo.Deactivate(chatID, domain.InactiveBlocked)
+	case "member":
+		err = h.userRepo.Reactivate(chatID)
+	default:
+		return
+	}
+	if h.logger != nil {
+		if err != nil {
+			h.logger.Error("user status update failed", "chat_id", chatID, "status", m.NewChatMember.Status, "error", err)
+		} else {
+			h.logger.Info("user status changed", "chat_id", chatID, "status", m.NewChatMember.Status)
 		}
-		h.trackFunnel(chatID, s.State)
-		h.applyReply(chatID, reply)
+	}
+}
 
-		// финального шага нет — очистку сессии выполняем после RequestPhone/LeadSaved
+// profileOf — профиль отправителя апдейта; имя из контакта есть только в сообщении с контактом
+func profileOf(update tgbotapi.Update) domain.Profile {
+	var p domain.Profile
+	if from := update.SentFrom(); from != nil {
+		p = domain.Profile{Username: from.UserName, FirstName: from.FirstName, LastName: from.LastName, LanguageCode: from.LanguageCode}
 	}
+	if m := update.Message; m != nil && m.Contact != nil {
+		p.ContactName = strings.TrimSpace(m.Contact.FirstName + " " + m.Contact.LastName)
+	}
+	return p
 }
 
-// saveAndSendLead сохраняет лид, отправляет в MacroCRM и уведомляет пользователя
-func (h *Handler) saveAndSendLead(chatID int64, s *usecase.Session) {
+// saveAndSendLead сохраняет лид, ставит его в очередь доставки в CRM и уведомляет пользователя.
+// Если настроены вопросы после номера, задаёт первый из них; сессия сбрасывается по таймеру.
+func (h *Handler) saveAndSendLead(chatID int64, s *usecase.Session, p domain.Profile) {
 	if s == nil {
 		return
 	}
+	var leadID int64
 	if h.leadRepo != nil {
-		ld := domain.Lead{ChatID: chatID, Purpose: s.Purpose, Bedrooms: s.Bedrooms, Payment: s.Payment, Phone: s.Phone}
-		if err := h.leadRepo.SaveLead(ld); err != nil {
+		ld := domain.Lead{ChatID: chatID, Purpose: s.Purpose, Bedrooms: s.Bedrooms, Payment: s.Payment, Phone: s.Phone, Profile: p}
+		var merged bool
+		var err error
+		if leadID, merged, err = h.leadRepo.SaveLead(ld); err != nil {
 			if h.logger != nil {
 				h.logger.Error("lead save failed", "chat_id", chatID, "error", err)
 			}
 		} else {
 			if h.logger != nil {
-				h.logger.Info("lead saved", "chat_id", chatID)
+				h.logger.Info("lead saved", "chat_id", chatID, "lead_id", leadID, "merged", merged)
 			}
-		}
-		if h.leadDelivery != nil {
-			go func(id int64, ld domain.Lead) {
-				if h.logger != nil {
-					h.logger.Info("macrocrm send start", "chat_id", id)
-				}
-				if err := h.leadDelivery.SendLead(context.Background(), ld); err != nil {
-					if h.logger != nil {
-						h.logger.Error("macrocrm send failed", "chat_id", id, "error", err)
-					}
-				} else {
-					if h.logger != nil {
-						h.logger.Info("macrocrm send success", "chat_id", id)
+			// лид уже лежит в outbox вместе с записью — диспетчер доставит его в CRM
+			if h.leadDispatcher != nil {
+				h.leadDispatcher.Notify()
+			}
+			if h.leadDesk != nil {
+				h.goBackground(func() {
+					if err := h.leadDesk.Announce(leadID, merged); err != nil && h.logger != nil {
+						h.logger.Error("lead announce failed", "lead_id", leadID, "error", err)
 					}
-				}
-			}(chatID, ld)
+				})
+			}
+			h.attribute(chatID, usecase.ConversionLead)
 		}
 	}
-	h.trackFunnel(chatID, usecase.StateLeadSaved)
+	h.trackFunnel(chatID, usecase.StateLeadSaved, s)
+	if leadID != 0 && h.dialog.HasFollowUp() {
+		h.startFollowUp(chatID, s, leadID, p)
+		return
+	}
 	h.sendTextRemoveKeyboard(chatID, "Спасибо! Мы получили ваш номер. Наш эксперт свяжется с вами в ближайшее время.")
+	h.scheduleSessionReset(chatID, sessionResetDelay)
+}
+
+// adminMenu — кнопки админ-меню; разделы для неподключённых модулей не показываются
+func (h *Handler) adminMenu() []string {
+	items := []string{"Создать рассылку", "Статистика", "Воронка"}
+	if h.funnel != nil && h.funnel.Daily != nil {
+		items = append(items, "Динамика")
+	}
+	if h.broadcastUC.Schedules != nil {
+		items = append(items, "Расписание рассылок")
+	}
+	if h.broadcastUC.Ops != nil {
+		items = append(items, "Исправить рассылку")
+	}
+	if h.broadcastUC.ABTests != nil {
+		items = append(items, "A/B-тесты")
+	}
+	if h.leadDesk != nil {
+		items = append(items, "Лиды")
+	}
+	if h.leadExport != nil {
+		items = append(items, "Выгрузка лидов")
+	}
+	if h.leadDispatcher != nil {
+		items = append(items, "Доставка в CRM")
+	}
+	return items
 }
 
 func (h *Handler) isAdmin(chatID int64) bool {
@@ -281,31 +805,53 @@ func (h *Handler) isAdmin(chatID int64) bool {
 	return ok
 }
 
+// getSession возвращает сохранённую сессию или новую; изменения нужно фиксировать через saveSession
 func (h *Handler) getSession(chatID int64) *usecase.Session {
-	if s, ok := h.sessions[chatID]; ok {
-		return s
+	s, err := h.sessions.GetSession(chatID)
+	if err != nil && h.logger != nil {
+		h.logger.Error("session load failed", "chat_id", chatID, "error", err)
+	}
+	// срок сброса истёк, а таймер не сработал — бот перезапускался
+	if s == nil || (!s.ResetAt.IsZero() && !time.Now().Before(s.ResetAt)) {
+		s = &usecase.Session{State: usecase.StateStart}
+	}
+	return s
+}
+
+func (h *Handler) saveSession(chatID int64, s *usecase.Session) {
+	if err := h.sessions.SaveSession(chatID, s); err != nil && h.logger != nil {
+		h.logger.Error("session save failed", "chat_id", chatID, "error", err)
+	}
+}
+
+// findBSession возвращает черновик рассылки админа или nil, если рассылка не начиналась
+func (h *Handler) findBSession(chatID int64) *usecase.BroadcastSession {
+	s, err := h.sessions.GetBroadcastSession(chatID)
+	if err != nil && h.logger != nil {
+		h.logger.Error("broadcast session load failed", "chat_id", chatID, "error", err)
 	}
-	s := &usecase.Session{State: usecase.StateStart}
-	h.sessions[chatID] = s
 	return s
 }
 
 func (h *Handler) getBSession(chatID int64) *usecase.BroadcastSession {
-	if s, ok := h.bcastSessions[chatID]; ok {
+	if s := h.findBSession(chatID); s != nil {
 		return s
 	}
-	s := &usecase.BroadcastSession{State: usecase.BStateIdle}
-	h.bcastSessions[chatID] = s
-	return s
+	return &usecase.BroadcastSession{State: usecase.BStateIdle}
+}
+
+func (h *Handler) saveBSession(chatID int64, s *usecase.BroadcastSession) {
+	if err := h.sessions.SaveBroadcastSession(chatID, s); err != nil && h.logger != nil {
+		h.logger.Error("broadcast session save failed", "chat_id", chatID, "error", err)
+	}
 }
 
-func (h *Handler) applyReply(chatID int64, r usecase.Reply) {
+func (h *Handler) applyReply(chatID int64, s *usecase.Session, r usecase.Reply) {
 	if r.RemoveKeyboard {
 		msg := tgbotapi.NewMessage(chatID, r.Text)
 		msg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
 		_, _ = h.bot.Send(msg)
 		// Попробуем отправить релевантный PDF каталог
-		s := h.getSession(chatID)
 		h.sendCatalogPDF(chatID, s)
 		return
 	}
@@ -313,7 +859,6 @@ func (h *Handler) applyReply(chatID int64, r usecase.Reply) {
 		h.sendTextWithKeyboard(chatID, r.Text, r.Options)
 		// Если следующий шаг — запрос телефона, всё равно приложим каталог прямо сейчас
 		if r.AdvanceTo == usecase.StateRequestPhone {
-			s := h.getSession(chatID)
 			h.sendCatalogPDF(chatID, s)
 		}
 		return
@@ -324,11 +869,12 @@ func (h *Handler) applyReply(chatID int64, r usecase.Reply) {
 
 // sendCatalogPDF отправляет документ из папки collections согласно текущему выбору пользователя
 func (h *Handler) sendCatalogPDF(chatID int64, s *usecase.Session) {
-	filePath := usecase.CatalogFileFor(s)
+	filePath := h.dialog.CatalogFile(s)
 	if strings.TrimSpace(filePath) == "" {
 		return
 	}
-	go func(path string) {
+	h.goBackground(func() {
+		path := filePath
 		// try send preview image before PDF if exists
 		base := strings.TrimSuffix(path, filepath.Ext(path))
 		for _, ext := range []string{".jpg", ".jpeg", ".png"} {
@@ -411,7 +957,7 @@ func (h *Handler) sendCatalogPDF(chatID int64, s *usecase.Session) {
 		if h.logger != nil {
 			h.logger.Info("catalog pdf sent", "chat_id", chatID, "file", path)
 		}
-	}(filePath)
+	})
 }
 
 func (h *Handler) sendText(chatID int64, text string) {
@@ -443,83 +989,184 @@ func inlineKeyboard(opts []string) tgbotapi.InlineKeyboardMarkup {
 	return tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
 }
 
-// простая эвристика валидации телефона
-func looksLikePhone(s string) bool {
-	s = strings.TrimSpace(s)
-	if s == "" {
-		return false
+const (
+	crmRetryPrefix       = "crm_retry:"
+	scheduleCancelPrefix = "schedule_cancel:"
+	failuresCSVPrefix    = "failures_csv:"
+	recallEditPrefix     = "recall_edit:"
+	recallDeletePrefix   = "recall_delete:"
+	approvePrefix        = "bc_approve:"
+	rejectPrefix         = "bc_reject:"
+	funnelPrefix         = "funnel:"
+	funnelTextPrefix     = "funnel_text:"
+	funnelCohortsPrefix  = "funnel_cohorts:"
+	funnelAnswersPrefix  = "funnel_answers:"
+	funnelDropOffPrefix  = "funnel_dropoff:"
+	funnelCustom         = "custom"
+	activityPrefix       = "activity:"
+	leadStatusPrefix     = "lead_status:"
+	leadOpenPrefix       = "lead_open:"
+	leadExportPrefix     = "leads_export:"
+)
+
+func funnelPeriodKeyboard() tgbotapi.InlineKeyboardMarkup {
+	btn := func(label, key string) tgbotapi.InlineKeyboardButton {
+		return tgbotapi.NewInlineKeyboardButtonData(label, funnelPrefix+key)
 	}
-	// допускаем +7, 7, 8 в начале и 10-11 цифр суммарно
-	digits := 0
-	for _, r := range s {
-		if r >= '0' && r <= '9' {
-			digits++
-		}
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(btn("Сегодня", usecase.FunnelToday), btn("7 дней", usecase.FunnelWeek), btn("30 дней", usecase.FunnelMonth)),
+		tgbotapi.NewInlineKeyboardRow(btn("Всё время", usecase.FunnelAll), btn("Свой период", funnelCustom)),
+	)
+}
+
+// funnelReportKeyboard — кнопки под графиком воронки за период key
+func funnelReportKeyboard(key string) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Текстом", funnelTextPrefix+key),
+			tgbotapi.NewInlineKeyboardButtonData("Когорты по неделям", funnelCohortsPrefix+key),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("По ответам", funnelAnswersPrefix+key),
+			tgbotapi.NewInlineKeyboardButtonData("Отвал и время", funnelDropOffPrefix+key),
+		),
+	)
+}
+
+// idKeyboard — по кнопке на каждый ID; callback_data = prefix + ID
+func idKeyboard(prefix, label string, ids []int64) tgbotapi.InlineKeyboardMarkup {
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(ids))
+	for _, id := range ids {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf(label, id), prefix+strconv.FormatInt(id, 10)),
+		))
 	}
-	if strings.HasPrefix(s, "+7") && digits == 11 {
-		return true
+	return tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
+
+// recallKeyboard — кнопки «Изменить» и «Удалить» в одном ряду для каждой рассылки
+func recallKeyboard(ids []int64) tgbotapi.InlineKeyboardMarkup {
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(ids))
+	for _, id := range ids {
+		sid := strconv.FormatInt(id, 10)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Изменить #"+sid, recallEditPrefix+sid),
+			tgbotapi.NewInlineKeyboardButtonData("Удалить #"+sid, recallDeletePrefix+sid),
+		))
 	}
-	if (strings.HasPrefix(s, "8") || strings.HasPrefix(s, "7")) && digits == 11 {
-		return true
+	return tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
+
+// sendFunnel отправляет график воронки за период с кнопками текстовой версии и когорт
+func (h *Handler) sendFunnel(chatID int64, key string) {
+	p, ok := h.funnel.Period(key, time.Now())
+	if !ok {
+		h.sendText(chatID, "Не понял период. Формат: /funnel 01.09.2025-30.09.2025")
+		return
 	}
-	if digits == 10 { // без кода страны
-		return true
+	markup := funnelReportKeyboard(p.Key)
+	labels, values, err := h.funnel.GraphDataFor(p)
+	if err == nil {
+		err = h.sendFunnelChart(chatID, p.Label, labels, values, markup)
+	}
+	if err != nil {
+		if h.logger != nil {
+			h.logger.Error("funnel chart failed", "period", p.Key, "error", err)
+		}
+		msg := tgbotapi.NewMessage(chatID, h.funnel.ChartFor(p))
+		msg.ReplyMarkup = markup
+		_, _ = h.bot.Send(msg)
 	}
-	return false
 }
 
-// Реализация отправителя для юзкейсов
-type Sender struct{ bot *tgbotapi.BotAPI }
-
-func NewSender(bot *tgbotapi.BotAPI) *Sender { return &Sender{bot: bot} }
-
-func (s *Sender) SendText(chatID int64, text string) error {
-	msg := tgbotapi.NewMessage(chatID, text)
-	_, err := s.bot.Send(msg)
-	return err
+// sendAnswerBreakdown отправляет график и таблицу конверсии в лид по ответам квиза
+func (h *Handler) sendAnswerBreakdown(chatID int64, key string) {
+	p, ok := h.funnel.Period(key, time.Now())
+	if !ok {
+		return
+	}
+	list, err := h.funnel.AnswerBreakdown(p)
+	if err == nil && len(list) > 0 {
+		if err := h.sendAnswerChart(chatID, p, list); err != nil && h.logger != nil {
+			h.logger.Error("answer chart failed", "period", p.Key, "error", err)
+		}
+	}
+	h.sendText(chatID, h.funnel.AnswerReport(p))
 }
 
-func (s *Sender) SendPhoto(chatID int64, fileID string, caption string) error {
-	photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileID(fileID))
-	photo.Caption = caption
-	_, err := s.bot.Send(photo)
-	return err
+// sendDropOff отправляет график шагов, на которых остановились пользователи без лида, и отчёт о времени между шагами
+func (h *Handler) sendDropOff(chatID int64, key string) {
+	p, ok := h.funnel.Period(key, time.Now())
+	if !ok {
+		return
+	}
+	d, err := h.funnel.DropOff(p, time.Now())
+	if err != nil {
+		if h.logger != nil {
+			h.logger.Error("funnel drop-off failed", "period", p.Key, "error", err)
+		}
+		h.sendText(chatID, "Не удалось посчитать отвал")
+		return
+	}
+	if d.NonLeads > 0 {
+		labels, values := h.funnel.DropOffGraph(d)
+		bars := make([]chart.Value, 0, len(labels))
+		for i := range labels {
+			bars = append(bars, chart.Value{Value: float64(values[i]), Label: labels[i]})
+		}
+		graph := chart.BarChart{Title: "Где остановились без лида", Width: 1100, BarWidth: 56, Bars: bars}
+		caption := "Последний шаг пользователей без лида, " + strings.ToLower(p.Label)
+		if err := h.sendBarChart(chatID, graph, caption, tgbotapi.InlineKeyboardMarkup{}); err != nil && h.logger != nil {
+			h.logger.Error("drop-off chart failed", "period", p.Key, "error", err)
+		}
+	}
+	h.sendText(chatID, h.funnel.DropOffReport(p, d))
 }
 
-func (h *Handler) sendFunnelChart(chatID int64, labels []string, values []int) error {
+func (h *Handler) sendFunnelChart(chatID int64, title string, labels []string, values []int, markup tgbotapi.InlineKeyboardMarkup) error {
 	bars := make([]chart.Value, 0, len(labels))
-	maxVal := 0
 	for i := range labels {
-		v := values[i]
-		if v > maxVal {
-			maxVal = v
+		bars = append(bars, chart.Value{Value: float64(values[i]), Label: labels[i]})
+	}
+	graph := chart.BarChart{Title: title, Width: 1100, BarWidth: 56, Bars: bars}
+	return h.sendBarChart(chatID, graph, "Воронка: "+strings.ToLower(title), markup)
+}
+
+// sendBarChart задаёт общие размеры и шкалу графика и отправляет его картинкой
+func (h *Handler) sendBarChart(chatID int64, graph chart.BarChart, caption string, markup tgbotapi.InlineKeyboardMarkup) error {
+	maxVal := 0.0
+	for _, b := range graph.Bars {
+		if b.Value > maxVal {
+			maxVal = b.Value
 		}
-		bars = append(bars, chart.Value{Value: float64(v), Label: labels[i]})
 	}
 	// Избежать ошибки invalid data range при нулевых значениях
-	yMax := float64(maxVal)
-	if yMax <= 0 {
-		yMax = 1
-	}
-	graph := chart.BarChart{
-		Width:    1100,
-		Height:   600,
-		BarWidth: 56,
-		Background: chart.Style{Padding: chart.Box{
-			Top:    50,
-			Left:   16,
-			Right:  16,
-			Bottom: 0,
-		}},
-		YAxis: chart.YAxis{Range: &chart.ContinuousRange{Min: 0, Max: yMax}},
-		Bars:  bars,
+	if maxVal <= 0 {
+		maxVal = 1
 	}
+	graph.Height = 600
+	graph.Background = chart.Style{Padding: chart.Box{
+		Top:    50,
+		Left:   16,
+		Right:  16,
+		Bottom: 0,
+	}}
+	graph.YAxis = chart.YAxis{Range: &chart.ContinuousRange{Min: 0, Max: maxVal}}
 	buf := bytes.NewBuffer(nil)
 	if err := graph.Render(chart.PNG, buf); err != nil {
 		return err
 	}
+	return h.sendPNG(chatID, buf.Bytes(), caption, markup)
+}
+
+// sendPNG отправляет готовую картинку графика с подписью и необязательными кнопками
+func (h *Handler) sendPNG(chatID int64, png []byte, caption string, markup tgbotapi.InlineKeyboardMarkup) error {
 	fname := "funnel_" + strconv.FormatInt(time.Now().UnixNano(), 10) + ".png"
-	photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileBytes{Name: fname, Bytes: buf.Bytes()})
+	photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileBytes{Name: fname, Bytes: png})
+	photo.Caption = caption
+	if len(markup.InlineKeyboard) > 0 {
+		photo.ReplyMarkup = markup
+	}
 	_, err := h.bot.Send(photo)
 	return err
 }
@@ -0,0 +1,91 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"alliance-management-telegram-bot/internal/infra/memory"
+	"alliance-management-telegram-bot/internal/usecase"
+)
+
+// newTestHandler собирает обработчик со сценарием из репозитория, хранилищами в памяти
+// и ботом, который ходит в поддельный Bot API; sent считает запросы к нему
+func newTestHandler(t *testing.T, workers int) (h *Handler, sessions *memory.SessionStore, sent *atomic.Int64) {
+	t.Helper()
+	sent = new(atomic.Int64)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		// годится и как User для getMe, и как Message для sendMessage
+		fmt.Fprint(w, `{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"bot","username":"bot","message_id":1,"chat":{"id":1}}}`)
+	}))
+	t.Cleanup(srv.Close)
+	bot, err := tgbotapi.NewBotAPIWithClient("test", srv.URL+"/bot%s/%s", srv.Client())
+	if err != nil {
+		t.Fatalf("bot: %v", err)
+	}
+	sc, err := usecase.LoadScenario("../../../scenario.json")
+	if err != nil {
+		t.Fatalf("scenario: %v", err)
+	}
+	sessions = memory.NewSessionStore(time.Hour)
+	h = NewHandler(bot, usecase.NewDialog(sc), sessions, memory.NewUserRepo(), &usecase.BroadcastUsecase{}, nil, nil, nil)
+	h.SetWorkers(workers)
+	h.SetBackgroundJobs(false)
+	return h, sessions, sent
+}
+
+func textUpdate(chatID int64, text string) tgbotapi.Update {
+	return tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: chatID},
+		From: &tgbotapi.User{ID: chatID, FirstName: "Иван"},
+		Text: text,
+	}}
+}
+
+// Апдейты многих чатов вперемешку проходят через Serve: каждый чат должен дойти до
+// одного и того же шага квиза с правильными ответами, а -race — не найти гонок
+func TestHandleUpdateConcurrentChats(t *testing.T) {
+	h, sessions, sent := newTestHandler(t, 4)
+	const chats = 32
+	steps := []string{"/start", "Хочу", "Для жизни", "2 спальни"}
+
+	updates := make(chan tgbotapi.Update)
+	served := make(chan struct{})
+	go func() {
+		h.Serve(context.Background(), updates)
+		close(served)
+	}()
+	for _, text := range steps {
+		for chatID := int64(1); chatID <= chats; chatID++ {
+			updates <- textUpdate(chatID, text)
+		}
+	}
+	close(updates)
+	<-served
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := h.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	for chatID := int64(1); chatID <= chats; chatID++ {
+		s, err := sessions.GetSession(chatID)
+		if err != nil || s == nil {
+			t.Fatalf("chat %d: session %v, err %v", chatID, s, err)
+		}
+		if s.State != usecase.StatePayment || s.Purpose != "Для жизни" || s.Bedrooms != "2 спальни" {
+			t.Errorf("chat %d: got state %q purpose %q bedrooms %q", chatID, s.State, s.Purpose, s.Bedrooms)
+		}
+	}
+	if sent.Load() <= chats*int64(len(steps)) {
+		t.Errorf("expected replies for every update, got %d requests", sent.Load())
+	}
+}
@@ -0,0 +1,87 @@
+package telegram
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"alliance-management-telegram-bot/internal/usecase"
+)
+
+func leadExportKeyboard() tgbotapi.InlineKeyboardMarkup {
+	btn := func(label, key string) tgbotapi.InlineKeyboardButton {
+		return tgbotapi.NewInlineKeyboardButtonData(label, leadExportPrefix+key)
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(btn("7 дней", usecase.FunnelWeek), btn("30 дней", usecase.FunnelMonth), btn("Всё время", usecase.FunnelAll)),
+		tgbotapi.NewInlineKeyboardRow(btn("Свой период", funnelCustom)),
+	)
+}
+
+// handleLeadExport обрабатывает кнопки и команду /export_leads; false — апдейт к выгрузке не относится
+func (h *Handler) handleLeadExport(chatID int64, text string) bool {
+	var key string
+	switch {
+	case text == "Выгрузка лидов", text == "/export_leads":
+		msg := tgbotapi.NewMessage(chatID, "Выгрузка лидов: выберите период")
+		msg.ReplyMarkup = leadExportKeyboard()
+		_, _ = h.bot.Send(msg)
+		return true
+	case text == leadExportPrefix+funnelCustom:
+		h.sendText(chatID, "Пришлите период командой: /export_leads 01.09.2025-30.09.2025")
+		return true
+	case strings.HasPrefix(text, leadExportPrefix):
+		key = strings.TrimPrefix(text, leadExportPrefix)
+	case strings.HasPrefix(text, "/export_leads "):
+		key = strings.TrimSpace(strings.TrimPrefix(text, "/export_leads "))
+	default:
+		return false
+	}
+	h.sendLeadExport(chatID, key)
+	return true
+}
+
+// sendLeadExport присылает лиды за период двумя документами: CSV и XLSX
+func (h *Handler) sendLeadExport(chatID int64, key string) {
+	now := time.Now()
+	p, ok := h.leadExport.Period(key, now)
+	if !ok {
+		h.sendText(chatID, "Не понял период. Пример: /export_leads 01.09.2025-30.09.2025")
+		return
+	}
+	csvData, xlsxData, n, err := h.leadExport.Export(p)
+	if err != nil {
+		if h.logger != nil {
+			h.logger.Error("lead export failed", "chat_id", chatID, "period", p.Key, "error", err)
+		}
+		h.sendText(chatID, "Не удалось выгрузить лиды")
+		return
+	}
+	if n == 0 {
+		h.sendText(chatID, p.Label+": лидов нет")
+		return
+	}
+	name := "leads_" + p.Key
+	if key == usecase.FunnelWeek || key == usecase.FunnelMonth || key == usecase.FunnelAll {
+		name += "_" + p.To.AddDate(0, 0, -1).Format("2006-01-02")
+	}
+	docs := []tgbotapi.DocumentConfig{
+		tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: name + ".xlsx", Bytes: xlsxData}),
+		tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: name + ".csv", Bytes: csvData}),
+	}
+	docs[0].Caption = fmt.Sprintf("Лиды, %s: %d", strings.ToLower(p.Label), n)
+	for _, doc := range docs {
+		if _, err := h.bot.Send(doc); err != nil {
+			if h.logger != nil {
+				h.logger.Error("lead export send failed", "chat_id", chatID, "period", p.Key, "error", err)
+			}
+			h.sendText(chatID, "Не удалось отправить выгрузку")
+			return
+		}
+	}
+	if h.logger != nil {
+		h.logger.Info("leads exported", "chat_id", chatID, "period", p.Key, "leads", n)
+	}
+}
@@ -0,0 +1,101 @@
+package telegram
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"alliance-management-telegram-bot/internal/domain"
+)
+
+// leadCardKeyboard — кнопки смены статуса под карточкой лида
+func leadCardKeyboard(leadID int64) tgbotapi.InlineKeyboardMarkup {
+	btn := func(label string, status domain.LeadStatus) tgbotapi.InlineKeyboardButton {
+		return tgbotapi.NewInlineKeyboardButtonData(label, leadStatusPrefix+strconv.FormatInt(leadID, 10)+":"+string(status))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		btn("Взять в работу", domain.LeadInWork),
+		btn("Не дозвонился", domain.LeadNoAnswer),
+		btn("Закрыт", domain.LeadClosed),
+	))
+}
+
+// handleLeadDesk обрабатывает команды и кнопки менеджеров; false — апдейт к лидам не относится
+func (h *Handler) handleLeadDesk(chatID int64, update tgbotapi.Update, text string) bool {
+	switch {
+	case text == "Лиды", update.Message != nil && update.Message.IsCommand() && update.Message.Command() == "leads":
+		var args string
+		if update.Message != nil {
+			args = update.Message.CommandArguments()
+		}
+		report, ids := h.leadDesk.List(args, time.Now())
+		msg := tgbotapi.NewMessage(chatID, report)
+		if len(ids) > 0 {
+			msg.ReplyMarkup = idKeyboard(leadOpenPrefix, "Лид #%d", ids)
+		}
+		_, _ = h.bot.Send(msg)
+		return true
+	case strings.HasPrefix(text, leadOpenPrefix):
+		id, err := strconv.ParseInt(strings.TrimPrefix(text, leadOpenPrefix), 10, 64)
+		if err != nil {
+			return true
+		}
+		card, err := h.leadDesk.Details(id)
+		if err != nil {
+			if h.logger != nil {
+				h.logger.Error("lead details failed", "chat_id", chatID, "lead_id", id, "error", err)
+			}
+			h.sendText(chatID, "Лид не найден")
+			return true
+		}
+		msg := tgbotapi.NewMessage(chatID, card)
+		msg.ReplyMarkup = leadCardKeyboard(id)
+		_, _ = h.bot.Send(msg)
+		return true
+	case strings.HasPrefix(text, leadStatusPrefix) && update.CallbackQuery != nil:
+		h.changeLeadStatus(chatID, update.CallbackQuery, strings.TrimPrefix(text, leadStatusPrefix))
+		return true
+	}
+	return false
+}
+
+// changeLeadStatus меняет статус по кнопке карточки и обновляет саму карточку
+func (h *Handler) changeLeadStatus(chatID int64, cq *tgbotapi.CallbackQuery, data string) {
+	idPart, status, _ := strings.Cut(data, ":")
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil || cq.From == nil {
+		return
+	}
+	card, notice, err := h.leadDesk.SetStatus(id, domain.LeadStatus(status), cq.From.ID, managerName(cq.From))
+	if h.logger != nil {
+		if err != nil {
+			h.logger.Error("lead status change failed", "chat_id", chatID, "lead_id", id, "status", status, "error", err)
+		} else if card != "" {
+			h.logger.Info("lead status changed", "chat_id", chatID, "lead_id", id, "status", status, "manager_id", cq.From.ID)
+		}
+	}
+	_, _ = h.bot.Request(tgbotapi.NewCallback(cq.ID, notice))
+	if card == "" {
+		return
+	}
+	edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, cq.Message.MessageID, card, leadCardKeyboard(id))
+	if _, err := h.bot.Request(edit); err != nil && h.logger != nil {
+		h.logger.Error("lead card update failed", "chat_id", chatID, "lead_id", id, "error", err)
+	}
+}
+
+func managerName(u *tgbotapi.User) string {
+	name := strings.TrimSpace(u.FirstName + " " + u.LastName)
+	if u.UserName != "" {
+		if name == "" {
+			return "@" + u.UserName
+		}
+		name += " (@" + u.UserName + ")"
+	}
+	if name == "" {
+		return strconv.FormatInt(u.ID, 10)
+	}
+	return name
+}
@@ -0,0 +1,147 @@
+package telegram
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"alliance-management-telegram-bot/internal/domain"
+	"alliance-management-telegram-bot/internal/usecase"
+)
+
+// Реализация отправителя для юзкейсов
+type Sender struct{ bot *tgbotapi.BotAPI }
+
+func NewSender(bot *tgbotapi.BotAPI) *Sender { return &Sender{bot: bot} }
+
+func (s *Sender) SendText(chatID int64, text string) error {
+	msg := tgbotapi.NewMessage(chatID, text)
+	_, err := s.bot.Send(msg)
+	return err
+}
+
+func (s *Sender) SendPhoto(chatID int64, fileID string, caption string) error {
+	photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileID(fileID))
+	photo.Caption = caption
+	_, err := s.bot.Send(photo)
+	return err
+}
+
+// SendBroadcast отправляет пост; для альбома возвращает ID всех его сообщений в порядке альбома
+func (s *Sender) SendBroadcast(chatID int64, c usecase.BroadcastContent) ([]int, error) {
+	c = c.Normalized()
+	if len(c.Media) > 1 {
+		sent, err := s.bot.SendMediaGroup(mediaGroup(chatID, c))
+		if err != nil {
+			return nil, wrapAPIError(err)
+		}
+		ids := make([]int, 0, len(sent))
+		for _, m := range sent {
+			ids = append(ids, m.MessageID)
+		}
+		return ids, nil
+	}
+	sent, err := s.bot.Send(singleMessage(chatID, c))
+	if err != nil {
+		return nil, wrapAPIError(err)
+	}
+	return []int{sent.MessageID}, nil
+}
+
+// AskApproval присылает админу запрос на одобрение рассылки с кнопками решения
+func (s *Sender) AskApproval(chatID, approvalID int64, text string) error {
+	id := strconv.FormatInt(approvalID, 10)
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("Одобрить #"+id, approvePrefix+id),
+		tgbotapi.NewInlineKeyboardButtonData("Отклонить #"+id, rejectPrefix+id),
+	))
+	_, err := s.bot.Send(msg)
+	return err
+}
+
+// SendLeadCard присылает карточку лида с кнопками смены статуса
+func (s *Sender) SendLeadCard(chatID int64, leadID int64, text string) (int, error) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = leadCardKeyboard(leadID)
+	sent, err := s.bot.Send(msg)
+	if err != nil {
+		return 0, err
+	}
+	return sent.MessageID, nil
+}
+
+// EditLeadCard заменяет текст карточки, сохраняя кнопки; повтор с тем же текстом не ошибка
+func (s *Sender) EditLeadCard(chatID int64, messageID int, leadID int64, text string) error {
+	_, err := s.bot.Request(tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, text, leadCardKeyboard(leadID)))
+	if isAPIError(err, "message is not modified") {
+		return nil
+	}
+	return err
+}
+
+// EditBroadcast заменяет текст или подпись отправленного поста; повтор с тем же текстом не ошибка
+func (s *Sender) EditBroadcast(chatID int64, messageID int, c usecase.BroadcastContent) error {
+	_, err := s.bot.Request(editMessage(chatID, messageID, c.Normalized()))
+	if isAPIError(err, "message is not modified") {
+		return nil
+	}
+	return wrapAPIError(err)
+}
+
+// DeleteMessage удаляет сообщение; уже удалённое пользователем считается успехом
+func (s *Sender) DeleteMessage(chatID int64, messageID int) error {
+	_, err := s.bot.Request(tgbotapi.NewDeleteMessage(chatID, messageID))
+	if isAPIError(err, "message to delete not found") {
+		return nil
+	}
+	return wrapAPIError(err)
+}
+
+func (s *Sender) PostStatus(chatID int64, text string) (int, error) {
+	sent, err := s.bot.Send(tgbotapi.NewMessage(chatID, text))
+	if err != nil {
+		return 0, wrapAPIError(err)
+	}
+	return sent.MessageID, nil
+}
+
+func (s *Sender) EditStatus(chatID int64, messageID int, text string) error {
+	_, err := s.bot.Request(tgbotapi.NewEditMessageText(chatID, messageID, text))
+	return wrapAPIError(err)
+}
+
+// wrapAPIError превращает ответ 429 в usecase.RetryAfterError, 403 от заблокировавшего бота
+// или удалённого пользователя — в usecase.UnreachableError, прочие ответы Telegram —
+// в usecase.DeliveryError с классом; ошибки без ответа (сеть) возвращает как есть
+func wrapAPIError(err error) error {
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	if apiErr.RetryAfter > 0 {
+		return &usecase.RetryAfterError{After: time.Duration(apiErr.RetryAfter) * time.Second}
+	}
+	switch {
+	case apiErr.Code == http.StatusForbidden && (strings.Contains(apiErr.Message, "bot was blocked") || strings.Contains(apiErr.Message, "bot was kicked")):
+		return &usecase.UnreachableError{Reason: domain.InactiveBlocked, Err: err}
+	case apiErr.Code == http.StatusForbidden && strings.Contains(apiErr.Message, "user is deactivated"):
+		return &usecase.UnreachableError{Reason: domain.InactiveDeactivated, Err: err}
+	case apiErr.Code == http.StatusForbidden:
+		return &usecase.DeliveryError{Class: usecase.ErrClassForbidden, Err: err}
+	case apiErr.Code == http.StatusBadRequest && strings.Contains(apiErr.Message, "chat not found"):
+		return &usecase.DeliveryError{Class: usecase.ErrClassChatNotFound, Err: err}
+	case apiErr.Code == http.StatusBadRequest:
+		return &usecase.DeliveryError{Class: usecase.ErrClassBadRequest, Err: err}
+	}
+	return &usecase.DeliveryError{Class: usecase.ErrClassOther, Err: err}
+}
+
+func isAPIError(err error, text string) bool {
+	var apiErr *tgbotapi.Error
+	return errors.As(err, &apiErr) && strings.Contains(apiErr.Message, text)
+}
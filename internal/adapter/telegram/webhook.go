@@ -0,0 +1,80 @@
+package telegram
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// Webhook принимает апдейты от Telegram по HTTP и отдаёт их в канал для Handler.Serve
+type Webhook struct {
+	bot     *tgbotapi.BotAPI
+	secret  string
+	updates chan tgbotapi.Update
+	closed  chan struct{}
+	once    sync.Once
+	logger  *slog.Logger
+}
+
+func NewWebhook(bot *tgbotapi.BotAPI, secret string, logger *slog.Logger) *Webhook {
+	return &Webhook{
+		bot:     bot,
+		secret:  secret,
+		updates: make(chan tgbotapi.Update, bot.Buffer),
+		closed:  make(chan struct{}),
+		logger:  logger,
+	}
+}
+
+// Register регистрирует вебхук в Telegram вместе с секретом для заголовка проверки.
+// В tgbotapi v5.5.1 нет поля secret_token, поэтому запрос собирается вручную.
+func (w *Webhook) Register(publicURL string) error {
+	params := tgbotapi.Params{}
+	params["url"] = publicURL
+	params.AddNonEmpty("secret_token", w.secret)
+	_, err := w.bot.MakeRequest("setWebhook", params)
+	return err
+}
+
+func (w *Webhook) Updates() <-chan tgbotapi.Update { return w.updates }
+
+// Close перестаёт принимать апдейты: новые запросы получают 503 и будут повторены Telegram
+func (w *Webhook) Close() { w.once.Do(func() { close(w.closed) }) }
+
+func (w *Webhook) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	select {
+	case <-w.closed:
+		http.Error(rw, "shutting down", http.StatusServiceUnavailable)
+		return
+	default:
+	}
+	if w.secret != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get(secretTokenHeader)), []byte(w.secret)) != 1 {
+		if w.logger != nil {
+			w.logger.Warn("webhook secret mismatch", "remote_addr", r.RemoteAddr)
+		}
+		http.Error(rw, "forbidden", http.StatusForbidden)
+		return
+	}
+	update, err := w.bot.HandleUpdate(r)
+	if err != nil {
+		if w.logger != nil {
+			w.logger.Warn("webhook bad update", "error", err)
+		}
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// блокируемся при переполнении — Telegram повторит доставку, если не дождётся ответа
+	select {
+	case w.updates <- *update:
+		rw.WriteHeader(http.StatusOK)
+	case <-w.closed:
+		http.Error(rw, "shutting down", http.StatusServiceUnavailable)
+	case <-r.Context().Done():
+		http.Error(rw, "timeout", http.StatusServiceUnavailable)
+	}
+}
@@ -2,15 +2,48 @@ package domain
 
 import "time"
 
+// LeadStatus — этап обработки лида менеджером
+type LeadStatus string
+
+const (
+	LeadNew      LeadStatus = "new"
+	LeadInWork   LeadStatus = "in_work"
+	LeadNoAnswer LeadStatus = "no_answer"
+	LeadClosed   LeadStatus = "closed"
+)
+
 type Lead struct {
+	ID        int64
 	ChatID    int64
 	Purpose   string
 	Bedrooms  string
 	Payment   string
 	Phone     string
 	CreatedAt time.Time
+	// Profile — профиль Telegram на момент заявки
+	Profile
+	// ClientName и CallTime — необязательные ответы после номера: как обращаться и когда звонить
+	ClientName string
+	CallTime   string
+	Status     LeadStatus
+	// AssigneeID — менеджер, последним менявший статус; 0 — лид ещё никто не взял
+	AssigneeID   int64
+	AssigneeName string
+	UpdatedAt    time.Time
+}
+
+// Name — как обращаться к клиенту: названное им самим имя, иначе имя из Telegram
+func (l Lead) Name() string {
+	if l.ClientName != "" {
+		return l.ClientName
+	}
+	return l.Profile.Name()
 }
 
 type LeadRepository interface {
-	SaveLead(lead Lead) error
+	// SaveLead сохраняет лид со статусом LeadNew и возвращает его ID. Повторная заявка с тем же
+	// номером или из того же чата может обновить существующий лид — тогда merged = true.
+	SaveLead(lead Lead) (id int64, merged bool, err error)
+	// SaveLeadDetails дописывает ответы на необязательные вопросы после номера
+	SaveLeadDetails(id int64, clientName, callTime string) error
 }
@@ -0,0 +1,32 @@
+package domain
+
+import "strings"
+
+// NormalizePhone приводит номер к E.164. Российские номера принимаются как +7XXXXXXXXXX,
+// 8XXXXXXXXXX, 7XXXXXXXXXX или 10 цифр без кода страны; прочие — с кодом страны,
+// как их присылает Telegram в контакте. Пробелы, скобки и дефисы игнорируются.
+func NormalizePhone(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	plus := strings.HasPrefix(s, "+")
+	digits := make([]byte, 0, 15)
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits = append(digits, byte(r))
+		case r == '+' || r == ' ' || r == '-' || r == '(' || r == ')':
+		default:
+			return "", false
+		}
+	}
+	switch {
+	case len(digits) == 10 && !plus:
+		return "+7" + string(digits), true
+	case len(digits) == 11 && (digits[0] == '7' || digits[0] == '8') && !plus:
+		return "+7" + string(digits[1:]), true
+	case len(digits) == 11 && digits[0] == '7':
+		return "+" + string(digits), true
+	case len(digits) >= 11 && len(digits) <= 15 && digits[0] != '0' && (plus || digits[0] != '8'):
+		return "+" + string(digits), true
+	}
+	return "", false
+}
@@ -0,0 +1,45 @@
+package domain
+
+import "testing"
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		// российские номера в разных записях сводятся к одному ключу
+		{"+79271234567", "+79271234567", true},
+		{"79271234567", "+79271234567", true},
+		{"89271234567", "+79271234567", true},
+		{"9271234567", "+79271234567", true},
+		{"+7 (927) 123-45-67", "+79271234567", true},
+		{"8 (927) 123 45 67", "+79271234567", true},
+		{"  +7 927 123 45 67  ", "+79271234567", true},
+		// иностранные номера — только с кодом страны
+		{"+380501234567", "+380501234567", true},
+		{"380501234567", "+380501234567", true},
+		{"+1 (415) 555-2671", "+14155552671", true},
+		{"+49 30 123456789", "+4930123456789", true},
+		// 8 в начале без плюса — российский префикс, а не код страны
+		{"812345678901", "", false},
+		{"+812345678901", "+812345678901", true},
+		// слишком короткие и длинные
+		{"", "", false},
+		{"12345", "", false},
+		{"927123456", "", false},
+		{"+1234567890123456", "", false},
+		// код страны не начинается с нуля
+		{"+01234567890", "", false},
+		// посторонние символы
+		{"+7 927 123-45-67 доб. 1", "", false},
+		{"+7.927.123.45.67", "", false},
+		{"телефон", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := NormalizePhone(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("NormalizePhone(%q) = %q, %v; want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -1,12 +1,61 @@
 package domain
 
+import (
+	"strings"
+	"time"
+)
+
+// Причины, по которым пользователь перестал получать сообщения бота
+const (
+	InactiveBlocked     = "blocked"
+	InactiveDeactivated = "deactivated"
+)
+
+// Profile — данные пользователя из Telegram; обновляются при каждом апдейте
+type Profile struct {
+	Username     string
+	FirstName    string
+	LastName     string
+	LanguageCode string
+	// ContactName — имя из отправленного контакта; пустое значение не затирает сохранённое
+	ContactName string
+}
+
+// Name — как обращаться к пользователю: имя из контакта, имя и фамилия из профиля или @username
+func (p Profile) Name() string {
+	if p.ContactName != "" {
+		return p.ContactName
+	}
+	if name := strings.TrimSpace(p.FirstName + " " + p.LastName); name != "" {
+		return name
+	}
+	if p.Username != "" {
+		return "@" + p.Username
+	}
+	return ""
+}
+
 type User struct {
 	ChatID int64
+	Profile
+	// последние ответы квиза — нужны для сегментации рассылок
+	Purpose  string
+	Bedrooms string
+	Payment  string
+	// InactiveReason не пуст, если пользователь заблокировал бота или удалил аккаунт
+	InactiveReason string
+	InactiveAt     time.Time
 }
 
 type UserRepository interface {
 	SaveUser(chatID int64) error
+	SaveAnswers(chatID int64, purpose, bedrooms, payment string) error
+	SaveProfile(chatID int64, p Profile) error
+	// ListChatIDs возвращает только активных пользователей
 	ListChatIDs() ([]int64, error)
+	// Deactivate исключает пользователя из рассылок, Reactivate возвращает обратно
+	Deactivate(chatID int64, reason string) error
+	Reactivate(chatID int64) error
 }
 
 // Abstraction for sending messages (implemented by Telegram adapter)
@@ -19,11 +19,15 @@ import (
 // Client отправляет лиды в MacroCRM (SberCRM)
 type Client struct {
 	// Базовый хост API, по умолчанию https://api.macro.sbercrm.com
-	BaseURL    string
-	Domain     string
-	AppSecret  string
-	Action     string
-	HTTPClient *http.Client
+	BaseURL   string
+	Domain    string
+	AppSecret string
+	Action    string
+	// UpdateAction — действие для обновления уже отправленной заявки. API заявок не принимает
+	// ID созданной заявки, поэтому без него повторная заявка уходит новой заявкой с Action
+	// и прямо помечается как повторная, чтобы менеджер связал её с первой
+	UpdateAction string
+	HTTPClient   *http.Client
 }
 
 func NewClient(domain, appSecret string, opts ...func(*Client)) *Client {
@@ -56,10 +60,35 @@ func WithAction(action string) func(*Client) {
 	}
 }
 
+func WithUpdateAction(action string) func(*Client) {
+	return func(c *Client) {
+		if strings.TrimSpace(action) != "" {
+			c.UpdateAction = action
+		}
+	}
+}
+
 // SendLead формирует запрос на создание заявки в MacroCRM.
 // Отправляет минимум телефон и текстовое описание, остальное — как есть из структуры лида.
 // Реализация интерфейса usecase.LeadDelivery
 func (c *Client) SendLead(ctx context.Context, lead domain.Lead) error {
+	return c.post(ctx, lead, c.Action, "Заявка из Telegram")
+}
+
+// UpdateLead отправляет обновлённые ответы действием UpdateAction, а без него — новой заявкой
+// с пометкой, что клиент обратился повторно
+func (c *Client) UpdateLead(ctx context.Context, lead domain.Lead) error {
+	if c == nil {
+		return errors.New("macrocrm client is nil")
+	}
+	if strings.TrimSpace(c.UpdateAction) != "" {
+		return c.post(ctx, lead, c.UpdateAction, fmt.Sprintf("Обновление заявки из Telegram (лид #%d)", lead.ID))
+	}
+	return c.post(ctx, lead, c.Action,
+		fmt.Sprintf("Повторная заявка из Telegram (лид #%d): клиент обратился ещё раз, это не новый клиент, ответы ниже обновлены", lead.ID))
+}
+
+func (c *Client) post(ctx context.Context, lead domain.Lead, action, title string) error {
 	if c == nil {
 		return errors.New("macrocrm client is nil")
 	}
@@ -78,14 +107,24 @@ func (c *Client) SendLead(ctx context.Context, lead domain.Lead) error {
 	form.Set("domain", c.Domain)
 	form.Set("time", tsStr)
 	form.Set("token", token)
-	form.Set("action", c.Action)
+	form.Set("action", action)
 
 	// Полезные поля заявки
 	form.Set("phone", lead.Phone)
-	// Имя можем не знать; оставим пустым или возьмем из Purpose, если это имя — но пока пусто
-	form.Set("name", "Тест")
+	// имя, которое назвал клиент, иначе из контакта или профиля Telegram
+	name := lead.Name()
+	if name == "" {
+		name = "Клиент из Telegram"
+	}
+	form.Set("name", name)
 	// Сформируем читабельное сообщение без указания chat_id
-	msg := fmt.Sprintf("Заявка из Telegram\nЦель: %s\nСпальни: %s\nОплата: %s", lead.Purpose, lead.Bedrooms, lead.Payment)
+	msg := fmt.Sprintf("%s\nЦель: %s\nСпальни: %s\nОплата: %s", title, lead.Purpose, lead.Bedrooms, lead.Payment)
+	if lead.CallTime != "" {
+		msg += "\nУдобное время звонка: " + lead.CallTime
+	}
+	if lead.Username != "" {
+		msg += "\nTelegram: @" + lead.Username
+	}
 	form.Set("message", msg)
 
 	endpoint := strings.TrimRight(c.BaseURL, "/") + "/estate/request/"
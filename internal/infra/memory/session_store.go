@@ -0,0 +1,91 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"alliance-management-telegram-bot/internal/usecase"
+)
+
+type sessionEntry struct {
+	session   *usecase.Session
+	updatedAt time.Time
+}
+
+type broadcastEntry struct {
+	session   *usecase.BroadcastSession
+	updatedAt time.Time
+}
+
+// SessionStore хранит сессии в памяти процесса; ttl <= 0 отключает устаревание
+type SessionStore struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	sessions  map[int64]sessionEntry
+	broadcast map[int64]broadcastEntry
+}
+
+func NewSessionStore(ttl time.Duration) *SessionStore {
+	return &SessionStore{
+		ttl:       ttl,
+		sessions:  make(map[int64]sessionEntry),
+		broadcast: make(map[int64]broadcastEntry),
+	}
+}
+
+func (r *SessionStore) GetSession(chatID int64) (*usecase.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.sessions[chatID]
+	if !ok || r.expired(e.updatedAt) {
+		return nil, nil
+	}
+	return e.session, nil
+}
+
+func (r *SessionStore) SaveSession(chatID int64, s *usecase.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sessions[chatID] = sessionEntry{session: s, updatedAt: time.Now()}
+	return nil
+}
+
+func (r *SessionStore) GetBroadcastSession(chatID int64) (*usecase.BroadcastSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.broadcast[chatID]
+	if !ok || r.expired(e.updatedAt) {
+		return nil, nil
+	}
+	return e.session, nil
+}
+
+func (r *SessionStore) SaveBroadcastSession(chatID int64, s *usecase.BroadcastSession) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.broadcast[chatID] = broadcastEntry{session: s, updatedAt: time.Now()}
+	return nil
+}
+
+func (r *SessionStore) PurgeExpired() (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for id, e := range r.sessions {
+		if r.expired(e.updatedAt) {
+			delete(r.sessions, id)
+			n++
+		}
+	}
+	for id, e := range r.broadcast {
+		if r.expired(e.updatedAt) {
+			delete(r.broadcast, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *SessionStore) expired(t time.Time) bool {
+	return r.ttl > 0 && time.Since(t) > r.ttl
+}
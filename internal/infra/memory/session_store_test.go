@@ -0,0 +1,65 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"alliance-management-telegram-bot/internal/usecase"
+)
+
+func TestSessionStoreSaveAndGet(t *testing.T) {
+	r := NewSessionStore(time.Hour)
+	if s, err := r.GetSession(1); s != nil || err != nil {
+		t.Fatalf("empty store: got %+v, %v", s, err)
+	}
+	_ = r.SaveSession(1, &usecase.Session{State: usecase.StatePurpose, Purpose: "Для жизни"})
+	_ = r.SaveBroadcastSession(1, &usecase.BroadcastSession{State: usecase.BStateSchedule})
+
+	s, err := r.GetSession(1)
+	if err != nil || s == nil || s.State != usecase.StatePurpose || s.Purpose != "Для жизни" {
+		t.Fatalf("session: got %+v, %v", s, err)
+	}
+	b, err := r.GetBroadcastSession(1)
+	if err != nil || b == nil || b.State != usecase.BStateSchedule {
+		t.Fatalf("broadcast session: got %+v, %v", b, err)
+	}
+	if s, _ := r.GetSession(2); s != nil {
+		t.Fatalf("session of another chat: %+v", s)
+	}
+}
+
+func TestSessionStoreExpiresAndPurges(t *testing.T) {
+	r := NewSessionStore(time.Minute)
+	_ = r.SaveSession(1, &usecase.Session{State: usecase.StatePurpose})
+	_ = r.SaveSession(2, &usecase.Session{State: usecase.StatePurpose})
+	_ = r.SaveBroadcastSession(1, &usecase.BroadcastSession{State: usecase.BStateSchedule})
+	// состарим записи первого чата в обход часов
+	r.sessions[1] = sessionEntry{session: r.sessions[1].session, updatedAt: time.Now().Add(-2 * time.Minute)}
+	r.broadcast[1] = broadcastEntry{session: r.broadcast[1].session, updatedAt: time.Now().Add(-2 * time.Minute)}
+
+	if s, _ := r.GetSession(1); s != nil {
+		t.Fatalf("expired session returned: %+v", s)
+	}
+	if b, _ := r.GetBroadcastSession(1); b != nil {
+		t.Fatalf("expired broadcast session returned: %+v", b)
+	}
+	n, err := r.PurgeExpired()
+	if err != nil || n != 2 {
+		t.Fatalf("purge: got %d, %v; want 2", n, err)
+	}
+	if s, _ := r.GetSession(2); s == nil {
+		t.Fatal("fresh session purged")
+	}
+}
+
+func TestSessionStoreWithoutTTL(t *testing.T) {
+	r := NewSessionStore(0)
+	_ = r.SaveSession(1, &usecase.Session{State: usecase.StatePurpose})
+	r.sessions[1] = sessionEntry{session: r.sessions[1].session, updatedAt: time.Now().Add(-365 * 24 * time.Hour)}
+	if s, _ := r.GetSession(1); s == nil {
+		t.Fatal("session expired with ttl disabled")
+	}
+	if n, _ := r.PurgeExpired(); n != 0 {
+		t.Fatalf("purged %d sessions with ttl disabled", n)
+	}
+}
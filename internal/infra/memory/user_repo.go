@@ -1,29 +1,79 @@
 package memory
 
-import "sync"
+import (
+	"sync"
+	"time"
+
+	"alliance-management-telegram-bot/internal/domain"
+)
 
 type UserRepo struct {
-	mu     sync.RWMutex
-	chatID map[int64]struct{}
+	mu    sync.RWMutex
+	users map[int64]domain.User
 }
 
 func NewUserRepo() *UserRepo {
-	return &UserRepo{chatID: make(map[int64]struct{})}
+	return &UserRepo{users: make(map[int64]domain.User)}
 }
 
 func (r *UserRepo) SaveUser(chatID int64) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	r.chatID[chatID] = struct{}{}
+	if _, ok := r.users[chatID]; !ok {
+		r.users[chatID] = domain.User{ChatID: chatID}
+	}
+	return nil
+}
+
+func (r *UserRepo) SaveAnswers(chatID int64, purpose, bedrooms, payment string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u := r.users[chatID]
+	u.ChatID, u.Purpose, u.Bedrooms, u.Payment = chatID, purpose, bedrooms, payment
+	r.users[chatID] = u
+	return nil
+}
+
+func (r *UserRepo) SaveProfile(chatID int64, p domain.Profile) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u := r.users[chatID]
+	if p.ContactName == "" {
+		p.ContactName = u.ContactName
+	}
+	u.ChatID, u.Profile = chatID, p
+	r.users[chatID] = u
+	return nil
+}
+
+func (r *UserRepo) Deactivate(chatID int64, reason string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if u, ok := r.users[chatID]; ok && u.InactiveReason == "" {
+		u.InactiveReason, u.InactiveAt = reason, time.Now()
+		r.users[chatID] = u
+	}
+	return nil
+}
+
+func (r *UserRepo) Reactivate(chatID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if u, ok := r.users[chatID]; ok {
+		u.InactiveReason, u.InactiveAt = "", time.Time{}
+		r.users[chatID] = u
+	}
 	return nil
 }
 
 func (r *UserRepo) ListChatIDs() ([]int64, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	res := make([]int64, 0, len(r.chatID))
-	for id := range r.chatID {
-		res = append(res, id)
+	res := make([]int64, 0, len(r.users))
+	for id, u := range r.users {
+		if u.InactiveReason == "" {
+			res = append(res, id)
+		}
 	}
 	return res, nil
 }
@@ -0,0 +1,117 @@
+package sqlite
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"alliance-management-telegram-bot/internal/usecase"
+)
+
+// ActivityRepo считает новых пользователей, старты квиза и лиды по дням.
+// Таблицы создают UserRepo, FunnelRepo и LeadRepo — репозиторий только читает их.
+type ActivityRepo struct {
+	db         *sql.DB
+	quizStarts usecase.State
+}
+
+// WithQuizStart задаёт шаг, заход на который считается стартом квиза (по умолчанию — вопрос о цели)
+func WithQuizStart(state usecase.State) func(*ActivityRepo) {
+	return func(r *ActivityRepo) { r.quizStarts = state }
+}
+
+func NewActivityRepo(dsn string, opts ...func(*ActivityRepo)) (*ActivityRepo, error) {
+	db, err := openDB(dsn)
+	if err != nil {
+		return nil, err
+	}
+	r := &ActivityRepo{db: db, quizStarts: usecase.StatePurpose}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r, nil
+}
+
+// DailyActivity раскладывает события [from, to) по дням в часовом поясе from.
+// Стартом квиза считается заход на первый вопрос: приветствие видит каждый, кто нажал /start.
+// Пользователь учитывается раз в день.
+func (r *ActivityRepo) DailyActivity(from, to time.Time) ([]usecase.DailyActivity, error) {
+	loc := from.Location()
+	byDay := map[time.Time]*usecase.DailyActivity{}
+	day := func(t time.Time) *usecase.DailyActivity {
+		t = t.In(loc)
+		d := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		if byDay[d] == nil {
+			byDay[d] = &usecase.DailyActivity{Day: d}
+		}
+		return byDay[d]
+	}
+	users, err := r.timestamps(`SELECT created_ts FROM users WHERE created_ts >= ? AND created_ts < ?`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	for _, ts := range users {
+		day(time.Unix(ts, 0)).NewUsers++
+	}
+	leads, err := r.timestamps(`SELECT created_ts FROM leads WHERE created_ts >= ? AND created_ts < ?`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	for _, ts := range leads {
+		day(time.Unix(ts, 0)).Leads++
+	}
+
+	rows, err := r.db.Query(`SELECT chat_id, created_ts FROM funnel_hits WHERE state = ? AND created_ts >= ? AND created_ts < ?`,
+		string(r.quizStarts), from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	type starter struct {
+		day    time.Time
+		chatID int64
+	}
+	seen := map[starter]bool{}
+	for rows.Next() {
+		var chatID, ts int64
+		if err := rows.Scan(&chatID, &ts); err != nil {
+			return nil, err
+		}
+		d := day(time.Unix(ts, 0))
+		if k := (starter{d.Day, chatID}); !seen[k] {
+			seen[k] = true
+			d.QuizStarts++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]usecase.DailyActivity, 0, len(byDay))
+	for _, d := range byDay {
+		out = append(out, *d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Day.Before(out[j].Day) })
+	return out, nil
+}
+
+func (r *ActivityRepo) timestamps(query string, from, to time.Time) ([]int64, error) {
+	rows, err := r.db.Query(query, from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []int64
+	for rows.Next() {
+		var ts int64
+		if err := rows.Scan(&ts); err != nil {
+			return nil, err
+		}
+		out = append(out, ts)
+	}
+	return out, rows.Err()
+}
+
+func (r *ActivityRepo) Close() error { return r.db.Close() }
@@ -0,0 +1,152 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"alliance-management-telegram-bot/internal/usecase"
+)
+
+// A/B-тесты ссылаются на задания рассылок своих вариантов; время — в unix-секундах,
+// чтобы выбирать тесты с наступившим winner_at сравнением в SQL
+func migrateBroadcastABTests(db *sql.DB) error {
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS broadcast_ab_tests (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    admin_chat_id INTEGER NOT NULL,
+    segment TEXT NOT NULL,
+    variants TEXT NOT NULL,
+    holdout_job_id INTEGER NOT NULL DEFAULT 0,
+    holdout_percent INTEGER NOT NULL DEFAULT 0,
+    winner_at INTEGER NOT NULL DEFAULT 0,
+    winner_job_id INTEGER NOT NULL DEFAULT 0,
+    status TEXT NOT NULL,
+    created_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_broadcast_ab_tests_due ON broadcast_ab_tests(status, winner_at);
+`)
+	return err
+}
+
+func (r *BroadcastJobRepo) CreateABTest(t *usecase.ABTest, jobs []*usecase.BroadcastJob, recipients [][]int64) error {
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Now()
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	ids := make([]int64, len(jobs))
+	for i, job := range jobs {
+		if ids[i], err = createJob(tx, job, recipients[i]); err != nil {
+			return err
+		}
+	}
+	variants := make([]usecase.ABVariant, len(t.Variants))
+	copy(variants, t.Variants)
+	for i := range variants {
+		variants[i].JobID = ids[i]
+	}
+	var holdout int64
+	if len(jobs) > len(variants) {
+		holdout = ids[len(variants)]
+	}
+	segment, err := json.Marshal(t.Segment)
+	if err != nil {
+		return err
+	}
+	rawVariants, err := json.Marshal(variants)
+	if err != nil {
+		return err
+	}
+	var winnerAt int64
+	if !t.WinnerAt.IsZero() {
+		winnerAt = t.WinnerAt.Unix()
+	}
+	res, err := tx.Exec(`INSERT INTO broadcast_ab_tests(admin_chat_id, segment, variants, holdout_job_id, holdout_percent, winner_at, status, created_at)
+VALUES(?,?,?,?,?,?,?,?)`,
+		t.AdminChatID, string(segment), string(rawVariants), holdout, t.HoldoutPercent, winnerAt, string(t.Status), t.CreatedAt.Unix())
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for i, job := range jobs {
+		job.ID = ids[i]
+	}
+	t.ID, t.Variants, t.HoldoutJobID = id, variants, holdout
+	return nil
+}
+
+const abTestColumns = `id, admin_chat_id, segment, variants, holdout_job_id, holdout_percent, winner_at, winner_job_id, status, created_at`
+
+func (r *BroadcastJobRepo) ListABTests(limit int) ([]usecase.ABTest, error) {
+	return r.queryABTests(`SELECT `+abTestColumns+` FROM broadcast_ab_tests ORDER BY id DESC LIMIT ?`, limit)
+}
+
+func (r *BroadcastJobRepo) DueABTests(now time.Time) ([]usecase.ABTest, error) {
+	return r.queryABTests(`SELECT `+abTestColumns+` FROM broadcast_ab_tests WHERE status = ? AND winner_at <= ? ORDER BY winner_at, id`,
+		string(usecase.ABTestWaiting), now.Unix())
+}
+
+func (r *BroadcastJobRepo) CompleteABTest(id, winnerJobID int64, c usecase.BroadcastContent) (bool, error) {
+	content, err := json.Marshal(c)
+	if err != nil {
+		return false, err
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	ok, err := affected(tx.Exec(`UPDATE broadcast_ab_tests SET status = ?, winner_job_id = ? WHERE id = ? AND status = ?`,
+		string(usecase.ABTestDone), winnerJobID, id, string(usecase.ABTestWaiting)))
+	if err != nil || !ok {
+		return false, err
+	}
+	// отложенное задание получает контент победителя и дальше живёт как обычная рассылка
+	if _, err := tx.Exec(`UPDATE broadcasts SET content = ?, status = ?
+WHERE id = (SELECT holdout_job_id FROM broadcast_ab_tests WHERE id = ?) AND status = ?`,
+		string(content), string(usecase.JobRunning), id, string(usecase.JobHeld)); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (r *BroadcastJobRepo) queryABTests(q string, args ...any) ([]usecase.ABTest, error) {
+	rows, err := r.db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []usecase.ABTest
+	for rows.Next() {
+		var t usecase.ABTest
+		var segment, variants, status string
+		var winnerAt, created int64
+		if err := rows.Scan(&t.ID, &t.AdminChatID, &segment, &variants, &t.HoldoutJobID, &t.HoldoutPercent,
+			&winnerAt, &t.WinnerJobID, &status, &created); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(segment), &t.Segment); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(variants), &t.Variants); err != nil {
+			return nil, err
+		}
+		if winnerAt > 0 {
+			t.WinnerAt = time.Unix(winnerAt, 0)
+		}
+		t.Status = usecase.ABTestStatus(status)
+		t.CreatedAt = time.Unix(created, 0)
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
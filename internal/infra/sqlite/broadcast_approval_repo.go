@@ -0,0 +1,84 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"alliance-management-telegram-bot/internal/usecase"
+)
+
+type BroadcastApprovalRepo struct {
+	db *sql.DB
+}
+
+func NewBroadcastApprovalRepo(dsn string) (*BroadcastApprovalRepo, error) {
+	db, err := openDB(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrateBroadcastApprovals(db); err != nil {
+		return nil, err
+	}
+	return &BroadcastApprovalRepo{db: db}, nil
+}
+
+func migrateBroadcastApprovals(db *sql.DB) error {
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS broadcast_approvals (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    requested_by INTEGER NOT NULL,
+    draft TEXT NOT NULL,
+    recipients INTEGER NOT NULL,
+    status TEXT NOT NULL,
+    decided_by INTEGER NOT NULL DEFAULT 0,
+    created_at INTEGER NOT NULL,
+    decided_at INTEGER NOT NULL DEFAULT 0
+);
+`)
+	return err
+}
+
+func (r *BroadcastApprovalRepo) CreateApproval(a *usecase.BroadcastApproval) error {
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = time.Now()
+	}
+	draft, err := json.Marshal(a.Draft)
+	if err != nil {
+		return err
+	}
+	res, err := r.db.Exec(`INSERT INTO broadcast_approvals(requested_by, draft, recipients, status, created_at) VALUES(?,?,?,?,?)`,
+		a.RequestedBy, string(draft), a.Recipients, string(a.Status), a.CreatedAt.Unix())
+	if err != nil {
+		return err
+	}
+	a.ID, err = res.LastInsertId()
+	return err
+}
+
+func (r *BroadcastApprovalRepo) GetApproval(id int64) (usecase.BroadcastApproval, error) {
+	var a usecase.BroadcastApproval
+	var draft, status string
+	var created int64
+	err := r.db.QueryRow(`SELECT id, requested_by, draft, recipients, status, decided_by, created_at FROM broadcast_approvals WHERE id = ?`, id).
+		Scan(&a.ID, &a.RequestedBy, &draft, &a.Recipients, &status, &a.DecidedBy, &created)
+	if err != nil {
+		return a, err
+	}
+	if err := json.Unmarshal([]byte(draft), &a.Draft); err != nil {
+		return a, err
+	}
+	a.Status = usecase.ApprovalStatus(status)
+	a.CreatedAt = time.Unix(created, 0)
+	return a, nil
+}
+
+func (r *BroadcastApprovalRepo) DecideApproval(id int64, status usecase.ApprovalStatus, decidedBy int64) (bool, error) {
+	res, err := r.db.Exec(`UPDATE broadcast_approvals SET status = ?, decided_by = ?, decided_at = ? WHERE id = ? AND status = ?`,
+		string(status), decidedBy, time.Now().Unix(), id, string(usecase.ApprovalPending))
+	return affected(res, err)
+}
+
+func (r *BroadcastApprovalRepo) Close() error { return r.db.Close() }
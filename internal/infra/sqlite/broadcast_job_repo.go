@@ -0,0 +1,386 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"alliance-management-telegram-bot/internal/usecase"
+)
+
+type BroadcastJobRepo struct {
+	db *sql.DB
+}
+
+func NewBroadcastJobRepo(dsn string) (*BroadcastJobRepo, error) {
+	db, err := openDB(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrateBroadcastJobs(db); err != nil {
+		return nil, err
+	}
+	if err := migrateBroadcastTracking(db); err != nil {
+		return nil, err
+	}
+	if err := migrateBroadcastABTests(db); err != nil {
+		return nil, err
+	}
+	return &BroadcastJobRepo{db: db}, nil
+}
+
+func migrateBroadcastJobs(db *sql.DB) error {
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS broadcasts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    admin_chat_id INTEGER NOT NULL,
+    status_message_id INTEGER NOT NULL DEFAULT 0,
+    content TEXT NOT NULL,
+    status TEXT NOT NULL,
+    total INTEGER NOT NULL,
+    sent INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_broadcasts_status ON broadcasts(status);
+CREATE TABLE IF NOT EXISTS broadcast_recipients (
+    broadcast_id INTEGER NOT NULL,
+    chat_id INTEGER NOT NULL,
+    status TEXT NOT NULL,
+    message_id INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMP,
+    PRIMARY KEY (broadcast_id, chat_id)
+);
+CREATE INDEX IF NOT EXISTS idx_broadcast_recipients_status ON broadcast_recipients(broadcast_id, status);
+CREATE TABLE IF NOT EXISTS broadcast_ops (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    broadcast_id INTEGER NOT NULL,
+    admin_chat_id INTEGER NOT NULL,
+    status_message_id INTEGER NOT NULL DEFAULT 0,
+    kind TEXT NOT NULL,
+    content TEXT NOT NULL,
+    status TEXT NOT NULL,
+    total INTEGER NOT NULL,
+    done INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    cursor INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP
+);
+`)
+	if err != nil {
+		return err
+	}
+	// все ID сообщений поста в JSON: ID альбома не обязательно идут подряд
+	if _, err := addColumn(db, "broadcast_recipients", "message_ids", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	added, err := addColumn(db, "broadcast_recipients", "error_class", "TEXT NOT NULL DEFAULT ''")
+	if err != nil || !added {
+		return err
+	}
+	// разово классифицируем ошибки, записанные до появления колонки
+	_, err = db.Exec(`
+UPDATE broadcast_recipients SET error_class = CASE
+    WHEN error LIKE '%bot was blocked%' OR error LIKE '%bot was kicked%' THEN ?
+    WHEN error LIKE '%user is deactivated%' THEN ?
+    WHEN error LIKE '%chat not found%' THEN ?
+    WHEN error LIKE '%retry after%' THEN ?
+    ELSE ?
+END
+WHERE status = ?`,
+		usecase.ErrClassBlocked, usecase.ErrClassDeactivated, usecase.ErrClassChatNotFound, usecase.ErrClassRateLimited,
+		usecase.ErrClassOther, string(usecase.RecipientFailed))
+	return err
+}
+
+func (r *BroadcastJobRepo) Create(job *usecase.BroadcastJob, recipients []int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	id, err := createJob(tx, job, recipients)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	job.ID = id
+	return nil
+}
+
+// createJob сохраняет задание и его получателей в транзакции tx и возвращает ID задания
+func createJob(tx *sql.Tx, job *usecase.BroadcastJob, recipients []int64) (int64, error) {
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = time.Now()
+	}
+	content, err := json.Marshal(job.Content)
+	if err != nil {
+		return 0, err
+	}
+	res, err := tx.Exec(`INSERT INTO broadcasts(admin_chat_id, content, status, total, created_at) VALUES(?,?,?,?,?)`,
+		job.AdminChatID, string(content), string(job.Status), job.Total, job.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	stmt, err := tx.Prepare(`INSERT OR IGNORE INTO broadcast_recipients(broadcast_id, chat_id, status) VALUES(?,?,?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	for _, chatID := range recipients {
+		if _, err := stmt.Exec(id, chatID, string(usecase.RecipientPending)); err != nil {
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+func (r *BroadcastJobRepo) SetStatusMessage(jobID int64, messageID int) error {
+	_, err := r.db.Exec(`UPDATE broadcasts SET status_message_id = ? WHERE id = ?`, messageID, jobID)
+	return err
+}
+
+func (r *BroadcastJobRepo) PendingRecipients(jobID int64, limit int) ([]int64, error) {
+	rows, err := r.db.Query(`SELECT chat_id FROM broadcast_recipients WHERE broadcast_id = ? AND status = ? ORDER BY rowid LIMIT ?`,
+		jobID, string(usecase.RecipientPending), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make([]int64, 0, limit)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (r *BroadcastJobRepo) MarkRecipient(jobID, chatID int64, status usecase.RecipientStatus, messageIDs []int, errClass, errText string) error {
+	messageID, ids := 0, ""
+	if len(messageIDs) > 0 {
+		data, err := json.Marshal(messageIDs)
+		if err != nil {
+			return err
+		}
+		messageID, ids = messageIDs[0], string(data)
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`UPDATE broadcast_recipients SET status = ?, message_id = ?, message_ids = ?, error_class = ?, error = ?, updated_at = ?
+WHERE broadcast_id = ? AND chat_id = ? AND status = ?`,
+		string(status), messageID, ids, errClass, errText, time.Now(), jobID, chatID, string(usecase.RecipientPending))
+	if err != nil {
+		return err
+	}
+	// счётчики меняем только при первом переходе из pending, чтобы повтор не задвоил их
+	if n, _ := res.RowsAffected(); n > 0 {
+		counter := `sent = sent + 1`
+		if status == usecase.RecipientFailed {
+			counter = `failed = failed + 1`
+		}
+		if _, err := tx.Exec(`UPDATE broadcasts SET `+counter+` WHERE id = ?`, jobID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *BroadcastJobRepo) Finish(jobID int64) error {
+	_, err := r.db.Exec(`UPDATE broadcasts SET status = ?, finished_at = ? WHERE id = ?`, string(usecase.JobDone), time.Now(), jobID)
+	return err
+}
+
+const jobColumns = `id, admin_chat_id, status_message_id, content, status, total, sent, failed, created_at`
+
+func (r *BroadcastJobRepo) ListRunning() ([]usecase.BroadcastJob, error) {
+	return r.queryJobs(`SELECT `+jobColumns+` FROM broadcasts WHERE status = ? ORDER BY id`, string(usecase.JobRunning))
+}
+
+func (r *BroadcastJobRepo) ListRecentJobs(limit int) ([]usecase.BroadcastJob, error) {
+	return r.queryJobs(`SELECT `+jobColumns+` FROM broadcasts ORDER BY id DESC LIMIT ?`, limit)
+}
+
+func (r *BroadcastJobRepo) ErrorBreakdown(jobID int64) (map[string]int, error) {
+	rows, err := r.db.Query(`SELECT error_class, COUNT(*) FROM broadcast_recipients WHERE broadcast_id = ? AND status = ? GROUP BY error_class`,
+		jobID, string(usecase.RecipientFailed))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]int)
+	for rows.Next() {
+		var class string
+		var n int
+		if err := rows.Scan(&class, &n); err != nil {
+			return nil, err
+		}
+		out[class] = n
+	}
+	return out, rows.Err()
+}
+
+func (r *BroadcastJobRepo) ListFailures(jobID int64) ([]usecase.RecipientResult, error) {
+	rows, err := r.db.Query(`SELECT chat_id, status, message_id, error_class, error, updated_at FROM broadcast_recipients
+WHERE broadcast_id = ? AND status = ? ORDER BY rowid`, jobID, string(usecase.RecipientFailed))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []usecase.RecipientResult
+	for rows.Next() {
+		var res usecase.RecipientResult
+		var status string
+		var updated sql.NullTime
+		if err := rows.Scan(&res.ChatID, &status, &res.MessageID, &res.ErrorClass, &res.Error, &updated); err != nil {
+			return nil, err
+		}
+		res.Status = usecase.RecipientStatus(status)
+		res.UpdatedAt = updated.Time
+		out = append(out, res)
+	}
+	return out, rows.Err()
+}
+
+func (r *BroadcastJobRepo) queryJobs(q string, args ...any) ([]usecase.BroadcastJob, error) {
+	rows, err := r.db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []usecase.BroadcastJob
+	for rows.Next() {
+		var j usecase.BroadcastJob
+		var content, status string
+		if err := rows.Scan(&j.ID, &j.AdminChatID, &j.StatusMessageID, &content, &status, &j.Total, &j.Sent, &j.Failed, &j.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(content), &j.Content); err != nil {
+			return nil, err
+		}
+		j.Status = usecase.JobStatus(status)
+		out = append(out, j)
+	}
+	return out, rows.Err()
+}
+
+func (r *BroadcastJobRepo) GetJob(jobID int64) (usecase.BroadcastJob, error) {
+	jobs, err := r.queryJobs(`SELECT `+jobColumns+` FROM broadcasts WHERE id = ?`, jobID)
+	if err != nil {
+		return usecase.BroadcastJob{}, err
+	}
+	if len(jobs) == 0 {
+		return usecase.BroadcastJob{}, sql.ErrNoRows
+	}
+	return jobs[0], nil
+}
+
+func (r *BroadcastJobRepo) CreateOp(op *usecase.BroadcastOp) error {
+	if op.CreatedAt.IsZero() {
+		op.CreatedAt = time.Now()
+	}
+	content, err := json.Marshal(op.Content)
+	if err != nil {
+		return err
+	}
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM broadcast_recipients WHERE broadcast_id = ? AND status = ? AND message_id > 0`,
+		op.BroadcastID, string(usecase.RecipientSent)).Scan(&op.Total); err != nil {
+		return err
+	}
+	res, err := r.db.Exec(`INSERT INTO broadcast_ops(broadcast_id, admin_chat_id, kind, content, status, total, created_at) VALUES(?,?,?,?,?,?,?)`,
+		op.BroadcastID, op.AdminChatID, string(op.Kind), string(content), string(op.Status), op.Total, op.CreatedAt)
+	if err != nil {
+		return err
+	}
+	op.ID, err = res.LastInsertId()
+	return err
+}
+
+func (r *BroadcastJobRepo) SetOpStatusMessage(opID int64, messageID int) error {
+	_, err := r.db.Exec(`UPDATE broadcast_ops SET status_message_id = ? WHERE id = ?`, messageID, opID)
+	return err
+}
+
+// SentMessages обходит получателей в порядке rowid, поэтому Pos — это rowid строки
+func (r *BroadcastJobRepo) SentMessages(jobID int64, after int64, limit int) ([]usecase.SentMessage, error) {
+	rows, err := r.db.Query(`SELECT rowid, chat_id, message_id, message_ids FROM broadcast_recipients
+WHERE broadcast_id = ? AND status = ? AND message_id > 0 AND rowid > ? ORDER BY rowid LIMIT ?`,
+		jobID, string(usecase.RecipientSent), after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]usecase.SentMessage, 0, limit)
+	for rows.Next() {
+		var m usecase.SentMessage
+		var ids string
+		if err := rows.Scan(&m.Pos, &m.ChatID, &m.MessageID, &ids); err != nil {
+			return nil, err
+		}
+		if ids != "" {
+			if err := json.Unmarshal([]byte(ids), &m.MessageIDs); err != nil {
+				return nil, err
+			}
+		}
+		// до сохранения всех ID известен только первый: остальные сообщения альбома не трогаем,
+		// чтобы не удалить чужие
+		if len(m.MessageIDs) == 0 {
+			m.MessageIDs = []int{m.MessageID}
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+func (r *BroadcastJobRepo) AdvanceOp(opID int64, cursor int64, done, failed int) error {
+	_, err := r.db.Exec(`UPDATE broadcast_ops SET cursor = ?, done = ?, failed = ? WHERE id = ?`, cursor, done, failed, opID)
+	return err
+}
+
+func (r *BroadcastJobRepo) FinishOp(opID int64) error {
+	_, err := r.db.Exec(`UPDATE broadcast_ops SET status = ?, finished_at = ? WHERE id = ?`, string(usecase.JobDone), time.Now(), opID)
+	return err
+}
+
+func (r *BroadcastJobRepo) ListRunningOps() ([]usecase.BroadcastOp, error) {
+	rows, err := r.db.Query(`SELECT id, broadcast_id, admin_chat_id, status_message_id, kind, content, status, total, done, failed, cursor, created_at
+FROM broadcast_ops WHERE status = ? ORDER BY id`, string(usecase.JobRunning))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []usecase.BroadcastOp
+	for rows.Next() {
+		var op usecase.BroadcastOp
+		var kind, content, status string
+		if err := rows.Scan(&op.ID, &op.BroadcastID, &op.AdminChatID, &op.StatusMessageID, &kind, &content, &status,
+			&op.Total, &op.Done, &op.Failed, &op.Cursor, &op.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(content), &op.Content); err != nil {
+			return nil, err
+		}
+		op.Kind = usecase.BroadcastOpKind(kind)
+		op.Status = usecase.JobStatus(status)
+		out = append(out, op)
+	}
+	return out, rows.Err()
+}
+
+func (r *BroadcastJobRepo) Close() error { return r.db.Close() }
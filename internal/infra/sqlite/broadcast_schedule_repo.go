@@ -0,0 +1,136 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"alliance-management-telegram-bot/internal/usecase"
+)
+
+type BroadcastScheduleRepo struct {
+	db *sql.DB
+}
+
+func NewBroadcastScheduleRepo(dsn string) (*BroadcastScheduleRepo, error) {
+	db, err := openDB(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrateBroadcastSchedules(db); err != nil {
+		return nil, err
+	}
+	return &BroadcastScheduleRepo{db: db}, nil
+}
+
+// next_run_at хранится в unix-секундах, чтобы выбирать наступившие запуски сравнением в SQL
+func migrateBroadcastSchedules(db *sql.DB) error {
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS broadcast_schedules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    admin_chat_id INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    segment TEXT NOT NULL,
+    repeat TEXT NOT NULL,
+    weekday INTEGER NOT NULL DEFAULT 0,
+    hour INTEGER NOT NULL,
+    minute INTEGER NOT NULL,
+    next_run_at INTEGER NOT NULL,
+    status TEXT NOT NULL,
+    created_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_broadcast_schedules_due ON broadcast_schedules(status, next_run_at);
+`)
+	return err
+}
+
+func (r *BroadcastScheduleRepo) CreateSchedule(s *usecase.BroadcastSchedule) error {
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = time.Now()
+	}
+	content, err := json.Marshal(s.Content)
+	if err != nil {
+		return err
+	}
+	segment, err := json.Marshal(s.Segment)
+	if err != nil {
+		return err
+	}
+	res, err := r.db.Exec(`INSERT INTO broadcast_schedules(admin_chat_id, content, segment, repeat, weekday, hour, minute, next_run_at, status, created_at)
+VALUES(?,?,?,?,?,?,?,?,?,?)`,
+		s.AdminChatID, string(content), string(segment), string(s.Repeat), int(s.Weekday), s.Hour, s.Minute,
+		s.NextRunAt.Unix(), string(s.Status), s.CreatedAt.Unix())
+	if err != nil {
+		return err
+	}
+	s.ID, err = res.LastInsertId()
+	return err
+}
+
+const scheduleColumns = `id, admin_chat_id, content, segment, repeat, weekday, hour, minute, next_run_at, status, created_at`
+
+func (r *BroadcastScheduleRepo) ListSchedules() ([]usecase.BroadcastSchedule, error) {
+	return r.query(`SELECT `+scheduleColumns+` FROM broadcast_schedules WHERE status = ? ORDER BY next_run_at, id`,
+		string(usecase.ScheduleActive))
+}
+
+func (r *BroadcastScheduleRepo) DueSchedules(now time.Time) ([]usecase.BroadcastSchedule, error) {
+	return r.query(`SELECT `+scheduleColumns+` FROM broadcast_schedules WHERE status = ? AND next_run_at <= ? ORDER BY next_run_at, id`,
+		string(usecase.ScheduleActive), now.Unix())
+}
+
+func (r *BroadcastScheduleRepo) Reschedule(id int64, prev, next time.Time) (bool, error) {
+	res, err := r.db.Exec(`UPDATE broadcast_schedules SET next_run_at = ? WHERE id = ? AND status = ? AND next_run_at = ?`,
+		next.Unix(), id, string(usecase.ScheduleActive), prev.Unix())
+	return affected(res, err)
+}
+
+func (r *BroadcastScheduleRepo) SetScheduleStatus(id int64, status usecase.ScheduleStatus) (bool, error) {
+	res, err := r.db.Exec(`UPDATE broadcast_schedules SET status = ? WHERE id = ? AND status = ?`,
+		string(status), id, string(usecase.ScheduleActive))
+	return affected(res, err)
+}
+
+func (r *BroadcastScheduleRepo) query(q string, args ...any) ([]usecase.BroadcastSchedule, error) {
+	rows, err := r.db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []usecase.BroadcastSchedule
+	for rows.Next() {
+		var s usecase.BroadcastSchedule
+		var content, segment, repeat, status string
+		var weekday int
+		var nextRun, created int64
+		if err := rows.Scan(&s.ID, &s.AdminChatID, &content, &segment, &repeat, &weekday, &s.Hour, &s.Minute, &nextRun, &status, &created); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(content), &s.Content); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(segment), &s.Segment); err != nil {
+			return nil, err
+		}
+		s.Repeat = usecase.ScheduleRepeat(repeat)
+		s.Weekday = time.Weekday(weekday)
+		s.NextRunAt = time.Unix(nextRun, 0)
+		s.Status = usecase.ScheduleStatus(status)
+		s.CreatedAt = time.Unix(created, 0)
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+func (r *BroadcastScheduleRepo) Close() error { return r.db.Close() }
+
+// affected сообщает, изменил ли запрос хотя бы одну строку
+func affected(res sql.Result, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
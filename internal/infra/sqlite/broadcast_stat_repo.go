@@ -14,7 +14,7 @@ type BroadcastStatRepo struct {
 }
 
 func NewBroadcastStatRepo(dsn string) (*BroadcastStatRepo, error) {
-	db, err := sql.Open("sqlite", dsn)
+	db, err := openDB(dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -64,3 +64,5 @@ func (r *BroadcastStatRepo) ListRecent(n int) ([]usecase.BroadcastStat, error) {
 	}
 	return out, nil
 }
+
+func (r *BroadcastStatRepo) Close() error { return r.db.Close() }
@@ -0,0 +1,76 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	"alliance-management-telegram-bot/internal/usecase"
+)
+
+// Клики и конверсии рассылок хранятся рядом с заданиями; время — в unix-секундах
+func migrateBroadcastTracking(db *sql.DB) error {
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS broadcast_clicks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    broadcast_id INTEGER NOT NULL,
+    chat_id INTEGER NOT NULL,
+    button INTEGER NOT NULL,
+    clicked_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_broadcast_clicks_broadcast ON broadcast_clicks(broadcast_id);
+CREATE TABLE IF NOT EXISTS broadcast_conversions (
+    broadcast_id INTEGER NOT NULL,
+    chat_id INTEGER NOT NULL,
+    kind TEXT NOT NULL,
+    converted_at INTEGER NOT NULL,
+    PRIMARY KEY (broadcast_id, chat_id, kind)
+);
+CREATE INDEX IF NOT EXISTS idx_broadcast_recipients_chat ON broadcast_recipients(chat_id);
+`)
+	return err
+}
+
+func (r *BroadcastJobRepo) RecordClick(jobID, chatID int64, button int, at time.Time) error {
+	_, err := r.db.Exec(`INSERT INTO broadcast_clicks(broadcast_id, chat_id, button, clicked_at) VALUES(?,?,?,?)`,
+		jobID, chatID, button, at.Unix())
+	return err
+}
+
+func (r *BroadcastJobRepo) RecordConversion(chatID int64, kind string, since, at time.Time) (int64, error) {
+	// updated_at хранится текстом time.Time, поэтому окно проверяем в Go по последним доставкам
+	rows, err := r.db.Query(`SELECT broadcast_id, updated_at FROM broadcast_recipients
+WHERE chat_id = ? AND status = ? ORDER BY rowid DESC LIMIT 20`, chatID, string(usecase.RecipientSent))
+	if err != nil {
+		return 0, err
+	}
+	var jobID int64
+	for rows.Next() {
+		var id int64
+		var delivered sql.NullTime
+		if err := rows.Scan(&id, &delivered); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if delivered.Valid && !delivered.Time.Before(since) && !delivered.Time.After(at) {
+			jobID = id
+			break
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || jobID == 0 {
+		return 0, err
+	}
+	_, err = r.db.Exec(`INSERT OR IGNORE INTO broadcast_conversions(broadcast_id, chat_id, kind, converted_at) VALUES(?,?,?,?)`,
+		jobID, chatID, kind, at.Unix())
+	return jobID, err
+}
+
+func (r *BroadcastJobRepo) Engagement(jobID int64) (usecase.BroadcastEngagement, error) {
+	var e usecase.BroadcastEngagement
+	err := r.db.QueryRow(`SELECT
+    (SELECT COUNT(DISTINCT chat_id) FROM broadcast_clicks WHERE broadcast_id = ?),
+    (SELECT COUNT(*) FROM broadcast_conversions WHERE broadcast_id = ? AND kind = ?),
+    (SELECT COUNT(*) FROM broadcast_conversions WHERE broadcast_id = ? AND kind = ?)`,
+		jobID, jobID, usecase.ConversionQuizStart, jobID, usecase.ConversionLead).Scan(&e.Clickers, &e.QuizStarts, &e.Leads)
+	return e, err
+}
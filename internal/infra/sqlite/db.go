@@ -0,0 +1,108 @@
+package sqlite
+
+import (
+	"database/sql"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// openDB открывает базу с busy_timeout: репозитории пишут в один файл из нескольких
+// горутин (обработчики апдейтов, рассылки, доставка лидов) и не должны падать с SQLITE_BUSY
+func openDB(dsn string) (*sql.DB, error) {
+	if !strings.Contains(dsn, "busy_timeout") {
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		dsn += sep + "_pragma=busy_timeout(5000)"
+	}
+	return sql.Open("sqlite", dsn)
+}
+
+// addColumn добавляет колонку, если её ещё нет (в SQLite нет ADD COLUMN IF NOT EXISTS),
+// и сообщает, была ли она добавлена — для разовых бэкфиллов
+func addColumn(db *sql.DB, table, column, decl string) (bool, error) {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, err
+		}
+		if name == column {
+			return false, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+	if _, err := db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + decl); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func tableExists(db *sql.DB, table string) (bool, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&n)
+	return n > 0, err
+}
+
+// addUnixTimestamp дублирует created_at в колонке created_ts (unix-секунды): created_at хранится
+// текстом time.Time, и выбрать период по нему в SQL нельзя. Старые строки заполняются разово.
+func addUnixTimestamp(db *sql.DB, table, key string) error {
+	added, err := addColumn(db, table, "created_ts", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	if added {
+		if err := backfillTimestamps(db, table, key); err != nil {
+			return err
+		}
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_` + table + `_ts ON ` + table + `(created_ts)`)
+	return err
+}
+
+func backfillTimestamps(db *sql.DB, table, key string) error {
+	rows, err := db.Query(`SELECT ` + key + `, created_at FROM ` + table)
+	if err != nil {
+		return err
+	}
+	ts := map[int64]int64{}
+	for rows.Next() {
+		var id int64
+		var created sql.NullTime
+		if err := rows.Scan(&id, &created); err != nil {
+			rows.Close()
+			return err
+		}
+		if created.Valid {
+			ts[id] = created.Time.Unix()
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(`UPDATE ` + table + ` SET created_ts = ? WHERE ` + key + ` = ?`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for id, t := range ts {
+		if _, err := stmt.Exec(t, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -2,6 +2,8 @@ package sqlite
 
 import (
 	"database/sql"
+	"fmt"
+	"sort"
 	"time"
 
 	_ "modernc.org/sqlite"
@@ -14,7 +16,7 @@ type FunnelRepo struct {
 }
 
 func NewFunnelRepo(dsn string) (*FunnelRepo, error) {
-	db, err := sql.Open("sqlite", dsn)
+	db, err := openDB(dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -34,12 +36,43 @@ CREATE TABLE IF NOT EXISTS funnel_hits (
 );
 CREATE INDEX IF NOT EXISTS idx_funnel_hits_state ON funnel_hits(state);
 CREATE INDEX IF NOT EXISTS idx_funnel_hits_chat_state ON funnel_hits(chat_id, state);
+`)
+	if err != nil {
+		return err
+	}
+	if err := addUnixTimestamp(db, "funnel_hits", "id"); err != nil {
+		return err
+	}
+	// ответы квиза на момент захода — для конверсии в разрезе ответов
+	var added bool
+	for _, col := range []string{"purpose", "bedrooms", "payment"} {
+		ok, err := addColumn(db, "funnel_hits", col, "TEXT NOT NULL DEFAULT ''")
+		if err != nil {
+			return err
+		}
+		added = added || ok
+	}
+	if !added {
+		return nil
+	}
+	// старые заходы разово получают последние известные ответы пользователя
+	hasUsers, err := tableExists(db, "users")
+	if err != nil || !hasUsers {
+		return err
+	}
+	_, err = db.Exec(`
+UPDATE funnel_hits SET
+    purpose = COALESCE((SELECT u.purpose FROM users u WHERE u.chat_id = funnel_hits.chat_id), ''),
+    bedrooms = COALESCE((SELECT u.bedrooms FROM users u WHERE u.chat_id = funnel_hits.chat_id), ''),
+    payment = COALESCE((SELECT u.payment FROM users u WHERE u.chat_id = funnel_hits.chat_id), '')
 `)
 	return err
 }
 
-func (r *FunnelRepo) Hit(state usecase.State, chatID int64) error {
-	_, err := r.db.Exec(`INSERT INTO funnel_hits(chat_id, state, created_at) VALUES(?,?,?)`, chatID, string(state), time.Now())
+func (r *FunnelRepo) Hit(state usecase.State, chatID int64, a usecase.FunnelAnswers) error {
+	now := time.Now()
+	_, err := r.db.Exec(`INSERT INTO funnel_hits(chat_id, state, created_at, created_ts, purpose, bedrooms, payment) VALUES(?,?,?,?,?,?,?)`,
+		chatID, string(state), now, now.Unix(), a.Purpose, a.Bedrooms, a.Payment)
 	return err
 }
 
@@ -59,3 +92,133 @@ func (r *FunnelRepo) Counts() map[usecase.State]int {
 	}
 	return out
 }
+
+// CountsBetween — число уникальных пользователей на каждом шаге среди заходов за [from, to)
+func (r *FunnelRepo) CountsBetween(from, to time.Time) (map[usecase.State]int, error) {
+	rows, err := r.db.Query(`SELECT state, COUNT(DISTINCT chat_id) FROM funnel_hits WHERE created_ts >= ? AND created_ts < ? GROUP BY state`,
+		from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[usecase.State]int{}
+	for rows.Next() {
+		var state string
+		var cnt int
+		if err := rows.Scan(&state, &cnt); err != nil {
+			return nil, err
+		}
+		out[usecase.State(state)] = cnt
+	}
+	return out, rows.Err()
+}
+
+// WeeklyCohorts группирует пользователей по неделе (с понедельника, в часовом поясе from) первого
+// захода в воронку за [from, to) и считает, до каких шагов они дошли за всё время
+func (r *FunnelRepo) WeeklyCohorts(from, to time.Time) ([]usecase.FunnelCohort, error) {
+	rows, err := r.db.Query(`
+WITH first AS (
+    SELECT chat_id, MIN(created_ts) AS first_ts FROM funnel_hits GROUP BY chat_id
+    HAVING MIN(created_ts) >= ? AND MIN(created_ts) < ?
+)
+SELECT f.first_ts, h.state, COUNT(DISTINCT h.chat_id) FROM first f
+JOIN funnel_hits h ON h.chat_id = f.chat_id
+GROUP BY f.first_ts, h.state`, from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	loc := from.Location()
+	byWeek := map[time.Time]map[usecase.State]int{}
+	for rows.Next() {
+		var firstTS int64
+		var state string
+		var cnt int
+		if err := rows.Scan(&firstTS, &state, &cnt); err != nil {
+			return nil, err
+		}
+		week := weekStart(time.Unix(firstTS, 0).In(loc))
+		if byWeek[week] == nil {
+			byWeek[week] = map[usecase.State]int{}
+		}
+		byWeek[week][usecase.State(state)] += cnt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	out := make([]usecase.FunnelCohort, 0, len(byWeek))
+	for week, counts := range byWeek {
+		out = append(out, usecase.FunnelCohort{Week: week, Counts: counts})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Week.Before(out[j].Week) })
+	return out, nil
+}
+
+// answerColumns — поля сессии, по которым можно разбить воронку, и их колонки
+var answerColumns = map[string]string{
+	usecase.FieldPurpose:  "purpose",
+	usecase.FieldBedrooms: "bedrooms",
+	usecase.FieldPayment:  "payment",
+}
+
+// AnswerConversions считает по каждому ответу на поле field, сколько ответивших за [from, to)
+// пользователей дошли до лида; лид относится к ответам, с которыми он оставлен
+func (r *FunnelRepo) AnswerConversions(field string, from, to time.Time) ([]usecase.AnswerConversion, error) {
+	col, ok := answerColumns[field]
+	if !ok {
+		return nil, fmt.Errorf("unknown answer field %q", field)
+	}
+	rows, err := r.db.Query(`SELECT `+col+`, COUNT(DISTINCT chat_id), COUNT(DISTINCT CASE WHEN state = ? THEN chat_id END)
+FROM funnel_hits WHERE `+col+` <> '' AND created_ts >= ? AND created_ts < ?
+GROUP BY `+col+` ORDER BY 2 DESC, 1`, string(usecase.StateLeadSaved), from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []usecase.AnswerConversion
+	for rows.Next() {
+		c := usecase.AnswerConversion{Field: field}
+		if err := rows.Scan(&c.Answer, &c.Users, &c.Leads); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// Journeys возвращает время первого захода на каждый шаг у пользователей, чей первый заход
+// в воронку пришёлся на [from, to)
+func (r *FunnelRepo) Journeys(from, to time.Time) ([]usecase.FunnelJourney, error) {
+	rows, err := r.db.Query(`
+WITH first AS (
+    SELECT chat_id FROM funnel_hits GROUP BY chat_id
+    HAVING MIN(created_ts) >= ? AND MIN(created_ts) < ?
+)
+SELECT h.chat_id, h.state, MIN(h.created_ts) FROM funnel_hits h
+JOIN first f ON f.chat_id = h.chat_id
+GROUP BY h.chat_id, h.state ORDER BY h.chat_id`, from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []usecase.FunnelJourney
+	for rows.Next() {
+		var chatID, ts int64
+		var state string
+		if err := rows.Scan(&chatID, &state, &ts); err != nil {
+			return nil, err
+		}
+		if len(out) == 0 || out[len(out)-1].ChatID != chatID {
+			out = append(out, usecase.FunnelJourney{ChatID: chatID, Reached: map[usecase.State]time.Time{}})
+		}
+		out[len(out)-1].Reached[usecase.State(state)] = time.Unix(ts, 0)
+	}
+	return out, rows.Err()
+}
+
+func weekStart(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, t.Location())
+}
+
+func (r *FunnelRepo) Close() error { return r.db.Close() }
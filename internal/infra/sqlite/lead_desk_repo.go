@@ -0,0 +1,116 @@
+package sqlite
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"alliance-management-telegram-bot/internal/domain"
+	"alliance-management-telegram-bot/internal/usecase"
+)
+
+const leadColumns = `id, chat_id, COALESCE(purpose, ''), COALESCE(bedrooms, ''), COALESCE(payment, ''), phone, created_at,
+    status, assignee_id, assignee_name, updated_at, username, first_name, last_name, language_code, contact_name,
+    client_name, call_time`
+
+// scanLead читает leadColumns; extra — колонки запроса, идущие следом за ними
+func scanLead(row interface{ Scan(...any) error }, extra ...any) (domain.Lead, error) {
+	var l domain.Lead
+	var status string
+	var updated int64
+	dest := append([]any{&l.ID, &l.ChatID, &l.Purpose, &l.Bedrooms, &l.Payment, &l.Phone, &l.CreatedAt,
+		&status, &l.AssigneeID, &l.AssigneeName, &updated,
+		&l.Username, &l.FirstName, &l.LastName, &l.LanguageCode, &l.ContactName, &l.ClientName, &l.CallTime}, extra...)
+	err := row.Scan(dest...)
+	l.Status = domain.LeadStatus(status)
+	if updated > 0 {
+		l.UpdatedAt = time.Unix(updated, 0)
+	}
+	return l, err
+}
+
+func (r *LeadRepo) GetLead(id int64) (domain.Lead, error) {
+	return scanLead(r.db.QueryRow(`SELECT `+leadColumns+` FROM leads WHERE id = ?`, id))
+}
+
+func (r *LeadRepo) SetLeadCard(id int64, messageID int) error {
+	_, err := r.db.Exec(`UPDATE leads SET card_message_id = ? WHERE id = ?`, messageID, id)
+	return err
+}
+
+func (r *LeadRepo) LeadCard(id int64) (int, error) {
+	var messageID int
+	err := r.db.QueryRow(`SELECT card_message_id FROM leads WHERE id = ?`, id).Scan(&messageID)
+	return messageID, err
+}
+
+func (r *LeadRepo) UpdateLeadStatus(id int64, status domain.LeadStatus, managerID int64, managerName string, at time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	ok, err := affected(tx.Exec(`UPDATE leads SET status = ?, assignee_id = ?, assignee_name = ?, updated_at = ? WHERE id = ?`,
+		string(status), managerID, managerName, at.Unix(), id))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if _, err := tx.Exec(`INSERT INTO lead_events(lead_id, status, manager_id, manager_name, created_at) VALUES(?,?,?,?,?)`,
+		id, string(status), managerID, managerName, at.Unix()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListLeads фильтрует статус в SQL, а возраст — в Go: created_at хранится текстом time.Time
+func (r *LeadRepo) ListLeads(q usecase.LeadQuery, now time.Time, limit int) ([]domain.Lead, error) {
+	query := `SELECT ` + leadColumns + ` FROM leads`
+	var args []any
+	if len(q.Statuses) > 0 {
+		query += ` WHERE status IN (?` + strings.Repeat(",?", len(q.Statuses)-1) + `)`
+		for _, s := range q.Statuses {
+			args = append(args, string(s))
+		}
+	}
+	rows, err := r.db.Query(query+` ORDER BY id DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []domain.Lead
+	for rows.Next() && len(out) < limit {
+		l, err := scanLead(rows)
+		if err != nil {
+			return nil, err
+		}
+		if q.OlderThan > 0 && now.Sub(l.CreatedAt) < q.OlderThan {
+			continue
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+func (r *LeadRepo) LeadHistory(id int64) ([]usecase.LeadEvent, error) {
+	rows, err := r.db.Query(`SELECT lead_id, status, manager_id, manager_name, created_at FROM lead_events WHERE lead_id = ? ORDER BY id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []usecase.LeadEvent
+	for rows.Next() {
+		var e usecase.LeadEvent
+		var status string
+		var at int64
+		if err := rows.Scan(&e.LeadID, &status, &e.ManagerID, &e.ManagerName, &at); err != nil {
+			return nil, err
+		}
+		e.Status = domain.LeadStatus(status)
+		e.At = time.Unix(at, 0)
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,130 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"alliance-management-telegram-bot/internal/domain"
+	"alliance-management-telegram-bot/internal/usecase"
+)
+
+// LeadExportRepo собирает выгрузку лидов из leads, users, funnel_hits и lead_outbox.
+// Таблицы создают другие репозитории — этот только читает их.
+type LeadExportRepo struct {
+	db *sql.DB
+}
+
+func NewLeadExportRepo(dsn string) (*LeadExportRepo, error) {
+	db, err := openDB(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &LeadExportRepo{db: db}, nil
+}
+
+// ExportLeads фильтрует период в Go: created_at лидов хранится текстом time.Time
+func (r *LeadExportRepo) ExportLeads(from, to time.Time) ([]usecase.LeadExportRow, error) {
+	rows, err := r.db.Query(`SELECT ` + leadColumns + `, submissions,
+    COALESCE(u.user_name, ''), COALESCE(u.user_first, ''), COALESCE(u.user_last, ''), COALESCE(u.user_lang, ''), COALESCE(u.user_contact, '')
+FROM leads
+LEFT JOIN (SELECT chat_id AS user_chat_id, username AS user_name, first_name AS user_first, last_name AS user_last,
+    language_code AS user_lang, contact_name AS user_contact FROM users) u ON u.user_chat_id = leads.chat_id
+ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []usecase.LeadExportRow
+	for rows.Next() {
+		var row usecase.LeadExportRow
+		var p domain.Profile
+		l, err := scanLead(rows, &row.Submissions, &p.Username, &p.FirstName, &p.LastName, &p.LanguageCode, &p.ContactName)
+		if err != nil {
+			return nil, err
+		}
+		// у лидов, оставленных до сохранения профиля в заявке, берём профиль из users
+		if l.Profile == (domain.Profile{}) {
+			l.Profile = p
+		}
+		if l.CreatedAt.Before(from) || !l.CreatedAt.Before(to) {
+			continue
+		}
+		row.Lead = l
+		out = append(out, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+
+	reached, err := r.firstHits()
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := r.lastDeliveries()
+	if err != nil {
+		return nil, err
+	}
+	for i := range out {
+		out[i].Reached = reached[out[i].Lead.ChatID]
+		d := deliveries[out[i].Lead.ID]
+		out[i].Created, out[i].Updated = d[usecase.OutboxCreate], d[usecase.OutboxUpdate]
+	}
+	return out, nil
+}
+
+// firstHits — первый заход на каждый шаг воронки для всех, кто оставлял заявку
+func (r *LeadExportRepo) firstHits() (map[int64]map[usecase.State]time.Time, error) {
+	rows, err := r.db.Query(`SELECT chat_id, state, MIN(created_ts) FROM funnel_hits
+WHERE chat_id IN (SELECT chat_id FROM leads) AND created_ts > 0
+GROUP BY chat_id, state`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[int64]map[usecase.State]time.Time{}
+	for rows.Next() {
+		var chatID, ts int64
+		var state string
+		if err := rows.Scan(&chatID, &state, &ts); err != nil {
+			return nil, err
+		}
+		if out[chatID] == nil {
+			out[chatID] = map[usecase.State]time.Time{}
+		}
+		out[chatID][usecase.State(state)] = time.Unix(ts, 0)
+	}
+	return out, rows.Err()
+}
+
+// lastDeliveries — последние записи очереди доставки в CRM по каждому лиду отдельно для создания
+// и обновления: свежее обновление не должно скрывать, что сама заявка не дошла
+func (r *LeadExportRepo) lastDeliveries() (map[int64]map[usecase.OutboxKind]*usecase.OutboxItem, error) {
+	rows, err := r.db.Query(`SELECT lead_id, id, kind, status, attempts, next_attempt_at, last_error FROM lead_outbox
+WHERE id IN (SELECT MAX(id) FROM lead_outbox GROUP BY lead_id, kind)`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[int64]map[usecase.OutboxKind]*usecase.OutboxItem{}
+	for rows.Next() {
+		var leadID, next int64
+		var kind, status string
+		it := &usecase.OutboxItem{}
+		if err := rows.Scan(&leadID, &it.ID, &kind, &status, &it.Attempts, &next, &it.LastError); err != nil {
+			return nil, err
+		}
+		it.Kind, it.Status, it.NextAttemptAt = usecase.OutboxKind(kind), usecase.OutboxStatus(status), time.Unix(next, 0)
+		if out[leadID] == nil {
+			out[leadID] = map[usecase.OutboxKind]*usecase.OutboxItem{}
+		}
+		out[leadID][it.Kind] = it
+	}
+	return out, rows.Err()
+}
+
+func (r *LeadExportRepo) Close() error { return r.db.Close() }
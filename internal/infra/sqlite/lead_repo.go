@@ -7,23 +7,49 @@ import (
 	_ "modernc.org/sqlite"
 
 	"alliance-management-telegram-bot/internal/domain"
+	"alliance-management-telegram-bot/internal/usecase"
 )
 
 type LeadRepo struct {
-	db *sql.DB
+	db          *sql.DB
+	outbox      bool
+	dedupWindow time.Duration
+	hold        time.Duration
 }
 
-func NewLeadRepo(dsn string) (*LeadRepo, error) {
-	db, err := sql.Open("sqlite", dsn)
+// WithOutbox включает запись лида в очередь доставки lead_outbox в той же транзакции
+func WithOutbox() func(*LeadRepo) {
+	return func(r *LeadRepo) { r.outbox = true }
+}
+
+// WithDedupWindow объединяет повторные заявки с тем же номером или из того же чата, пришедшие
+// в течение window после предыдущей, в один лид
+func WithDedupWindow(window time.Duration) func(*LeadRepo) {
+	return func(r *LeadRepo) { r.dedupWindow = window }
+}
+
+// WithDeliveryHold откладывает отправку нового лида на hold, чтобы клиент успел ответить
+// на необязательные вопросы; ReleaseHeld отправляет его раньше
+func WithDeliveryHold(hold time.Duration) func(*LeadRepo) {
+	return func(r *LeadRepo) { r.hold = hold }
+}
+
+func NewLeadRepo(dsn string, opts ...func(*LeadRepo)) (*LeadRepo, error) {
+	db, err := openDB(dsn)
 	if err != nil {
 		return nil, err
 	}
 	if err := migrate(db); err != nil {
 		return nil, err
 	}
-	return &LeadRepo{db: db}, nil
+	r := &LeadRepo{db: db}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r, nil
 }
 
+// Время очереди хранится в unix-секундах, чтобы выбирать готовые записи в SQL
 func migrate(db *sql.DB) error {
 	_, err := db.Exec(`
 CREATE TABLE IF NOT EXISTS leads (
@@ -36,15 +62,256 @@ CREATE TABLE IF NOT EXISTS leads (
     created_at TIMESTAMP NOT NULL
 );
 CREATE INDEX IF NOT EXISTS idx_leads_chat_id ON leads(chat_id);
+CREATE TABLE IF NOT EXISTS lead_outbox (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    lead_id INTEGER NOT NULL REFERENCES leads(id),
+    status TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at INTEGER NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    updated_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_lead_outbox_due ON lead_outbox(status, next_attempt_at);
+CREATE TABLE IF NOT EXISTS lead_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    lead_id INTEGER NOT NULL REFERENCES leads(id),
+    status TEXT NOT NULL,
+    manager_id INTEGER NOT NULL,
+    manager_name TEXT NOT NULL,
+    created_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_lead_events_lead ON lead_events(lead_id);
+`)
+	if err != nil {
+		return err
+	}
+	// статус обработки менеджером; старые лиды считаются новыми
+	for _, c := range []struct{ name, decl string }{
+		{"status", "TEXT NOT NULL DEFAULT 'new'"},
+		{"assignee_id", "INTEGER NOT NULL DEFAULT 0"},
+		{"assignee_name", "TEXT NOT NULL DEFAULT ''"},
+		{"updated_at", "INTEGER NOT NULL DEFAULT 0"},
+		// время последней заявки — для объединения повторов
+		{"submitted_at", "INTEGER NOT NULL DEFAULT 0"},
+		{"submissions", "INTEGER NOT NULL DEFAULT 1"},
+		// профиль Telegram на момент заявки
+		{"username", "TEXT NOT NULL DEFAULT ''"},
+		{"first_name", "TEXT NOT NULL DEFAULT ''"},
+		{"last_name", "TEXT NOT NULL DEFAULT ''"},
+		{"language_code", "TEXT NOT NULL DEFAULT ''"},
+		{"contact_name", "TEXT NOT NULL DEFAULT ''"},
+		// ответы на необязательные вопросы после номера
+		{"client_name", "TEXT NOT NULL DEFAULT ''"},
+		{"call_time", "TEXT NOT NULL DEFAULT ''"},
+		// карточка лида в чате менеджеров, которую дополняют ответы после номера
+		{"card_message_id", "INTEGER NOT NULL DEFAULT 0"},
+	} {
+		if _, err := addColumn(db, "leads", c.name, c.decl); err != nil {
+			return err
+		}
+	}
+	if err := addUnixTimestamp(db, "leads", "id"); err != nil {
+		return err
+	}
+	// записи, созданные до появления обновлений, — создание заявки
+	if _, err := addColumn(db, "lead_outbox", "kind", "TEXT NOT NULL DEFAULT 'create'"); err != nil {
+		return err
+	}
+	// held = 1 — запись отложена до ответов клиента и ещё не бралась диспетчером
+	if _, err := addColumn(db, "lead_outbox", "held", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	// claimed = 1 — запись взята диспетчером и отправляется, её данные уже прочитаны
+	if _, err := addColumn(db, "lead_outbox", "claimed", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+CREATE INDEX IF NOT EXISTS idx_leads_status ON leads(status);
+CREATE INDEX IF NOT EXISTS idx_leads_phone ON leads(phone);
 `)
 	return err
 }
 
-func (r *LeadRepo) SaveLead(lead domain.Lead) error {
+func (r *LeadRepo) SaveLead(lead domain.Lead) (int64, bool, error) {
 	if lead.CreatedAt.IsZero() {
 		lead.CreatedAt = time.Now()
 	}
-	_, err := r.db.Exec(`INSERT INTO leads(chat_id, purpose, bedrooms, payment, phone, created_at) VALUES(?,?,?,?,?,?)`,
-		lead.ChatID, lead.Purpose, lead.Bedrooms, lead.Payment, lead.Phone, lead.CreatedAt)
+	submitted := lead.CreatedAt.Unix()
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+	var leadID int64
+	if r.dedupWindow > 0 {
+		err := tx.QueryRow(`SELECT id FROM leads WHERE (phone = ? OR chat_id = ?) AND submitted_at >= ? ORDER BY id DESC LIMIT 1`,
+			lead.Phone, lead.ChatID, lead.CreatedAt.Add(-r.dedupWindow).Unix()).Scan(&leadID)
+		if err != nil && err != sql.ErrNoRows {
+			return 0, false, err
+		}
+	}
+	merged := leadID != 0
+	kind := usecase.OutboxCreate
+	if merged {
+		// повтор: лид получает свежие ответы и номер, а в CRM уходит обновление
+		p := lead.Profile
+		if _, err := tx.Exec(`UPDATE leads SET purpose = ?, bedrooms = ?, payment = ?, phone = ?, submitted_at = ?, submissions = submissions + 1,
+    username = ?, first_name = ?, last_name = ?, language_code = ?, contact_name = COALESCE(NULLIF(?, ''), contact_name)
+WHERE id = ?`,
+			lead.Purpose, lead.Bedrooms, lead.Payment, lead.Phone, submitted,
+			p.Username, p.FirstName, p.LastName, p.LanguageCode, p.ContactName, leadID); err != nil {
+			return 0, false, err
+		}
+		kind = usecase.OutboxUpdate
+	} else {
+		p := lead.Profile
+		res, err := tx.Exec(`INSERT INTO leads(chat_id, purpose, bedrooms, payment, phone, created_at, created_ts, status, updated_at,
+    submitted_at, username, first_name, last_name, language_code, contact_name) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+			lead.ChatID, lead.Purpose, lead.Bedrooms, lead.Payment, lead.Phone, lead.CreatedAt, lead.CreatedAt.Unix(), string(domain.LeadNew), submitted, submitted,
+			p.Username, p.FirstName, p.LastName, p.LanguageCode, p.ContactName)
+		if err != nil {
+			return 0, false, err
+		}
+		if leadID, err = res.LastInsertId(); err != nil {
+			return 0, false, err
+		}
+	}
+	if r.outbox {
+		now := time.Now().Unix()
+		// заявка, которую так и не удалось создать, получает новые попытки со свежими данными
+		if _, err := tx.Exec(`UPDATE lead_outbox SET status = ?, attempts = 0, next_attempt_at = ?, updated_at = ?, claimed = 0
+WHERE lead_id = ? AND kind = ? AND status = ?`,
+			string(usecase.OutboxPending), now, now, leadID, string(usecase.OutboxCreate), string(usecase.OutboxDead)); err != nil {
+			return 0, false, err
+		}
+		// неотправленная запись, которую диспетчер сейчас не отправляет (ждёт очереди, задержки
+		// или повтора), сама прочитает свежие данные лида; истёкшая аренда тоже перечитает их
+		var queued int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM lead_outbox WHERE lead_id = ? AND status = ? AND (claimed = 0 OR next_attempt_at <= ?)`,
+			leadID, string(usecase.OutboxPending), now).Scan(&queued); err != nil {
+			return 0, false, err
+		}
+		if queued == 0 {
+			next, held := now, 0
+			if r.hold > 0 {
+				next, held = lead.CreatedAt.Add(r.hold).Unix(), 1
+			}
+			if _, err := tx.Exec(`INSERT INTO lead_outbox(lead_id, kind, status, next_attempt_at, updated_at, held) VALUES(?,?,?,?,?,?)`,
+				leadID, string(kind), string(usecase.OutboxPending), next, now, held); err != nil {
+				return 0, false, err
+			}
+		}
+	}
+	return leadID, merged, tx.Commit()
+}
+
+const outboxSelect = `SELECT o.id, o.kind, o.status, o.attempts, o.next_attempt_at, o.last_error,
+    l.id, l.chat_id, COALESCE(l.purpose, ''), COALESCE(l.bedrooms, ''), COALESCE(l.payment, ''), l.phone, l.created_at,
+    l.username, l.first_name, l.last_name, l.language_code, l.contact_name, l.client_name, l.call_time
+FROM lead_outbox o JOIN leads l ON l.id = o.lead_id`
+
+func (r *LeadRepo) ClaimDue(now time.Time, lease time.Duration, limit int) ([]usecase.OutboxItem, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	// записи одного лида уходят по порядку: обновление ждёт, пока не будут отправлены предыдущие,
+	// а после так и не созданной заявки не отправляется вовсе
+	rows, err := tx.Query(outboxSelect+` WHERE o.status = ? AND o.next_attempt_at <= ?
+    AND NOT EXISTS (SELECT 1 FROM lead_outbox p WHERE p.lead_id = o.lead_id AND p.id < o.id
+        AND (p.status = ? OR (p.status = ? AND p.kind = ?)))
+ORDER BY o.next_attempt_at, o.id LIMIT ?`,
+		string(usecase.OutboxPending), now.Unix(),
+		string(usecase.OutboxPending), string(usecase.OutboxDead), string(usecase.OutboxCreate), limit)
+	if err != nil {
+		return nil, err
+	}
+	items, err := scanOutbox(rows)
+	if err != nil {
+		return nil, err
+	}
+	leaseUntil := now.Add(lease).Unix()
+	for _, it := range items {
+		if _, err := tx.Exec(`UPDATE lead_outbox SET next_attempt_at = ?, updated_at = ?, held = 0, claimed = 1 WHERE id = ?`, leaseUntil, now.Unix(), it.ID); err != nil {
+			return nil, err
+		}
+	}
+	return items, tx.Commit()
+}
+
+func (r *LeadRepo) MarkDone(id int64) error {
+	_, err := r.db.Exec(`UPDATE lead_outbox SET status = ?, last_error = '', updated_at = ? WHERE id = ?`,
+		string(usecase.OutboxDone), time.Now().Unix(), id)
+	return err
+}
+
+func (r *LeadRepo) MarkFailed(id int64, attempts int, nextAttemptAt time.Time, lastErr string, dead bool) error {
+	status := usecase.OutboxPending
+	if dead {
+		status = usecase.OutboxDead
+	}
+	_, err := r.db.Exec(`UPDATE lead_outbox SET status = ?, attempts = ?, next_attempt_at = ?, last_error = ?, updated_at = ?, claimed = 0 WHERE id = ?`,
+		string(status), attempts, nextAttemptAt.Unix(), lastErr, time.Now().Unix(), id)
 	return err
 }
+
+func (r *LeadRepo) ListStuck(limit int) ([]usecase.OutboxItem, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+	rows, err := r.db.Query(outboxSelect+` WHERE o.status = ? OR (o.status = ? AND o.attempts > 0) ORDER BY o.id DESC LIMIT ?`,
+		string(usecase.OutboxDead), string(usecase.OutboxPending), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanOutbox(rows)
+}
+
+// ReleaseHeld снимает задержку только с записей, которые диспетчер ещё не брал:
+// ClaimDue сбрасывает held, поэтому аренда взятой записи не нарушается
+func (r *LeadRepo) ReleaseHeld(leadID int64) error {
+	now := time.Now().Unix()
+	_, err := r.db.Exec(`UPDATE lead_outbox SET next_attempt_at = ?, updated_at = ?, held = 0 WHERE lead_id = ? AND status = ? AND held = 1`,
+		now, now, leadID, string(usecase.OutboxPending))
+	return err
+}
+
+func (r *LeadRepo) SaveLeadDetails(id int64, clientName, callTime string) error {
+	_, err := r.db.Exec(`UPDATE leads SET client_name = ?, call_time = ? WHERE id = ?`, clientName, callTime, id)
+	return err
+}
+
+// RetryNow возвращает запись в очередь; у dead-записей счётчик попыток обнуляется
+func (r *LeadRepo) RetryNow(id int64) error {
+	now := time.Now().Unix()
+	_, err := r.db.Exec(`UPDATE lead_outbox SET status = ?, next_attempt_at = ?, updated_at = ?, claimed = 0,
+    attempts = CASE WHEN status = ? THEN 0 ELSE attempts END
+WHERE id = ? AND status IN (?, ?)`,
+		string(usecase.OutboxPending), now, now, string(usecase.OutboxDead), id,
+		string(usecase.OutboxPending), string(usecase.OutboxDead))
+	return err
+}
+
+func scanOutbox(rows *sql.Rows) ([]usecase.OutboxItem, error) {
+	defer rows.Close()
+	var out []usecase.OutboxItem
+	for rows.Next() {
+		var it usecase.OutboxItem
+		var kind, status string
+		var next int64
+		if err := rows.Scan(&it.ID, &kind, &status, &it.Attempts, &next, &it.LastError,
+			&it.Lead.ID, &it.Lead.ChatID, &it.Lead.Purpose, &it.Lead.Bedrooms, &it.Lead.Payment, &it.Lead.Phone, &it.Lead.CreatedAt,
+			&it.Lead.Username, &it.Lead.FirstName, &it.Lead.LastName, &it.Lead.LanguageCode, &it.Lead.ContactName,
+			&it.Lead.ClientName, &it.Lead.CallTime); err != nil {
+			return nil, err
+		}
+		it.Kind = usecase.OutboxKind(kind)
+		it.Status = usecase.OutboxStatus(status)
+		it.NextAttemptAt = time.Unix(next, 0)
+		out = append(out, it)
+	}
+	return out, rows.Err()
+}
+
+func (r *LeadRepo) Close() error { return r.db.Close() }
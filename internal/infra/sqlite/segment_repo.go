@@ -0,0 +1,73 @@
+package sqlite
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"alliance-management-telegram-bot/internal/usecase"
+)
+
+// SegmentRepo выбирает получателей рассылки по ответам квиза, шагам воронки и лидам.
+// Таблицы создают UserRepo, FunnelRepo и LeadRepo — репозиторий только читает их.
+type SegmentRepo struct {
+	db *sql.DB
+}
+
+func NewSegmentRepo(dsn string) (*SegmentRepo, error) {
+	db, err := openDB(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &SegmentRepo{db: db}, nil
+}
+
+func (r *SegmentRepo) Resolve(seg usecase.Segment) ([]int64, error) {
+	// заблокировавшим бота рассылка всё равно не дойдёт
+	where := []string{"u.inactive_reason = ''"}
+	var args []any
+	for col, value := range map[string]string{"purpose": seg.Purpose, "bedrooms": seg.Bedrooms, "payment": seg.Payment} {
+		if value != "" {
+			where = append(where, "u."+col+" = ?")
+			args = append(args, value)
+		}
+	}
+	if seg.Reached != "" {
+		where = append(where, "EXISTS (SELECT 1 FROM funnel_hits f WHERE f.chat_id = u.chat_id AND f.state = ?)")
+		args = append(args, string(seg.Reached))
+	}
+	switch seg.Lead {
+	case usecase.LeadYes:
+		where = append(where, "EXISTS (SELECT 1 FROM leads l WHERE l.chat_id = u.chat_id)")
+	case usecase.LeadNo:
+		where = append(where, "NOT EXISTS (SELECT 1 FROM leads l WHERE l.chat_id = u.chat_id)")
+	}
+	query := `SELECT u.chat_id, u.created_at FROM users u WHERE ` + strings.Join(where, " AND ")
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make([]int64, 0, 128)
+	for rows.Next() {
+		var id int64
+		var createdAt time.Time
+		if err := rows.Scan(&id, &createdAt); err != nil {
+			return nil, err
+		}
+		// created_at хранится текстом time.Time с разными смещениями, поэтому период
+		// регистрации сравниваем в Go, а не строками в SQL
+		if !seg.RegisteredFrom.IsZero() && createdAt.Before(seg.RegisteredFrom) {
+			continue
+		}
+		if !seg.RegisteredTo.IsZero() && !createdAt.Before(seg.RegisteredTo) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (r *SegmentRepo) Close() error { return r.db.Close() }
@@ -0,0 +1,122 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"alliance-management-telegram-bot/internal/usecase"
+)
+
+const (
+	sessionKindDialog    = "dialog"
+	sessionKindBroadcast = "broadcast"
+)
+
+// SessionStore хранит сессии в таблице sessions в виде JSON; ttl <= 0 отключает устаревание
+type SessionStore struct {
+	db  *sql.DB
+	ttl time.Duration
+}
+
+func NewSessionStore(dsn string, ttl time.Duration) (*SessionStore, error) {
+	db, err := openDB(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrateSessions(db); err != nil {
+		return nil, err
+	}
+	return &SessionStore{db: db, ttl: ttl}, nil
+}
+
+// updated_at хранится в unix-секундах, чтобы TTL можно было проверять в SQL
+func migrateSessions(db *sql.DB) error {
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS sessions (
+    chat_id INTEGER NOT NULL,
+    kind TEXT NOT NULL,
+    data TEXT NOT NULL,
+    updated_at INTEGER NOT NULL,
+    PRIMARY KEY (chat_id, kind)
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_updated_at ON sessions(updated_at);
+`)
+	return err
+}
+
+func (r *SessionStore) GetSession(chatID int64) (*usecase.Session, error) {
+	var s usecase.Session
+	ok, err := r.get(chatID, sessionKindDialog, &s)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *SessionStore) SaveSession(chatID int64, s *usecase.Session) error {
+	return r.save(chatID, sessionKindDialog, s)
+}
+
+func (r *SessionStore) GetBroadcastSession(chatID int64) (*usecase.BroadcastSession, error) {
+	var s usecase.BroadcastSession
+	ok, err := r.get(chatID, sessionKindBroadcast, &s)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *SessionStore) SaveBroadcastSession(chatID int64, s *usecase.BroadcastSession) error {
+	return r.save(chatID, sessionKindBroadcast, s)
+}
+
+func (r *SessionStore) PurgeExpired() (int, error) {
+	if r.ttl <= 0 {
+		return 0, nil
+	}
+	res, err := r.db.Exec(`DELETE FROM sessions WHERE updated_at < ?`, r.deadline())
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+func (r *SessionStore) get(chatID int64, kind string, dst any) (bool, error) {
+	var data string
+	err := r.db.QueryRow(`SELECT data FROM sessions WHERE chat_id = ? AND kind = ? AND updated_at >= ?`, chatID, kind, r.deadline()).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal([]byte(data), dst); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *SessionStore) save(chatID int64, kind string, s any) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(`INSERT INTO sessions(chat_id, kind, data, updated_at) VALUES(?,?,?,?)
+ON CONFLICT(chat_id, kind) DO UPDATE SET data = excluded.data, updated_at = excluded.updated_at`,
+		chatID, kind, string(data), time.Now().Unix())
+	return err
+}
+
+func (r *SessionStore) deadline() int64 {
+	if r.ttl <= 0 {
+		return 0
+	}
+	return time.Now().Add(-r.ttl).Unix()
+}
+
+func (r *SessionStore) Close() error { return r.db.Close() }
@@ -5,6 +5,8 @@ import (
 	"time"
 
 	_ "modernc.org/sqlite"
+
+	"alliance-management-telegram-bot/internal/domain"
 )
 
 type UserRepo struct {
@@ -12,7 +14,7 @@ type UserRepo struct {
 }
 
 func NewUserRepo(dsn string) (*UserRepo, error) {
-	db, err := sql.Open("sqlite", dsn)
+	db, err := openDB(dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -28,18 +30,91 @@ CREATE TABLE IF NOT EXISTS users (
     chat_id INTEGER PRIMARY KEY,
     created_at TIMESTAMP NOT NULL
 );
+`)
+	if err != nil {
+		return err
+	}
+	if err := addUnixTimestamp(db, "users", "chat_id"); err != nil {
+		return err
+	}
+	// пользователи, заблокировавшие бота, не попадают в рассылки
+	if _, err := addColumn(db, "users", "inactive_reason", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if _, err := addColumn(db, "users", "inactive_at", "TIMESTAMP"); err != nil {
+		return err
+	}
+	// профиль Telegram — для выгрузки лидов и имени в CRM
+	for _, col := range []string{"username", "first_name", "last_name", "language_code", "contact_name"} {
+		if _, err := addColumn(db, "users", col, "TEXT NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+	}
+	// последние ответы квиза для сегментации рассылок
+	var added bool
+	for _, col := range []string{"purpose", "bedrooms", "payment"} {
+		ok, err := addColumn(db, "users", col, "TEXT NOT NULL DEFAULT ''")
+		if err != nil {
+			return err
+		}
+		added = added || ok
+	}
+	if !added {
+		return nil
+	}
+	// разово переносим ответы из последнего лида пользователя
+	hasLeads, err := tableExists(db, "leads")
+	if err != nil || !hasLeads {
+		return err
+	}
+	_, err = db.Exec(`
+UPDATE users SET
+    purpose = COALESCE((SELECT l.purpose FROM leads l WHERE l.chat_id = users.chat_id ORDER BY l.id DESC LIMIT 1), ''),
+    bedrooms = COALESCE((SELECT l.bedrooms FROM leads l WHERE l.chat_id = users.chat_id ORDER BY l.id DESC LIMIT 1), ''),
+    payment = COALESCE((SELECT l.payment FROM leads l WHERE l.chat_id = users.chat_id ORDER BY l.id DESC LIMIT 1), '')
 `)
 	return err
 }
 
 func (r *UserRepo) SaveUser(chatID int64) error {
 	// upsert by primary key
-	_, err := r.db.Exec(`INSERT INTO users(chat_id, created_at) VALUES(?, ?) ON CONFLICT(chat_id) DO NOTHING`, chatID, time.Now())
+	now := time.Now()
+	_, err := r.db.Exec(`INSERT INTO users(chat_id, created_at, created_ts) VALUES(?,?,?) ON CONFLICT(chat_id) DO NOTHING`, chatID, now, now.Unix())
+	return err
+}
+
+func (r *UserRepo) SaveAnswers(chatID int64, purpose, bedrooms, payment string) error {
+	now := time.Now()
+	_, err := r.db.Exec(`INSERT INTO users(chat_id, created_at, created_ts, purpose, bedrooms, payment) VALUES(?,?,?,?,?,?)
+ON CONFLICT(chat_id) DO UPDATE SET purpose = excluded.purpose, bedrooms = excluded.bedrooms, payment = excluded.payment`,
+		chatID, now, now.Unix(), purpose, bedrooms, payment)
+	return err
+}
+
+// SaveProfile обновляет профиль только при изменении, чтобы не переписывать строку на каждом апдейте.
+// Имя из контакта приходит лишь с контактом, поэтому пустое значение сохранённое не затирает.
+func (r *UserRepo) SaveProfile(chatID int64, p domain.Profile) error {
+	_, err := r.db.Exec(`UPDATE users SET username = ?, first_name = ?, last_name = ?, language_code = ?,
+    contact_name = COALESCE(NULLIF(?, ''), contact_name)
+WHERE chat_id = ? AND (username <> ? OR first_name <> ? OR last_name <> ? OR language_code <> ? OR (? <> '' AND contact_name <> ?))`,
+		p.Username, p.FirstName, p.LastName, p.LanguageCode, p.ContactName,
+		chatID, p.Username, p.FirstName, p.LastName, p.LanguageCode, p.ContactName, p.ContactName)
+	return err
+}
+
+func (r *UserRepo) Deactivate(chatID int64, reason string) error {
+	_, err := r.db.Exec(`UPDATE users SET inactive_reason = ?, inactive_at = ? WHERE chat_id = ? AND inactive_reason = ''`,
+		reason, time.Now(), chatID)
+	return err
+}
+
+func (r *UserRepo) Reactivate(chatID int64) error {
+	_, err := r.db.Exec(`UPDATE users SET inactive_reason = '', inactive_at = NULL WHERE chat_id = ? AND inactive_reason <> ''`, chatID)
 	return err
 }
 
 func (r *UserRepo) ListChatIDs() ([]int64, error) {
-	rows, err := r.db.Query(`SELECT chat_id FROM users`)
+	rows, err := r.db.Query(`SELECT chat_id FROM users WHERE inactive_reason = ''`)
 	if err != nil {
 		return nil, err
 	}
@@ -54,3 +129,5 @@ func (r *UserRepo) ListChatIDs() ([]int64, error) {
 	}
 	return ids, nil
 }
+
+func (r *UserRepo) Close() error { return r.db.Close() }
@@ -0,0 +1,115 @@
+package usecase
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DailyActivity — события одного дня: новые пользователи, начавшие квиз (уникальные) и оставленные лиды
+type DailyActivity struct {
+	Day        time.Time
+	NewUsers   int
+	QuizStarts int
+	Leads      int
+}
+
+// ActivityRepository считает события по дням для графиков динамики
+type ActivityRepository interface {
+	// DailyActivity возвращает дни из [from, to) в часовом поясе from; дни без событий можно пропускать
+	DailyActivity(from, to time.Time) ([]DailyActivity, error)
+}
+
+const (
+	// ActivityDigest — ключ недельного дайджеста в callback-данных
+	ActivityDigest = "digest"
+
+	maxActivityDays = 365
+)
+
+// ActivityDays — периоды графика динамики, которые предлагаются админу
+var ActivityDays = []int{7, 14, 30, 90}
+
+// DailySeries — динамика за последние days дней включая сегодня, по точке на каждый день
+func (u *FunnelUsecase) DailySeries(days int, now time.Time) ([]DailyActivity, error) {
+	if days <= 0 || days > maxActivityDays {
+		return nil, fmt.Errorf("days out of range: %d", days)
+	}
+	loc := u.location()
+	n := now.In(loc)
+	from := time.Date(n.Year(), n.Month(), n.Day()-days+1, 0, 0, 0, 0, loc)
+	to := time.Date(n.Year(), n.Month(), n.Day()+1, 0, 0, 0, 0, loc)
+	list, err := u.Daily.DailyActivity(from, to)
+	if err != nil {
+		return nil, err
+	}
+	byDay := make(map[time.Time]DailyActivity, len(list))
+	for _, d := range list {
+		byDay[d.Day] = d
+	}
+	out := make([]DailyActivity, days)
+	for i := range out {
+		day := time.Date(from.Year(), from.Month(), from.Day()+i, 0, 0, 0, 0, loc)
+		out[i] = byDay[day]
+		out[i].Day = day
+	}
+	return out, nil
+}
+
+// SumActivity складывает события за все дни
+func SumActivity(days []DailyActivity) DailyActivity {
+	var s DailyActivity
+	for _, d := range days {
+		s.NewUsers += d.NewUsers
+		s.QuizStarts += d.QuizStarts
+		s.Leads += d.Leads
+	}
+	return s
+}
+
+// ActivitySummary — итоги за период под графиком динамики
+func ActivitySummary(days []DailyActivity) string {
+	if len(days) == 0 {
+		return "Данных за период нет"
+	}
+	s := SumActivity(days)
+	return fmt.Sprintf("Динамика %s–%s:\nновые пользователи %d, начали квиз %d, лиды %d\nконверсия из старта квиза в лид %.1f%%",
+		days[0].Day.Format("02.01"), days[len(days)-1].Day.Format("02.01"), s.NewUsers, s.QuizStarts, s.Leads, ratio(s.Leads, s.QuizStarts))
+}
+
+// ActivityTable — дневная динамика текстом, если график не построился
+func ActivityTable(days []DailyActivity) string {
+	var b strings.Builder
+	b.WriteString(ActivitySummary(days) + "\n\nДата: новые / квиз / лиды\n")
+	for _, d := range days {
+		fmt.Fprintf(&b, "%s: %d / %d / %d\n", d.Day.Format("02.01"), d.NewUsers, d.QuizStarts, d.Leads)
+	}
+	return b.String()
+}
+
+// WeeklyDigest делит 14 дней на прошлую и текущую неделю и сравнивает итоги
+func WeeklyDigest(days []DailyActivity) (prev, cur []DailyActivity, text string) {
+	if len(days) < 14 {
+		return nil, days, ActivitySummary(days)
+	}
+	prev, cur = days[len(days)-14:len(days)-7], days[len(days)-7:]
+	p, c := SumActivity(prev), SumActivity(cur)
+	var b strings.Builder
+	fmt.Fprintf(&b, "Итоги недели %s–%s в сравнении с предыдущей:\n", cur[0].Day.Format("02.01"), cur[6].Day.Format("02.01"))
+	fmt.Fprintf(&b, "- новые пользователи: %d (%s)\n", c.NewUsers, change(c.NewUsers, p.NewUsers))
+	fmt.Fprintf(&b, "- начали квиз: %d (%s)\n", c.QuizStarts, change(c.QuizStarts, p.QuizStarts))
+	fmt.Fprintf(&b, "- лиды: %d (%s)\n", c.Leads, change(c.Leads, p.Leads))
+	fmt.Fprintf(&b, "- конверсия в лид: %.1f%% (была %.1f%%)", ratio(c.Leads, c.QuizStarts), ratio(p.Leads, p.QuizStarts))
+	return prev, cur, b.String()
+}
+
+// change — изменение к прошлому периоду в процентах
+func change(cur, prev int) string {
+	if prev == 0 {
+		if cur == 0 {
+			return "без изменений"
+		}
+		return "на прошлой неделе 0"
+	}
+	return fmt.Sprintf("%+d%%", (cur-prev)*100/prev)
+}
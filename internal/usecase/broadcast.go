@@ -1,9 +1,16 @@
 package usecase
 
 import (
+	"bytes"
+	"context"
+	"encoding/csv"
 	"errors"
 	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -17,11 +24,81 @@ const (
 
 type BroadcastRepository interface {
 	ListChatIDs() ([]int64, error)
+	// Deactivate исключает из будущих рассылок пользователя, до которого бот больше не может достучаться
+	Deactivate(chatID int64, reason string) error
 }
 
+// BroadcastSender доставляет пост одному получателю и возвращает ID отправленных сообщений:
+// у альбома их несколько, и идти подряд они не обязаны. При ответе 429 реализация должна
+// вернуть *RetryAfterError, если пользователь заблокировал бота или удалил аккаунт — *UnreachableError.
 type BroadcastSender interface {
-	SendText(chatID int64, text string) error
-	SendPhoto(chatID int64, fileID string, caption string) error
+	SendBroadcast(chatID int64, c BroadcastContent) ([]int, error)
+}
+
+// BroadcastNotifier показывает админу статус рассылки одним редактируемым сообщением
+type BroadcastNotifier interface {
+	PostStatus(chatID int64, text string) (int, error)
+	EditStatus(chatID int64, messageID int, text string) error
+}
+
+// RetryAfterError — Telegram попросил подождать перед следующим запросом
+type RetryAfterError struct {
+	After time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("too many requests, retry after %s", e.After)
+}
+
+// UnreachableError — пользователь заблокировал бота или удалил аккаунт (ответ 403);
+// Reason — одна из причин domain.Inactive*
+type UnreachableError struct {
+	Reason string
+	Err    error
+}
+
+func (e *UnreachableError) Error() string { return e.Err.Error() }
+
+func (e *UnreachableError) Unwrap() error { return e.Err }
+
+// Классы ошибок доставки для статистики и выгрузки неудачных отправок
+const (
+	ErrClassBlocked      = "blocked"
+	ErrClassDeactivated  = "deactivated"
+	ErrClassRateLimited  = "rate_limited"
+	ErrClassChatNotFound = "chat_not_found"
+	ErrClassBadRequest   = "bad_request"
+	ErrClassForbidden    = "forbidden"
+	ErrClassNetwork      = "network"
+	ErrClassOther        = "other"
+)
+
+// DeliveryError — ответ Telegram с ошибкой, уже отнесённой отправителем к классу ErrClass*
+type DeliveryError struct {
+	Class string
+	Err   error
+}
+
+func (e *DeliveryError) Error() string { return e.Err.Error() }
+
+func (e *DeliveryError) Unwrap() error { return e.Err }
+
+// ErrorClass относит ошибку отправки к классу; ошибки без ответа Telegram считаются сетевыми
+func ErrorClass(err error) string {
+	var ue *UnreachableError
+	var ra *RetryAfterError
+	var de *DeliveryError
+	switch {
+	case errors.As(err, &ue):
+		return ue.Reason
+	case errors.As(err, &ra):
+		return ErrClassRateLimited
+	case errors.As(err, &de):
+		return de.Class
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return ErrClassOther
+	}
+	return ErrClassNetwork
 }
 
 type BroadcastStat struct {
@@ -37,98 +114,261 @@ type BroadcastStatRepository interface {
 }
 
 type BroadcastSession struct {
-	State       BroadcastState
-	Text        string
-	PhotoFileID string
-	Caption     string
+	State   BroadcastState
+	Content BroadcastContent
+	// альбом, части которого ещё дописываются в Content
+	MediaGroupID string
+	Segment      Segment
+	// фильтр сегмента, значение которого сейчас выбирает админ
+	SegmentField string
+	// рассылка, которую админ исправляет или удаляет
+	RecallJobID int64
+	RecallKind  BroadcastOpKind
+	// готовые варианты A/B-теста; Content — вариант, который сейчас составляется
+	Variants         []BroadcastContent
+	SplitPercents    []int
+	HoldoutPercent   int
+	WinnerAfterHours int
 }
 
 type BroadcastUsecase struct {
-	Repo   BroadcastRepository
-	Sender BroadcastSender
-	Stat   BroadcastStatRepository
+	Repo     BroadcastRepository
+	Sender   BroadcastSender
+	Stat     BroadcastStatRepository
+	Jobs     BroadcastJobRepository
+	Notifier BroadcastNotifier
+	Limiter  *RateLimiter
+	// Segments включает выбор аудитории; без него рассылка уходит всем из Repo
+	Segments SegmentResolver
+	// AnswerOptions — варианты ответов квиза по полям сессии для фильтров сегмента
+	AnswerOptions map[string][]string
+	// Schedules включает отложенные и повторяющиеся рассылки
+	Schedules BroadcastScheduleRepository
+	// Location — часовой пояс, в котором админ задаёт время запуска
+	Location *time.Location
+	// Ops и Editor включают исправление и удаление отправленных рассылок
+	Ops    BroadcastOpRepository
+	Editor BroadcastEditor
+	// Tracker включает учёт кликов по кнопкам и атрибуцию стартов квиза и лидов
+	Tracker BroadcastTracker
+	// сколько после доставки рассылки старт квиза или лид считаются её результатом
+	AttributionWindow time.Duration
+	// ABTests включает A/B-тесты вариантов рассылки
+	ABTests ABTestRepository
+	// TestChatIDs — куда кнопка «Отправить тест» присылает черновик: админы или тестовая группа
+	TestChatIDs []int64
+	// Approvals включает одобрение вторым админом рассылок больше ApprovalThreshold получателей;
+	// запросы уходят всем Approvers, кроме автора
+	Approvals         BroadcastApprovalRepository
+	ApprovalAsker     BroadcastApprovalAsker
+	ApprovalThreshold int
+	Approvers         []int64
+
+	Logger *slog.Logger
+
+	// как часто обновлять сообщение со статусом рассылки
+	ProgressInterval time.Duration
+	// сколько раз повторять отправку одному получателю после 429
+	MaxRetryAfter int
+	// как часто проверять наступившие запланированные рассылки
+	SchedulePoll time.Duration
+
+	wg sync.WaitGroup
 }
 
-func NewBroadcastUsecase(repo BroadcastRepository, sender BroadcastSender, stat BroadcastStatRepository) *BroadcastUsecase {
-	return &BroadcastUsecase{Repo: repo, Sender: sender, Stat: stat}
+func NewBroadcastUsecase(repo BroadcastRepository, sender BroadcastSender, stat BroadcastStatRepository, jobs BroadcastJobRepository, notifier BroadcastNotifier, limiter *RateLimiter) *BroadcastUsecase {
+	return &BroadcastUsecase{
+		Repo:              repo,
+		Sender:            sender,
+		Stat:              stat,
+		Jobs:              jobs,
+		Notifier:          notifier,
+		Limiter:           limiter,
+		ProgressInterval:  3 * time.Second,
+		MaxRetryAfter:     5,
+		SchedulePoll:      30 * time.Second,
+		AttributionWindow: 72 * time.Hour,
+	}
 }
 
 func (u *BroadcastUsecase) Start(s *BroadcastSession) string {
+	s.Reset()
 	s.State = BStateEnter
-	s.Text = ""
-	s.PhotoFileID = ""
-	s.Caption = ""
-	return "Введите текст рассылки сообщением или пришлите фото с подписью."
+	return "Пришлите пост рассылки: текст с форматированием, фото, видео, документ или альбом."
 }
 
-func (u *BroadcastUsecase) ReceiveText(s *BroadcastSession, text string) (string, []string, error) {
-	if strings.TrimSpace(text) == "" {
-		return "Текст не должен быть пустым. Введите текст рассылки:", nil, errors.New("empty")
+// ConfirmSend ставит рассылку в фоновую очередь. Задание живёт в ctx; при его отмене
+// отправка останавливается и продолжится с первого неотправленного получателя после Resume.
+// «Отправить тест» присылает черновик в TestChatIDs и оставляет шаг подтверждения;
+// рассылка больше ApprovalThreshold получателей уходит на одобрение другому админу.
+func (u *BroadcastUsecase) ConfirmSend(ctx context.Context, adminChatID int64, s *BroadcastSession, cmd string) (string, error) {
+	if cmd == btnCancel {
+		s.Reset()
+		return "Рассылка отменена.", nil
 	}
-	s.Text = text
-	s.PhotoFileID = ""
-	s.Caption = ""
-	s.State = BStateConfirm
-	return "Подтвердите отправку рассылки:", []string{"Отправить", "Отмена"}, nil
-}
-
-func (u *BroadcastUsecase) ReceivePhoto(s *BroadcastSession, fileID, caption string) (string, []string) {
-	if strings.TrimSpace(fileID) == "" {
-		return "Не удалось получить изображение. Пришлите фото еще раз.", nil
+	if cmd == btnSendTest && len(u.TestChatIDs) > 0 {
+		return u.sendTest(ctx, s), nil
+	}
+	if cmd == btnSchedule && u.Schedules != nil && len(s.Variants) == 0 {
+		if n, err := u.countRecipients(s.Segment); err == nil && u.needsApproval(n) {
+			return fmt.Sprintf("Рассылку на %d получателей нельзя запланировать без одобрения. "+
+				"Отправьте её сейчас — она уйдёт на согласование другому админу.", n), nil
+		}
+		s.State = BStateSchedule
+		return u.schedulePrompt(), nil
+	}
+	if cmd != btnSend {
+		return "Выберите: " + strings.Join(u.ConfirmOptions(s), ", "), nil
 	}
-	s.PhotoFileID = fileID
-	s.Caption = caption
-	s.Text = ""
-	s.State = BStateConfirm
-	return "Подтвердите отправку рассылки с фото:", []string{"Отправить", "Отмена"}
+	if u.Approvals != nil && u.ApprovalThreshold > 0 {
+		n, err := u.countRecipients(s.Segment)
+		if err != nil {
+			return "Не удалось получить список пользователей", err
+		}
+		if u.needsApproval(n) {
+			return u.requestApproval(adminChatID, s, n)
+		}
+	}
+	return u.dispatch(ctx, adminChatID, s)
 }
 
-func (u *BroadcastUsecase) ConfirmSend(s *BroadcastSession, cmd string) (string, error) {
-	if cmd == "Отмена" {
-		s.State = BStateIdle
-		s.Text = ""
-		s.PhotoFileID = ""
-		s.Caption = ""
-		return "Рассылка отменена.", nil
+// dispatch запускает подтверждённую рассылку или A/B-тест и сбрасывает черновик
+func (u *BroadcastUsecase) dispatch(ctx context.Context, adminChatID int64, s *BroadcastSession) (string, error) {
+	if len(s.Variants) > 0 {
+		t, err := u.startABTest(ctx, adminChatID, s)
+		if errors.Is(err, errAudienceTooSmall) {
+			return "Аудитория слишком мала: каждому варианту нужен хотя бы один получатель. Измените доли или аудиторию.", nil
+		}
+		if err != nil {
+			return "Не удалось запустить A/B-тест", err
+		}
+		s.Reset()
+		return fmt.Sprintf("A/B-тест #%d запущен, вариантов: %d. Прогресс — в отдельных сообщениях, результаты — в «A/B-тесты».",
+			t.ID, len(t.Variants)), nil
 	}
-	if cmd != "Отправить" {
-		return "Выберите: Отправить или Отмена", nil
+	job, err := u.startJob(ctx, adminChatID, s.Content, s.Segment)
+	if err != nil {
+		return "Не удалось запустить рассылку", err
 	}
-	ids, err := u.Repo.ListChatIDs()
+	s.Reset()
+	return fmt.Sprintf("Рассылка #%d запущена: %d получателей. Прогресс — в отдельном сообщении.", job.ID, job.Total), nil
+}
+
+// startJob фиксирует получателей сегмента и запускает фоновое задание рассылки
+func (u *BroadcastUsecase) startJob(ctx context.Context, adminChatID int64, c BroadcastContent, seg Segment) (*BroadcastJob, error) {
+	ids, err := u.recipients(seg)
 	if err != nil {
-		return "Не удалось получить список пользователей", err
-	}
-	var sent, failed int
-	for _, id := range ids {
-		var sendErr error
-		if s.PhotoFileID != "" {
-			sendErr = u.Sender.SendPhoto(id, s.PhotoFileID, s.Caption)
-		} else {
-			sendErr = u.Sender.SendText(id, s.Text)
-		}
-		if sendErr != nil {
-			failed++
-			continue
-		}
-		sent++
+		return nil, fmt.Errorf("list recipients: %w", err)
+	}
+	job := &BroadcastJob{AdminChatID: adminChatID, Content: c, Status: JobRunning, Total: len(ids)}
+	if err := u.Jobs.Create(job, ids); err != nil {
+		return nil, fmt.Errorf("create job: %w", err)
 	}
-	s.State = BStateIdle
-	s.Text = ""
-	s.PhotoFileID = ""
-	s.Caption = ""
-	_ = u.Stat.Save(BroadcastStat{Total: len(ids), Sent: sent, Failed: failed})
-	return fmt.Sprintf("Рассылка отправлена: %d успешно, %d с ошибками.", sent, failed), nil
+	u.launch(ctx, job)
+	return job, nil
 }
 
-func (u *BroadcastUsecase) StatsSummary(n int) string {
+// StatsSummary возвращает последние рассылки с разбивкой ошибок по классам
+// и ID заданий, неудачные отправки которых можно выгрузить в CSV
+func (u *BroadcastUsecase) StatsSummary(n int) (string, []int64) {
 	stats, err := u.Stat.ListRecent(n)
 	if err != nil || len(stats) == 0 {
-		return "Статистика недоступна или отсутствует"
+		return "Статистика недоступна или отсутствует", nil
 	}
 	var b strings.Builder
 	b.WriteString("Последние рассылки:\n")
 	for i, s := range stats {
 		fmt.Fprintf(&b, "%d) %s — всего: %d, отправлено: %d, ошибки: %d\n", i+1, s.CreatedAt.Format("2006-01-02 15:04"), s.Total, s.Sent, s.Failed)
 	}
-	return b.String()
+	jobs, err := u.Jobs.ListRecentJobs(n)
+	if err != nil {
+		return b.String(), nil
+	}
+	var ids []int64
+	for _, job := range jobs {
+		if job.Failed == 0 {
+			continue
+		}
+		breakdown, err := u.Jobs.ErrorBreakdown(job.ID)
+		if err != nil {
+			continue
+		}
+		if len(ids) == 0 {
+			b.WriteString("\nОшибки доставки:\n")
+		}
+		fmt.Fprintf(&b, "#%d %s: %s\n", job.ID, job.CreatedAt.Format("2006-01-02 15:04"), formatBreakdown(breakdown))
+		ids = append(ids, job.ID)
+	}
+	if u.Tracker != nil {
+		header := false
+		for _, job := range jobs {
+			if job.Sent == 0 {
+				continue
+			}
+			line, ok := u.engagementLine(job)
+			if !ok {
+				continue
+			}
+			if !header {
+				fmt.Fprintf(&b, "\nЭффективность (атрибуция %s):\n", formatWindow(u.AttributionWindow))
+				header = true
+			}
+			b.WriteString(line + "\n")
+		}
+	}
+	return b.String(), ids
+}
+
+var errClassLabels = map[string]string{
+	ErrClassBlocked:      "заблокировали бота",
+	ErrClassDeactivated:  "удалили аккаунт",
+	ErrClassRateLimited:  "лимит Telegram",
+	ErrClassChatNotFound: "чат не найден",
+	ErrClassBadRequest:   "некорректный запрос",
+	ErrClassForbidden:    "нет доступа",
+	ErrClassNetwork:      "сеть",
+	ErrClassOther:        "прочее",
+}
+
+// formatBreakdown печатает классы ошибок по убыванию количества
+func formatBreakdown(m map[string]int) string {
+	classes := make([]string, 0, len(m))
+	for c := range m {
+		classes = append(classes, c)
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		if m[classes[i]] != m[classes[j]] {
+			return m[classes[i]] > m[classes[j]]
+		}
+		return classes[i] < classes[j]
+	})
+	parts := make([]string, 0, len(classes))
+	for _, c := range classes {
+		label, ok := errClassLabels[c]
+		if !ok {
+			label = c
+		}
+		parts = append(parts, fmt.Sprintf("%s — %d", label, m[c]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// FailuresCSV выгружает неудачные отправки задания: chat_id, класс и текст ошибки, время
+func (u *BroadcastUsecase) FailuresCSV(jobID int64) ([]byte, error) {
+	failures, err := u.Jobs.ListFailures(jobID)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write([]string{"chat_id", "error_class", "error", "updated_at"})
+	for _, f := range failures {
+		updated := ""
+		if !f.UpdatedAt.IsZero() {
+			updated = f.UpdatedAt.Format(time.RFC3339)
+		}
+		_ = w.Write([]string{strconv.FormatInt(f.ChatID, 10), f.ErrorClass, f.Error, updated})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
 }
@@ -0,0 +1,369 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ABTestStatus string
+
+const (
+	// ABTestWaiting — варианты отправлены, победитель для остальной аудитории ещё не выбран
+	ABTestWaiting ABTestStatus = "waiting"
+	ABTestDone    ABTestStatus = "done"
+)
+
+// ABVariant — вариант поста и доля аудитории, которой он отправлен отдельной рассылкой JobID
+type ABVariant struct {
+	JobID   int64
+	Percent int
+}
+
+// ABTest — A/B-тест рассылки. Если HoldoutPercent > 0, часть аудитории откладывается
+// в задание HoldoutJobID и в WinnerAt получает лучший вариант.
+type ABTest struct {
+	ID             int64
+	AdminChatID    int64
+	Segment        Segment
+	Variants       []ABVariant
+	HoldoutJobID   int64
+	HoldoutPercent int
+	WinnerAt       time.Time
+	// WinnerJobID — рассылка варианта-победителя
+	WinnerJobID int64
+	Status      ABTestStatus
+	CreatedAt   time.Time
+}
+
+// ABTestRepository хранит A/B-тесты вместе с заданиями их вариантов
+type ABTestRepository interface {
+	// CreateABTest в одной транзакции сохраняет тест и задания: по одному на вариант
+	// и, при HoldoutPercent > 0, последним — отложенное задание для остальной аудитории.
+	// Заполняет ID теста и заданий, JobID вариантов и HoldoutJobID.
+	CreateABTest(t *ABTest, jobs []*BroadcastJob, recipients [][]int64) error
+	ListABTests(limit int) ([]ABTest, error)
+	// DueABTests возвращает ожидающие тесты с WinnerAt не позже now
+	DueABTests(now time.Time) ([]ABTest, error)
+	// CompleteABTest фиксирует победителя и переводит отложенное задание в работу с контентом c;
+	// возвращает false, если тест уже завершён
+	CompleteABTest(id, winnerJobID int64, c BroadcastContent) (bool, error)
+}
+
+const (
+	BStateSplit       BroadcastState = "split"
+	BStateWinnerDelay BroadcastState = "winner_delay"
+
+	btnAddVariant = "Добавить вариант"
+	btnEqualSplit = "Поровну"
+	btnNoWinner   = "Не отправлять"
+
+	maxVariants = 5
+	// как долго можно ждать результатов теста перед отправкой победителя
+	maxWinnerDelayHours = 7 * 24
+)
+
+var splitSepRe = regexp.MustCompile(`[\s/,;%]+`)
+
+func variantName(i int) string { return string(rune('A' + i)) }
+
+// AddVariant сохраняет текущий пост как вариант теста и ждёт пост следующего варианта
+func (u *BroadcastUsecase) AddVariant(adminChatID int64, s *BroadcastSession) (string, []string) {
+	if err := u.validateContent(s.Content); err != "" {
+		return u.composeMenu(s, err)
+	}
+	if _, err := u.Sender.SendBroadcast(adminChatID, s.Content); err != nil {
+		return u.composeMenu(s, fmt.Sprintf("Telegram не принял пост: %v\nИсправьте пост или разметку.", err))
+	}
+	s.Variants = append(s.Variants, s.Content)
+	s.Content = BroadcastContent{}
+	s.MediaGroupID = ""
+	s.State = BStateEnter
+	n := len(s.Variants)
+	return fmt.Sprintf("Выше — предпросмотр варианта %s, он сохранён. Пришлите пост варианта %s:", variantName(n-1), variantName(n)), nil
+}
+
+func (u *BroadcastUsecase) splitPrompt(s *BroadcastSession) (string, []string) {
+	s.State = BStateSplit
+	n := len(s.Variants)
+	example := strings.TrimSuffix(strings.Repeat("10/", n), "/")
+	return fmt.Sprintf("Вариантов: %d. Как разделить аудиторию?\n"+
+		"Доли вариантов в процентах через «/», в сумме 100: например, %s.\n"+
+		"Можно добавить последнюю долю для остальной аудитории — она получит лучший вариант позже: %s/%d.",
+		n, equalSplitText(n), example, 100-10*n), []string{btnEqualSplit, btnCancel}
+}
+
+func equalSplitText(n int) string {
+	parts := make([]string, n)
+	for i, p := range equalSplit(n) {
+		parts[i] = strconv.Itoa(p)
+	}
+	return strings.Join(parts, "/")
+}
+
+// equalSplit делит 100% между n вариантами; остаток от деления достаётся первым
+func equalSplit(n int) []int {
+	out := make([]int, n)
+	for i := range out {
+		out[i] = 100 / n
+		if i < 100%n {
+			out[i]++
+		}
+	}
+	return out
+}
+
+// SplitInput принимает доли аудитории вариантов и, при наличии остатка, спрашивает время выбора победителя
+func (u *BroadcastUsecase) SplitInput(s *BroadcastSession, text string) (string, []string) {
+	if text == btnCancel {
+		s.Reset()
+		return "Рассылка отменена.", nil
+	}
+	n := len(s.Variants)
+	if text == btnEqualSplit {
+		s.SplitPercents, s.HoldoutPercent = equalSplit(n), 0
+		return u.afterSplit(s)
+	}
+	percents, ok := parseSplit(text)
+	if !ok || (len(percents) != n && len(percents) != n+1) {
+		msg, opts := u.splitPrompt(s)
+		return fmt.Sprintf("Не понял доли. Долей должно быть %d (или %d с остатком для победителя), каждая больше нуля, в сумме 100.\n\n%s",
+			n, n+1, msg), opts
+	}
+	s.SplitPercents, s.HoldoutPercent = percents[:n], 0
+	if len(percents) > n {
+		s.HoldoutPercent = percents[n]
+		s.State = BStateWinnerDelay
+		return fmt.Sprintf("Через сколько часов выбрать победителя и отправить его остальным %d%%? "+
+				"Победитель — вариант с лучшей конверсией в лиды, при равенстве — с лучшим CTR.", s.HoldoutPercent),
+			[]string{"2", "6", "24", btnNoWinner, btnCancel}
+	}
+	return u.afterSplit(s)
+}
+
+// parseSplit разбирает «50/50», «10 10 80» или «10%/10%/80%»
+func parseSplit(text string) ([]int, bool) {
+	fields := splitSepRe.Split(strings.TrimSpace(text), -1)
+	out := make([]int, 0, len(fields))
+	sum := 0
+	for _, f := range fields {
+		if f == "" {
+			continue
+		}
+		p, err := strconv.Atoi(f)
+		if err != nil || p <= 0 {
+			return nil, false
+		}
+		out = append(out, p)
+		sum += p
+	}
+	return out, sum == 100
+}
+
+// WinnerDelayInput принимает задержку отправки победителя в часах
+func (u *BroadcastUsecase) WinnerDelayInput(s *BroadcastSession, text string) (string, []string) {
+	switch text {
+	case btnCancel:
+		s.Reset()
+		return "Рассылка отменена.", nil
+	case btnNoWinner:
+		// без отправки победителя остаток просто не участвует в рассылке
+		s.WinnerAfterHours = 0
+		return u.afterSplit(s)
+	}
+	h, err := strconv.Atoi(strings.TrimSpace(text))
+	if err != nil || h < 1 || h > maxWinnerDelayHours {
+		return fmt.Sprintf("Введите число часов от 1 до %d:", maxWinnerDelayHours), []string{"2", "6", "24", btnNoWinner, btnCancel}
+	}
+	s.WinnerAfterHours = h
+	return u.afterSplit(s)
+}
+
+func (u *BroadcastUsecase) afterSplit(s *BroadcastSession) (string, []string) {
+	if u.Segments != nil {
+		return u.SegmentMenu(s)
+	}
+	s.State = BStateConfirm
+	return describeSplit(s) + "\n\nПодтвердите отправку A/B-теста:", u.ConfirmOptions(s)
+}
+
+func describeSplit(s *BroadcastSession) string {
+	parts := make([]string, 0, len(s.SplitPercents)+1)
+	for i, p := range s.SplitPercents {
+		parts = append(parts, fmt.Sprintf("%s — %d%%", variantName(i), p))
+	}
+	switch {
+	case s.HoldoutPercent > 0 && s.WinnerAfterHours > 0:
+		parts = append(parts, fmt.Sprintf("остальные %d%% — победитель через %d ч", s.HoldoutPercent, s.WinnerAfterHours))
+	case s.HoldoutPercent > 0:
+		parts = append(parts, fmt.Sprintf("остальные %d%% не получат рассылку", s.HoldoutPercent))
+	}
+	return "A/B-тест: " + strings.Join(parts, ", ")
+}
+
+// startABTest случайно делит аудиторию сегмента по долям вариантов и запускает их параллельно
+func (u *BroadcastUsecase) startABTest(ctx context.Context, adminChatID int64, s *BroadcastSession) (*ABTest, error) {
+	ids, err := u.recipients(s.Segment)
+	if err != nil {
+		return nil, fmt.Errorf("list recipients: %w", err)
+	}
+	rand.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+	groups := splitRecipients(ids, s.SplitPercents, s.HoldoutPercent)
+	for i := range s.Variants {
+		if len(groups[i]) == 0 {
+			return nil, errAudienceTooSmall
+		}
+	}
+	t := &ABTest{AdminChatID: adminChatID, Segment: s.Segment, HoldoutPercent: s.HoldoutPercent, Status: ABTestDone}
+	jobs := make([]*BroadcastJob, 0, len(groups))
+	for i, c := range s.Variants {
+		t.Variants = append(t.Variants, ABVariant{Percent: s.SplitPercents[i]})
+		jobs = append(jobs, &BroadcastJob{AdminChatID: adminChatID, Content: c, Status: JobRunning, Total: len(groups[i])})
+	}
+	if s.HoldoutPercent > 0 && s.WinnerAfterHours > 0 {
+		t.Status = ABTestWaiting
+		t.WinnerAt = time.Now().Add(time.Duration(s.WinnerAfterHours) * time.Hour)
+		// контент отложенного задания заменится победителем
+		jobs = append(jobs, &BroadcastJob{AdminChatID: adminChatID, Content: s.Variants[0], Status: JobHeld, Total: len(groups[len(s.Variants)])})
+	} else {
+		groups = groups[:len(s.Variants)]
+	}
+	if err := u.ABTests.CreateABTest(t, jobs, groups); err != nil {
+		return nil, fmt.Errorf("create ab test: %w", err)
+	}
+	for _, job := range jobs[:len(s.Variants)] {
+		u.launch(ctx, job)
+	}
+	return t, nil
+}
+
+var errAudienceTooSmall = errors.New("audience too small for ab test")
+
+// splitRecipients режет перемешанный список по долям; остаток от округления
+// достаётся отложенной части, а без неё — вариантам по очереди
+func splitRecipients(ids []int64, percents []int, holdout int) [][]int64 {
+	sizes := make([]int, len(percents))
+	used := 0
+	for i, p := range percents {
+		sizes[i] = len(ids) * p / 100
+		used += sizes[i]
+	}
+	if holdout == 0 {
+		for i := 0; used < len(ids); i = (i + 1) % len(sizes) {
+			sizes[i]++
+			used++
+		}
+	}
+	groups := make([][]int64, 0, len(percents)+1)
+	start := 0
+	for _, n := range sizes {
+		groups = append(groups, ids[start:start+n])
+		start += n
+	}
+	return append(groups, ids[start:])
+}
+
+// RunABTests раз в SchedulePoll выбирает победителей тестов, у которых истекло время ожидания
+func (u *BroadcastUsecase) RunABTests(ctx, jobCtx context.Context) {
+	ticker := time.NewTicker(u.SchedulePoll)
+	defer ticker.Stop()
+	for {
+		u.pickWinners(jobCtx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (u *BroadcastUsecase) pickWinners(ctx context.Context, now time.Time) {
+	due, err := u.ABTests.DueABTests(now)
+	if err != nil {
+		return
+	}
+	for _, t := range due {
+		idx, winner, err := u.bestVariant(t)
+		if err != nil {
+			continue
+		}
+		if ok, err := u.ABTests.CompleteABTest(t.ID, winner.ID, winner.Content); err != nil || !ok {
+			continue
+		}
+		held, err := u.Jobs.GetJob(t.HoldoutJobID)
+		if err != nil {
+			continue
+		}
+		_, _ = u.Notifier.PostStatus(t.AdminChatID, fmt.Sprintf("A/B-тест #%d: победил вариант %s (рассылка #%d). Отправляю его остальным %d получателям — рассылка #%d.",
+			t.ID, variantName(idx), winner.ID, held.Total, held.ID))
+		u.launch(ctx, &held)
+	}
+}
+
+// bestVariant выбирает вариант с лучшей конверсией в лиды, затем с лучшим CTR; при равенстве — более ранний
+func (u *BroadcastUsecase) bestVariant(t ABTest) (int, BroadcastJob, error) {
+	best, bestLead, bestCTR := -1, -1.0, -1.0
+	var winner BroadcastJob
+	for i, v := range t.Variants {
+		job, err := u.Jobs.GetJob(v.JobID)
+		if err != nil {
+			return 0, BroadcastJob{}, err
+		}
+		var e BroadcastEngagement
+		if u.Tracker != nil {
+			if e, err = u.Tracker.Engagement(job.ID); err != nil {
+				return 0, BroadcastJob{}, err
+			}
+		}
+		lead, ctr := ratio(e.Leads, job.Sent), ratio(e.Clickers, job.Sent)
+		if lead > bestLead || (lead == bestLead && ctr > bestCTR) {
+			best, bestLead, bestCTR, winner = i, lead, ctr, job
+		}
+	}
+	return best, winner, nil
+}
+
+// ABTestReport — результаты последних A/B-тестов по вариантам
+func (u *BroadcastUsecase) ABTestReport(n int) string {
+	tests, err := u.ABTests.ListABTests(n)
+	if err != nil {
+		return "Не удалось получить A/B-тесты"
+	}
+	if len(tests) == 0 {
+		return "A/B-тестов пока не было"
+	}
+	var b strings.Builder
+	for _, t := range tests {
+		fmt.Fprintf(&b, "A/B-тест #%d от %s, аудитория: %s\n", t.ID, t.CreatedAt.In(u.location()).Format(scheduleLayout), t.Segment.Describe())
+		for i, v := range t.Variants {
+			job, err := u.Jobs.GetJob(v.JobID)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(&b, "%s (%d%%, #%d): доставлено %d из %d, ошибок %d", variantName(i), v.Percent, job.ID, job.Sent, job.Total, job.Failed)
+			if u.Tracker != nil {
+				if e, err := u.Tracker.Engagement(job.ID); err == nil {
+					fmt.Fprintf(&b, ", кликнули %d (CTR %d%%), лиды %d (конверсия %.1f%%)",
+						e.Clickers, percent(e.Clickers, job.Sent), e.Leads, ratio(e.Leads, job.Sent))
+				}
+			}
+			if job.ID == t.WinnerJobID {
+				b.WriteString(" — победитель")
+			}
+			fmt.Fprintf(&b, "\n   %s\n", contentPreview(job.Content))
+		}
+		switch {
+		case t.Status == ABTestWaiting:
+			fmt.Fprintf(&b, "Остальные %d%% получат победителя %s\n", t.HoldoutPercent, t.WinnerAt.In(u.location()).Format(scheduleLayout))
+		case t.HoldoutJobID != 0:
+			fmt.Fprintf(&b, "Остальным %d%% отправлен победитель — рассылка #%d\n", t.HoldoutPercent, t.HoldoutJobID)
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,86 @@
+package usecase
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseSplit(t *testing.T) {
+	tests := []struct {
+		text string
+		want []int
+		ok   bool
+	}{
+		{"50/50", []int{50, 50}, true},
+		{"10 10 80", []int{10, 10, 80}, true},
+		{"10%/10%/80%", []int{10, 10, 80}, true},
+		{" 30, 30; 40 ", []int{30, 30, 40}, true},
+		{"100", []int{100}, true},
+		// сумма не 100
+		{"50/40", nil, false},
+		{"60/60", nil, false},
+		{"", nil, false},
+		// нулевые, отрицательные и нечисловые доли
+		{"0/100", nil, false},
+		{"-10/110", nil, false},
+		{"50/50/0", nil, false},
+		{"пополам", nil, false},
+		{"50.5/49.5", nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseSplit(tt.text)
+		if ok != tt.ok || (tt.ok && !slices.Equal(got, tt.want)) {
+			t.Errorf("parseSplit(%q) = %v, %v; want %v, %v", tt.text, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSplitRecipients(t *testing.T) {
+	tests := []struct {
+		name     string
+		n        int
+		percents []int
+		holdout  int
+		want     []int // размеры групп, последняя — отложенная часть
+	}{
+		{"even", 10, []int{50, 50}, 0, []int{5, 5, 0}},
+		{"remainder to first variant", 7, []int{50, 50}, 0, []int{4, 3, 0}},
+		{"remainder spread over variants", 11, []int{33, 33, 34}, 0, []int{4, 4, 3, 0}},
+		{"single recipient", 1, []int{50, 50}, 0, []int{1, 0, 0}},
+		{"empty audience", 0, []int{50, 50}, 0, []int{0, 0, 0}},
+		{"holdout", 100, []int{10, 10}, 80, []int{10, 10, 80}},
+		{"remainder to holdout", 105, []int{10, 10}, 80, []int{10, 10, 85}},
+		{"audience too small for variants", 3, []int{10, 10}, 80, []int{0, 0, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := make([]int64, tt.n)
+			for i := range ids {
+				ids[i] = int64(i + 1)
+			}
+			groups := splitRecipients(ids, tt.percents, tt.holdout)
+			sizes := make([]int, len(groups))
+			for i, g := range groups {
+				sizes[i] = len(g)
+			}
+			if !slices.Equal(sizes, tt.want) {
+				t.Fatalf("group sizes %v, want %v", sizes, tt.want)
+			}
+			// каждый получатель ровно в одной группе
+			seen := map[int64]int{}
+			for _, g := range groups {
+				for _, id := range g {
+					seen[id]++
+				}
+			}
+			for _, id := range ids {
+				if seen[id] != 1 {
+					t.Fatalf("recipient %d is in %d groups", id, seen[id])
+				}
+			}
+			if len(seen) != len(ids) {
+				t.Fatalf("%d recipients in groups, want %d", len(seen), len(ids))
+			}
+		})
+	}
+}
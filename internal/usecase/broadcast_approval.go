@@ -0,0 +1,150 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type ApprovalStatus string
+
+const (
+	ApprovalPending  ApprovalStatus = "pending"
+	ApprovalApproved ApprovalStatus = "approved"
+	ApprovalRejected ApprovalStatus = "rejected"
+)
+
+// BroadcastApproval — рассылка, ожидающая одобрения другого админа.
+// Draft — черновик в момент подтверждения; после одобрения он отправляется без изменений.
+type BroadcastApproval struct {
+	ID          int64
+	RequestedBy int64
+	Draft       BroadcastSession
+	Recipients  int
+	Status      ApprovalStatus
+	DecidedBy   int64
+	CreatedAt   time.Time
+}
+
+// BroadcastApprovalRepository хранит запросы на одобрение, чтобы они переживали перезапуск
+type BroadcastApprovalRepository interface {
+	// CreateApproval сохраняет запрос и заполняет ID
+	CreateApproval(a *BroadcastApproval) error
+	GetApproval(id int64) (BroadcastApproval, error)
+	// DecideApproval меняет только ожидающий запрос; false — решение уже принято
+	DecideApproval(id int64, status ApprovalStatus, decidedBy int64) (bool, error)
+}
+
+// BroadcastApprovalAsker присылает админу запрос на одобрение с кнопками «Одобрить» и «Отклонить»
+type BroadcastApprovalAsker interface {
+	AskApproval(chatID, approvalID int64, text string) error
+}
+
+const btnSendTest = "Отправить тест"
+
+// sendTest отправляет черновик в тестовые чаты так же, как его получат пользователи;
+// у A/B-теста — все варианты с подписью перед каждым
+func (u *BroadcastUsecase) sendTest(ctx context.Context, s *BroadcastSession) string {
+	variants := s.Variants
+	if len(variants) == 0 {
+		variants = []BroadcastContent{s.Content}
+	}
+	failed := 0
+	for _, chatID := range u.TestChatIDs {
+		for i, c := range variants {
+			if len(s.Variants) > 0 {
+				_, _ = u.Notifier.PostStatus(chatID, "Тест, вариант "+variantName(i)+":")
+			}
+			if _, err := u.sendOne(ctx, chatID, c); err != nil {
+				failed++
+			}
+		}
+	}
+	msg := fmt.Sprintf("Тестовая рассылка отправлена, чатов: %d.", len(u.TestChatIDs))
+	if failed > 0 {
+		msg += fmt.Sprintf(" Не доставлено сообщений: %d.", failed)
+	}
+	return msg + "\n\nПодтвердите отправку рассылки:"
+}
+
+// needsApproval сообщает, что аудитория больше порога и рассылку должен одобрить другой админ
+func (u *BroadcastUsecase) needsApproval(recipients int) bool {
+	return u.Approvals != nil && u.ApprovalThreshold > 0 && recipients > u.ApprovalThreshold
+}
+
+// requestApproval сохраняет черновик и рассылает запрос остальным админам
+func (u *BroadcastUsecase) requestApproval(adminChatID int64, s *BroadcastSession, recipients int) (string, error) {
+	a := &BroadcastApproval{RequestedBy: adminChatID, Draft: *s, Recipients: recipients, Status: ApprovalPending}
+	if err := u.Approvals.CreateApproval(a); err != nil {
+		return "Не удалось отправить рассылку на одобрение", err
+	}
+	text := fmt.Sprintf("Запрос #%d: админ %d хочет отправить рассылку на %d получателей.\nАудитория: %s\n%s",
+		a.ID, adminChatID, recipients, s.Segment.Describe(), draftPreview(s))
+	asked := 0
+	for _, chatID := range u.Approvers {
+		if chatID == adminChatID {
+			continue
+		}
+		if err := u.ApprovalAsker.AskApproval(chatID, a.ID, text); err == nil {
+			asked++
+		}
+	}
+	s.Reset()
+	if asked == 0 {
+		return fmt.Sprintf("Рассылка на %d получателей требует одобрения другого админа, но запрос #%d никому не доставлен.", recipients, a.ID), nil
+	}
+	return fmt.Sprintf("Рассылка на %d получателей больше порога %d и ждёт одобрения другого админа (запрос #%d).",
+		recipients, u.ApprovalThreshold, a.ID), nil
+}
+
+func draftPreview(s *BroadcastSession) string {
+	if len(s.Variants) == 0 {
+		return contentPreview(s.Content)
+	}
+	lines := []string{describeSplit(s)}
+	for i, c := range s.Variants {
+		lines = append(lines, variantName(i)+": "+contentPreview(c))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Approve отправляет одобренную рассылку от имени запросившего админа; своё одобрить нельзя
+func (u *BroadcastUsecase) Approve(ctx context.Context, approverID, id int64) (string, error) {
+	a, err := u.Approvals.GetApproval(id)
+	if err != nil {
+		return "Запрос не найден", err
+	}
+	if a.RequestedBy == approverID {
+		return "Свою рассылку нужно одобрить другому админу", nil
+	}
+	ok, err := u.Approvals.DecideApproval(id, ApprovalApproved, approverID)
+	if err != nil {
+		return "Не удалось одобрить рассылку", err
+	}
+	if !ok {
+		return fmt.Sprintf("Запрос #%d уже рассмотрен", id), nil
+	}
+	msg, err := u.dispatch(ctx, a.RequestedBy, &a.Draft)
+	_, _ = u.Notifier.PostStatus(a.RequestedBy, fmt.Sprintf("Админ %d одобрил запрос #%d. %s", approverID, id, msg))
+	return msg, err
+}
+
+// Reject отклоняет запрос и сообщает об этом запросившему админу
+func (u *BroadcastUsecase) Reject(approverID, id int64) (string, error) {
+	a, err := u.Approvals.GetApproval(id)
+	if err != nil {
+		return "Запрос не найден", err
+	}
+	ok, err := u.Approvals.DecideApproval(id, ApprovalRejected, approverID)
+	if err != nil {
+		return "Не удалось отклонить рассылку", err
+	}
+	if !ok {
+		return fmt.Sprintf("Запрос #%d уже рассмотрен", id), nil
+	}
+	if a.RequestedBy != approverID {
+		_, _ = u.Notifier.PostStatus(a.RequestedBy, fmt.Sprintf("Админ %d отклонил запрос #%d на рассылку.", approverID, id))
+	}
+	return fmt.Sprintf("Запрос #%d отклонён", id), nil
+}
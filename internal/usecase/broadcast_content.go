@@ -0,0 +1,270 @@
+package usecase
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+type MediaKind string
+
+const (
+	MediaPhoto    MediaKind = "photo"
+	MediaVideo    MediaKind = "video"
+	MediaDocument MediaKind = "document"
+)
+
+// BroadcastMedia — файл поста; FileID берётся из сообщения админа, повторная загрузка не нужна
+type BroadcastMedia struct {
+	Kind   MediaKind
+	FileID string
+}
+
+// TextEntity — элемент форматирования текста в терминах Bot API (bold, text_link, …);
+// смещения в UTF-16, как их присылает Telegram
+type TextEntity struct {
+	Type     string
+	Offset   int
+	Length   int
+	URL      string `json:",omitempty"`
+	Language string `json:",omitempty"`
+}
+
+// BroadcastButton — inline-кнопка под постом: ссылка, если задан URL, иначе callback с Data.
+// Callback обрабатывается как текст пользователя, например "/start" запускает квиз.
+type BroadcastButton struct {
+	Text string
+	URL  string `json:",omitempty"`
+	Data string `json:",omitempty"`
+}
+
+const (
+	ParseModeHTML     = "HTML"
+	ParseModeMarkdown = "MarkdownV2"
+)
+
+// BroadcastContent — содержимое поста рассылки
+type BroadcastContent struct {
+	// Text — текст поста или подпись к медиа
+	Text string
+	// Entities — форматирование из сообщения админа; не используется, если задан ParseMode
+	Entities  []TextEntity `json:",omitempty"`
+	ParseMode string       `json:",omitempty"`
+	// Media — одно вложение или альбом (2–10 файлов)
+	Media   []BroadcastMedia  `json:",omitempty"`
+	Buttons []BroadcastButton `json:",omitempty"`
+
+	// PhotoFileID и Caption — формат заданий и расписаний, сохранённых до поддержки медиа
+	PhotoFileID string `json:",omitempty"`
+	Caption     string `json:",omitempty"`
+}
+
+// Normalized переводит старый формат с PhotoFileID в Media
+func (c BroadcastContent) Normalized() BroadcastContent {
+	if c.PhotoFileID != "" && len(c.Media) == 0 {
+		c.Media = []BroadcastMedia{{Kind: MediaPhoto, FileID: c.PhotoFileID}}
+		c.Text = c.Caption
+	}
+	c.PhotoFileID, c.Caption = "", ""
+	return c
+}
+
+func (c BroadcastContent) IsAlbum() bool { return len(c.Normalized().Media) > 1 }
+
+// BroadcastPost — одно входящее сообщение админа с постом
+type BroadcastPost struct {
+	Text     string
+	Entities []TextEntity
+	// Media — вложение сообщения; nil для текста
+	Media *BroadcastMedia
+	// MediaGroupID — общий ID частей альбома: Telegram присылает их отдельными сообщениями
+	MediaGroupID string
+}
+
+const (
+	BStateCompose BroadcastState = "compose"
+	BStateButton  BroadcastState = "button"
+
+	btnAddButton    = "Добавить кнопку"
+	btnClearButtons = "Убрать кнопки"
+	btnFormatPrefix = "Разметка: "
+	btnNext         = "Далее"
+
+	maxAlbumSize   = 10
+	maxCaptionLen  = 1024
+	maxCallbackLen = 64
+)
+
+// parseModes — порядок переключения разметки кнопкой «Разметка: …»
+var parseModes = []string{"", ParseModeHTML, ParseModeMarkdown}
+
+func parseModeLabel(mode string) string {
+	if mode == "" {
+		return "как в сообщении"
+	}
+	return mode
+}
+
+// ReceivePost принимает пост или очередную часть альбома. Для частей уже начатого альбома
+// возвращает пустой текст: меню отправлено с первой частью.
+func (u *BroadcastUsecase) ReceivePost(s *BroadcastSession, p BroadcastPost) (string, []string) {
+	if p.MediaGroupID != "" && p.MediaGroupID == s.MediaGroupID && p.Media != nil {
+		if len(s.Content.Media) < maxAlbumSize {
+			s.Content.Media = append(s.Content.Media, *p.Media)
+		}
+		if s.Content.Text == "" && p.Text != "" {
+			s.Content.Text, s.Content.Entities = p.Text, p.Entities
+		}
+		return "", nil
+	}
+	if p.Media == nil && strings.TrimSpace(p.Text) == "" {
+		return "Пост не должен быть пустым. Пришлите текст, фото, видео, документ или альбом:", nil
+	}
+	s.Content = BroadcastContent{Text: p.Text, Entities: p.Entities}
+	if p.Media != nil {
+		s.Content.Media = []BroadcastMedia{*p.Media}
+	}
+	s.MediaGroupID = p.MediaGroupID
+	return u.composeMenu(s, "Пост получен.")
+}
+
+func (u *BroadcastUsecase) composeMenu(s *BroadcastSession, header string) (string, []string) {
+	s.State = BStateCompose
+	c := s.Content
+	var b strings.Builder
+	b.WriteString(header)
+	if len(s.Variants) > 0 {
+		fmt.Fprintf(&b, "\nВариант %s.", variantName(len(s.Variants)))
+	}
+	switch {
+	case len(c.Media) > 1:
+		fmt.Fprintf(&b, "\nАльбом: %d файлов.", len(c.Media))
+	case len(c.Media) == 1:
+		fmt.Fprintf(&b, "\nВложение: %s.", mediaKindLabel(c.Media[0].Kind))
+	}
+	fmt.Fprintf(&b, "\nРазметка: %s. Кнопок: %d.", parseModeLabel(c.ParseMode), len(c.Buttons))
+	b.WriteString("\n\nЧтобы заменить пост, пришлите новый. «" + btnNext + "» — предпросмотр и выбор аудитории.")
+	opts := []string{}
+	if len(c.Media) <= 1 {
+		opts = append(opts, btnAddButton)
+	}
+	if len(c.Buttons) > 0 {
+		opts = append(opts, btnClearButtons)
+	}
+	opts = append(opts, btnFormatPrefix+parseModeLabel(c.ParseMode))
+	if u.ABTests != nil && len(s.Variants) < maxVariants-1 {
+		opts = append(opts, btnAddVariant)
+	}
+	opts = append(opts, btnNext, btnCancel)
+	return b.String(), opts
+}
+
+// ComposeInput обрабатывает кнопки меню поста. При «Далее» отправляет админу предпросмотр
+// поста ровно в том виде, в каком его получат пользователи.
+func (u *BroadcastUsecase) ComposeInput(adminChatID int64, s *BroadcastSession, text string) (string, []string) {
+	switch {
+	case text == btnCancel:
+		s.Reset()
+		return "Рассылка отменена.", nil
+	case text == btnAddButton:
+		if s.Content.IsAlbum() {
+			return u.composeMenu(s, "К альбому Telegram не позволяет прикрепить кнопки.")
+		}
+		s.State = BStateButton
+		return "Пришлите кнопку в формате «Текст | https://ссылка» или «Текст | /start» для кнопки, " +
+			"нажатие на которую бот обработает как сообщение пользователя.", []string{btnCancel}
+	case text == btnAddVariant && u.ABTests != nil:
+		return u.AddVariant(adminChatID, s)
+	case text == btnClearButtons:
+		s.Content.Buttons = nil
+		return u.composeMenu(s, "Кнопки удалены.")
+	case strings.HasPrefix(text, btnFormatPrefix):
+		next := parseModes[0]
+		for i, m := range parseModes {
+			if m == s.Content.ParseMode {
+				next = parseModes[(i+1)%len(parseModes)]
+			}
+		}
+		s.Content.ParseMode = next
+		return u.composeMenu(s, "Разметка переключена.")
+	case text == btnNext:
+		if err := u.validateContent(s.Content); err != "" {
+			return u.composeMenu(s, err)
+		}
+		if _, err := u.Sender.SendBroadcast(adminChatID, s.Content); err != nil {
+			return u.composeMenu(s, fmt.Sprintf("Telegram не принял пост: %v\nИсправьте пост или разметку.", err))
+		}
+		if len(s.Variants) > 0 {
+			s.Variants = append(s.Variants, s.Content)
+			s.Content = BroadcastContent{}
+			return u.splitPrompt(s)
+		}
+		if u.Segments != nil {
+			return u.SegmentMenu(s)
+		}
+		s.State = BStateConfirm
+		return "Выше — предпросмотр. Подтвердите отправку рассылки:", u.ConfirmOptions(s)
+	}
+	return u.composeMenu(s, "Выберите действие.")
+}
+
+// ButtonInput добавляет кнопку под пост из строки «Текст | ссылка или команда»
+func (u *BroadcastUsecase) ButtonInput(s *BroadcastSession, text string) (string, []string) {
+	if text == btnCancel {
+		return u.composeMenu(s, "Кнопка не добавлена.")
+	}
+	label, target, ok := strings.Cut(text, "|")
+	label, target = strings.TrimSpace(label), strings.TrimSpace(target)
+	if !ok || label == "" || target == "" {
+		return "Не понял кнопку. Формат: «Текст | https://ссылка» или «Текст | /start»", []string{btnCancel}
+	}
+	btn := BroadcastButton{Text: label}
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") || strings.HasPrefix(target, "tg://") {
+		if _, err := url.ParseRequestURI(target); err != nil {
+			return "Некорректная ссылка. Пришлите кнопку ещё раз:", []string{btnCancel}
+		}
+		btn.URL = target
+	} else {
+		if len(target) > maxCallbackLen {
+			return fmt.Sprintf("Команда кнопки длиннее %d байт. Пришлите кнопку ещё раз:", maxCallbackLen), []string{btnCancel}
+		}
+		btn.Data = target
+	}
+	s.Content.Buttons = append(s.Content.Buttons, btn)
+	return u.composeMenu(s, "Кнопка «"+label+"» добавлена.")
+}
+
+// validateContent проверяет ограничения Telegram, которые проще объяснить админу заранее
+func (u *BroadcastUsecase) validateContent(c BroadcastContent) string {
+	if len(c.Media) > 0 && len([]rune(c.Text)) > maxCaptionLen {
+		return fmt.Sprintf("Подпись к медиа длиннее %d символов — сократите текст или пришлите его без вложения.", maxCaptionLen)
+	}
+	if c.IsAlbum() && len(c.Buttons) > 0 {
+		return "К альбому Telegram не позволяет прикрепить кнопки."
+	}
+	return ""
+}
+
+func mediaKindLabel(k MediaKind) string {
+	switch k {
+	case MediaPhoto:
+		return "фото"
+	case MediaVideo:
+		return "видео"
+	case MediaDocument:
+		return "документ"
+	}
+	return string(k)
+}
+
+// Reset сбрасывает черновик рассылки
+func (s *BroadcastSession) Reset() {
+	s.State = BStateIdle
+	s.Content = BroadcastContent{}
+	s.MediaGroupID = ""
+	s.Segment = Segment{}
+	s.SegmentField = ""
+	s.RecallJobID, s.RecallKind = 0, ""
+	s.Variants, s.SplitPercents = nil, nil
+	s.HoldoutPercent, s.WinnerAfterHours = 0, 0
+}
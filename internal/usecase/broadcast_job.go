@@ -0,0 +1,203 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+)
+
+type JobStatus string
+
+const (
+	JobRunning JobStatus = "running"
+	JobDone    JobStatus = "done"
+	// JobHeld — получатели зафиксированы, но отправка ждёт выбора победителя A/B-теста
+	JobHeld JobStatus = "held"
+)
+
+type RecipientStatus string
+
+const (
+	RecipientPending RecipientStatus = "pending"
+	RecipientSent    RecipientStatus = "sent"
+	RecipientFailed  RecipientStatus = "failed"
+)
+
+// BroadcastJob — фоновое задание рассылки с прогрессом по получателям
+type BroadcastJob struct {
+	ID              int64
+	AdminChatID     int64
+	StatusMessageID int
+	Content         BroadcastContent
+	Status          JobStatus
+	Total           int
+	Sent            int
+	Failed          int
+	CreatedAt       time.Time
+}
+
+// BroadcastJobRepository хранит задания и результат по каждому получателю,
+// чтобы после рестарта продолжить рассылку с первого неотправленного
+type BroadcastJobRepository interface {
+	// Create сохраняет задание (заполняет ID) и получателей в статусе pending
+	Create(job *BroadcastJob, recipients []int64) error
+	SetStatusMessage(jobID int64, messageID int) error
+	// PendingRecipients возвращает до limit неотправленных получателей в порядке добавления
+	PendingRecipients(jobID int64, limit int) ([]int64, error)
+	// MarkRecipient фиксирует результат отправки со всеми ID сообщений поста и обновляет счётчики задания
+	MarkRecipient(jobID, chatID int64, status RecipientStatus, messageIDs []int, errClass, errText string) error
+	Finish(jobID int64) error
+	ListRunning() ([]BroadcastJob, error)
+	GetJob(jobID int64) (BroadcastJob, error)
+	// ListRecentJobs возвращает последние задания, новые первыми
+	ListRecentJobs(limit int) ([]BroadcastJob, error)
+	// ErrorBreakdown — число неудачных отправок задания по классам ошибок
+	ErrorBreakdown(jobID int64) (map[string]int, error)
+	ListFailures(jobID int64) ([]RecipientResult, error)
+}
+
+// RecipientResult — итог отправки рассылки одному получателю
+type RecipientResult struct {
+	ChatID     int64
+	Status     RecipientStatus
+	MessageID  int
+	ErrorClass string
+	Error      string
+	UpdatedAt  time.Time
+}
+
+// Resume перезапускает рассылки и задания их исправления, прерванные остановкой бота
+func (u *BroadcastUsecase) Resume(ctx context.Context) (int, error) {
+	jobs, err := u.Jobs.ListRunning()
+	if err != nil {
+		return 0, err
+	}
+	for i := range jobs {
+		u.launch(ctx, &jobs[i])
+	}
+	n, err := u.resumeOps(ctx)
+	return len(jobs) + n, err
+}
+
+// Wait дожидается завершения или остановки всех запущенных рассылок
+func (u *BroadcastUsecase) Wait() { u.wg.Wait() }
+
+func (u *BroadcastUsecase) log() *slog.Logger {
+	if u.Logger != nil {
+		return u.Logger
+	}
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func (u *BroadcastUsecase) launch(ctx context.Context, job *BroadcastJob) {
+	u.wg.Add(1)
+	go func() {
+		defer u.wg.Done()
+		u.run(ctx, job)
+	}()
+}
+
+const recipientBatch = 100
+
+func (u *BroadcastUsecase) run(ctx context.Context, job *BroadcastJob) {
+	if job.StatusMessageID == 0 {
+		if id, err := u.Notifier.PostStatus(job.AdminChatID, progressText(job)); err == nil {
+			job.StatusMessageID = id
+			_ = u.Jobs.SetStatusMessage(job.ID, id)
+		}
+	}
+	content := u.trackButtons(job.ID, job.Content)
+	lastReport := time.Now()
+	for {
+		batch, err := u.Jobs.PendingRecipients(job.ID, recipientBatch)
+		if err != nil {
+			u.report(job, fmt.Sprintf("Рассылка #%d остановлена: ошибка чтения получателей", job.ID))
+			return
+		}
+		if len(batch) == 0 {
+			break
+		}
+		for _, chatID := range batch {
+			msgIDs, sendErr := u.sendOne(ctx, chatID, content)
+			if ctx.Err() != nil {
+				// получатель остаётся pending и будет обработан после Resume
+				u.report(job, progressText(job)+"\nПриостановлена, продолжится после перезапуска.")
+				return
+			}
+			status, errClass, errText := RecipientSent, "", ""
+			if sendErr != nil {
+				status, errClass, errText = RecipientFailed, ErrorClass(sendErr), sendErr.Error()
+				job.Failed++
+				var ue *UnreachableError
+				if errors.As(sendErr, &ue) {
+					_ = u.Repo.Deactivate(chatID, ue.Reason)
+				}
+			} else {
+				job.Sent++
+			}
+			if err := u.Jobs.MarkRecipient(job.ID, chatID, status, msgIDs, errClass, errText); err != nil {
+				// без записи получатель остался бы pending и получил пост повторно в следующей пачке
+				u.log().Error("broadcast recipient mark failed", "broadcast_id", job.ID, "chat_id", chatID, "error", err)
+				u.report(job, progressText(job)+"\nПриостановлена: не удалось сохранить результат отправки, продолжится после перезапуска.")
+				return
+			}
+			if time.Since(lastReport) >= u.ProgressInterval {
+				u.report(job, progressText(job))
+				lastReport = time.Now()
+			}
+		}
+	}
+	if err := u.Jobs.Finish(job.ID); err != nil {
+		// задание останется running и после перезапуска завершится без новых отправок
+		u.log().Error("broadcast finish failed", "broadcast_id", job.ID, "error", err)
+		u.report(job, progressText(job)+"\nВсе получатели обработаны, но завершение не сохранено — повторится после перезапуска.")
+		return
+	}
+	job.Status = JobDone
+	if err := u.Stat.Save(BroadcastStat{Total: job.Total, Sent: job.Sent, Failed: job.Failed}); err != nil {
+		u.log().Error("broadcast stat save failed", "broadcast_id", job.ID, "error", err)
+	}
+	u.report(job, fmt.Sprintf("Рассылка #%d завершена: %d успешно, %d с ошибками.", job.ID, job.Sent, job.Failed))
+}
+
+// sendOne отправляет пост с учётом общего лимита и retry_after из ответов 429
+func (u *BroadcastUsecase) sendOne(ctx context.Context, chatID int64, c BroadcastContent) ([]int, error) {
+	var msgIDs []int
+	err := u.call(ctx, func() error {
+		var err error
+		msgIDs, err = u.Sender.SendBroadcast(chatID, c)
+		return err
+	})
+	return msgIDs, err
+}
+
+// call выполняет запрос к Telegram в рамках общего лимита и повторяет его после 429
+func (u *BroadcastUsecase) call(ctx context.Context, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		if err := u.Limiter.Wait(ctx); err != nil {
+			return err
+		}
+		err := fn()
+		var ra *RetryAfterError
+		if !errors.As(err, &ra) || attempt >= u.MaxRetryAfter {
+			return err
+		}
+		u.Limiter.Pause(ra.After)
+	}
+}
+
+func (u *BroadcastUsecase) report(job *BroadcastJob, text string) {
+	if job.StatusMessageID == 0 {
+		return
+	}
+	_ = u.Notifier.EditStatus(job.AdminChatID, job.StatusMessageID, text)
+}
+
+func progressText(job *BroadcastJob) string {
+	done := job.Sent + job.Failed
+	return fmt.Sprintf("Рассылка #%d: %d из %d (%d%%), успешно %d, ошибок %d %s",
+		job.ID, done, job.Total, percent(done, job.Total), job.Sent, job.Failed, bar20(done, job.Total))
+}
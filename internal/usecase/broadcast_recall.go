@@ -0,0 +1,262 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type BroadcastOpKind string
+
+const (
+	OpEdit   BroadcastOpKind = "edit"
+	OpDelete BroadcastOpKind = "delete"
+)
+
+// BroadcastOp — фоновое исправление или удаление уже отправленной рассылки у всех получателей.
+// Cursor — позиция последнего обработанного получателя, с неё задание продолжается после рестарта.
+type BroadcastOp struct {
+	ID              int64
+	BroadcastID     int64
+	AdminChatID     int64
+	StatusMessageID int
+	Kind            BroadcastOpKind
+	// Content — пост в новом виде; для удаления из него берётся число сообщений альбома
+	Content   BroadcastContent
+	Status    JobStatus
+	Total     int
+	Done      int
+	Failed    int
+	Cursor    int64
+	CreatedAt time.Time
+}
+
+// SentMessage — доставленное сообщение рассылки; Pos задаёт порядок обхода получателей
+type SentMessage struct {
+	Pos    int64
+	ChatID int64
+	// MessageID — первое сообщение поста, у альбома в нём подпись
+	MessageID int
+	// MessageIDs — все сообщения поста; у рассылок, отправленных до их сохранения, только MessageID
+	MessageIDs []int
+}
+
+// BroadcastOpRepository хранит задания исправления рассылок и их прогресс
+type BroadcastOpRepository interface {
+	// CreateOp сохраняет задание (заполняет ID); Total — число доставленных сообщений рассылки
+	CreateOp(op *BroadcastOp) error
+	SetOpStatusMessage(opID int64, messageID int) error
+	// SentMessages возвращает до limit доставленных сообщений рассылки с Pos больше after
+	SentMessages(jobID int64, after int64, limit int) ([]SentMessage, error)
+	// AdvanceOp сохраняет прогресс после обработки пачки получателей
+	AdvanceOp(opID int64, cursor int64, done, failed int) error
+	FinishOp(opID int64) error
+	ListRunningOps() ([]BroadcastOp, error)
+}
+
+// BroadcastEditor меняет и удаляет уже отправленные сообщения рассылки
+type BroadcastEditor interface {
+	// EditBroadcast заменяет текст или подпись поста, сохраняя кнопки из c
+	EditBroadcast(chatID int64, messageID int, c BroadcastContent) error
+	DeleteMessage(chatID int64, messageID int) error
+}
+
+const (
+	BStateRecallText    BroadcastState = "recall_text"
+	BStateRecallConfirm BroadcastState = "recall_confirm"
+
+	btnApply = "Применить"
+)
+
+// RecallList — последние рассылки, которые можно исправить или удалить
+func (u *BroadcastUsecase) RecallList(n int) (string, []int64) {
+	jobs, err := u.Jobs.ListRecentJobs(n)
+	if err != nil {
+		return "Не удалось получить список рассылок", nil
+	}
+	var b strings.Builder
+	var ids []int64
+	for _, job := range jobs {
+		if job.Sent == 0 {
+			continue
+		}
+		if len(ids) == 0 {
+			b.WriteString("Выберите рассылку. Удалить сообщения Telegram позволяет только в течение 48 часов после отправки.\n\n")
+		}
+		fmt.Fprintf(&b, "#%d %s, доставлено %d: %s\n", job.ID, job.CreatedAt.Format("2006-01-02 15:04"), job.Sent, contentPreview(job.Content))
+		ids = append(ids, job.ID)
+	}
+	if len(ids) == 0 {
+		return "Нет отправленных рассылок", nil
+	}
+	return b.String(), ids
+}
+
+// StartRecall начинает исправление (OpEdit) или удаление (OpDelete) рассылки jobID
+func (u *BroadcastUsecase) StartRecall(s *BroadcastSession, jobID int64, kind BroadcastOpKind) (string, []string) {
+	job, err := u.Jobs.GetJob(jobID)
+	if err != nil {
+		return "Рассылка не найдена", nil
+	}
+	s.Reset()
+	s.RecallJobID, s.RecallKind = jobID, kind
+	if kind == OpDelete {
+		s.State = BStateRecallConfirm
+		return fmt.Sprintf("Удалить рассылку #%d у %d получателей?", jobID, job.Sent), []string{btnApply, btnCancel}
+	}
+	s.State = BStateRecallText
+	what := "новый текст"
+	if len(job.Content.Normalized().Media) > 0 {
+		what = "новую подпись к медиа"
+	}
+	return fmt.Sprintf("Сейчас: %s\n\nПришлите %s для рассылки #%d. Форматирование сохранится, кнопки останутся прежними.",
+		contentPreview(job.Content), what, jobID), []string{btnCancel}
+}
+
+// RecallText принимает новый текст поста для исправления
+func (u *BroadcastUsecase) RecallText(s *BroadcastSession, p BroadcastPost) (string, []string) {
+	if p.Text == btnCancel && p.Media == nil {
+		s.Reset()
+		return "Отменено.", nil
+	}
+	if p.Media != nil || strings.TrimSpace(p.Text) == "" {
+		return "Изменить можно только текст. Пришлите новый текст сообщением:", []string{btnCancel}
+	}
+	job, err := u.Jobs.GetJob(s.RecallJobID)
+	if err != nil {
+		s.Reset()
+		return "Рассылка не найдена", nil
+	}
+	if len(job.Content.Normalized().Media) > 0 && len([]rune(p.Text)) > maxCaptionLen {
+		return fmt.Sprintf("Подпись к медиа не может быть длиннее %d символов. Пришлите текст короче:", maxCaptionLen), []string{btnCancel}
+	}
+	s.Content = BroadcastContent{Text: p.Text, Entities: p.Entities}
+	s.State = BStateRecallConfirm
+	return fmt.Sprintf("Заменить текст рассылки #%d у %d получателей?", job.ID, job.Sent), []string{btnApply, btnCancel}
+}
+
+// RecallConfirm запускает фоновое задание исправления или удаления
+func (u *BroadcastUsecase) RecallConfirm(ctx context.Context, adminChatID int64, s *BroadcastSession, cmd string) (string, error) {
+	if cmd == btnCancel {
+		s.Reset()
+		return "Отменено.", nil
+	}
+	if cmd != btnApply {
+		return "Выберите: " + btnApply + " или " + btnCancel, nil
+	}
+	job, err := u.Jobs.GetJob(s.RecallJobID)
+	if err != nil {
+		s.Reset()
+		return "Рассылка не найдена", err
+	}
+	content := job.Content.Normalized()
+	if s.RecallKind == OpEdit {
+		content.Text, content.Entities, content.ParseMode = s.Content.Text, s.Content.Entities, ""
+	}
+	op := &BroadcastOp{BroadcastID: job.ID, AdminChatID: adminChatID, Kind: s.RecallKind, Content: content, Status: JobRunning}
+	if err := u.Ops.CreateOp(op); err != nil {
+		return "Не удалось запустить задание", err
+	}
+	s.Reset()
+	u.launchOp(ctx, op)
+	return fmt.Sprintf("Задание #%d запущено: %d сообщений. Прогресс — в отдельном сообщении.", op.ID, op.Total), nil
+}
+
+func (u *BroadcastUsecase) resumeOps(ctx context.Context) (int, error) {
+	if u.Ops == nil {
+		return 0, nil
+	}
+	ops, err := u.Ops.ListRunningOps()
+	if err != nil {
+		return 0, err
+	}
+	for i := range ops {
+		u.launchOp(ctx, &ops[i])
+	}
+	return len(ops), nil
+}
+
+func (u *BroadcastUsecase) launchOp(ctx context.Context, op *BroadcastOp) {
+	u.wg.Add(1)
+	go func() {
+		defer u.wg.Done()
+		u.runOp(ctx, op)
+	}()
+}
+
+func (u *BroadcastUsecase) runOp(ctx context.Context, op *BroadcastOp) {
+	if op.StatusMessageID == 0 {
+		if id, err := u.Notifier.PostStatus(op.AdminChatID, opProgressText(op)); err == nil {
+			op.StatusMessageID = id
+			_ = u.Ops.SetOpStatusMessage(op.ID, id)
+		}
+	}
+	// кнопки при правке передаются заново, поэтому отслеживание нужно сохранить
+	content := u.trackButtons(op.BroadcastID, op.Content)
+	lastReport := time.Now()
+	for {
+		batch, err := u.Ops.SentMessages(op.BroadcastID, op.Cursor, recipientBatch)
+		if err != nil {
+			u.reportOp(op, fmt.Sprintf("Задание #%d остановлено: ошибка чтения получателей", op.ID))
+			return
+		}
+		if len(batch) == 0 {
+			break
+		}
+		for _, m := range batch {
+			var opErr error
+			if op.Kind == OpDelete {
+				// удаляем ровно сохранённые сообщения: ID альбома могут перемежаться чужими
+				for _, id := range m.MessageIDs {
+					if opErr = u.call(ctx, func() error { return u.Editor.DeleteMessage(m.ChatID, id) }); opErr != nil {
+						break
+					}
+				}
+			} else {
+				opErr = u.call(ctx, func() error { return u.Editor.EditBroadcast(m.ChatID, m.MessageID, content) })
+			}
+			if ctx.Err() != nil {
+				// сообщение не отмечено обработанным: после рестарта повторное изменение безопасно
+				_ = u.Ops.AdvanceOp(op.ID, op.Cursor, op.Done, op.Failed)
+				u.reportOp(op, opProgressText(op)+"\nПриостановлено, продолжится после перезапуска.")
+				return
+			}
+			if opErr != nil {
+				op.Failed++
+			} else {
+				op.Done++
+			}
+			op.Cursor = m.Pos
+			if time.Since(lastReport) >= u.ProgressInterval {
+				_ = u.Ops.AdvanceOp(op.ID, op.Cursor, op.Done, op.Failed)
+				u.reportOp(op, opProgressText(op))
+				lastReport = time.Now()
+			}
+		}
+		_ = u.Ops.AdvanceOp(op.ID, op.Cursor, op.Done, op.Failed)
+	}
+	_ = u.Ops.FinishOp(op.ID)
+	op.Status = JobDone
+	u.reportOp(op, fmt.Sprintf("%s рассылки #%d завершено: %d успешно, %d с ошибками.", opKindLabel(op.Kind), op.BroadcastID, op.Done, op.Failed))
+}
+
+func (u *BroadcastUsecase) reportOp(op *BroadcastOp, text string) {
+	if op.StatusMessageID == 0 {
+		return
+	}
+	_ = u.Notifier.EditStatus(op.AdminChatID, op.StatusMessageID, text)
+}
+
+func opKindLabel(k BroadcastOpKind) string {
+	if k == OpDelete {
+		return "Удаление"
+	}
+	return "Исправление"
+}
+
+func opProgressText(op *BroadcastOp) string {
+	done := op.Done + op.Failed
+	return fmt.Sprintf("%s рассылки #%d: %d из %d (%d%%), успешно %d, ошибок %d %s",
+		opKindLabel(op.Kind), op.BroadcastID, done, op.Total, percent(done, op.Total), op.Done, op.Failed, bar20(done, op.Total))
+}
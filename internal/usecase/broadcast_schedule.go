@@ -0,0 +1,295 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ScheduleRepeat string
+
+const (
+	RepeatOnce   ScheduleRepeat = "once"
+	RepeatDaily  ScheduleRepeat = "daily"
+	RepeatWeekly ScheduleRepeat = "weekly"
+)
+
+type ScheduleStatus string
+
+const (
+	ScheduleActive    ScheduleStatus = "active"
+	ScheduleDone      ScheduleStatus = "done"
+	ScheduleCancelled ScheduleStatus = "cancelled"
+)
+
+// BroadcastSchedule — отложенная или повторяющаяся рассылка.
+// Weekday, Hour и Minute задают повтор в часовом поясе BroadcastUsecase.Location.
+type BroadcastSchedule struct {
+	ID          int64
+	AdminChatID int64
+	Content     BroadcastContent
+	Segment     Segment
+	Repeat      ScheduleRepeat
+	Weekday     time.Weekday
+	Hour        int
+	Minute      int
+	NextRunAt   time.Time
+	Status      ScheduleStatus
+	CreatedAt   time.Time
+}
+
+// BroadcastScheduleRepository хранит расписания, чтобы они переживали перезапуск бота
+type BroadcastScheduleRepository interface {
+	// CreateSchedule сохраняет расписание и заполняет ID
+	CreateSchedule(s *BroadcastSchedule) error
+	// ListSchedules возвращает активные расписания по времени ближайшего запуска
+	ListSchedules() ([]BroadcastSchedule, error)
+	// DueSchedules возвращает активные расписания с NextRunAt не позже now
+	DueSchedules(now time.Time) ([]BroadcastSchedule, error)
+	// Reschedule и SetScheduleStatus меняют только активные расписания и возвращают false,
+	// если расписание уже отменено или завершено. Reschedule переносит запуск, только если он
+	// всё ещё назначен на prev, — так один запуск забирает ровно один экземпляр бота
+	Reschedule(id int64, prev, next time.Time) (bool, error)
+	SetScheduleStatus(id int64, status ScheduleStatus) (bool, error)
+}
+
+const (
+	BStateSchedule BroadcastState = "schedule"
+
+	btnSend     = "Отправить"
+	btnSchedule = "Запланировать"
+	btnCancel   = "Отмена"
+
+	scheduleLayout = "02.01.2006 15:04"
+)
+
+var weekdayNames = map[string]time.Weekday{
+	"понедельник": time.Monday,
+	"вторник":     time.Tuesday,
+	"среду":       time.Wednesday,
+	"среда":       time.Wednesday,
+	"четверг":     time.Thursday,
+	"пятницу":     time.Friday,
+	"пятница":     time.Friday,
+	"субботу":     time.Saturday,
+	"суббота":     time.Saturday,
+	"воскресенье": time.Sunday,
+}
+
+var weekdayEvery = map[time.Weekday]string{
+	time.Monday:    "каждый понедельник",
+	time.Tuesday:   "каждый вторник",
+	time.Wednesday: "каждую среду",
+	time.Thursday:  "каждый четверг",
+	time.Friday:    "каждую пятницу",
+	time.Saturday:  "каждую субботу",
+	time.Sunday:    "каждое воскресенье",
+}
+
+// «каждый понедельник 10:00», «каждую среду в 9:30», «каждый день 10:00»
+var repeatRe = regexp.MustCompile(`^кажд\S*\s+(\S+)\s+(?:в\s+)?(\d{1,2}):(\d{2})$`)
+
+// ConfirmOptions — кнопки шага подтверждения; «Отправить тест» есть при заданных тестовых чатах,
+// «Запланировать» — при подключённом хранилище и не для A/B-тестов
+func (u *BroadcastUsecase) ConfirmOptions(s *BroadcastSession) []string {
+	var opts []string
+	if len(u.TestChatIDs) > 0 {
+		opts = append(opts, btnSendTest)
+	}
+	opts = append(opts, btnSend)
+	if u.Schedules != nil && len(s.Variants) == 0 {
+		opts = append(opts, btnSchedule)
+	}
+	return append(opts, btnCancel)
+}
+
+func (u *BroadcastUsecase) location() *time.Location {
+	if u.Location != nil {
+		return u.Location
+	}
+	return time.Local
+}
+
+func (u *BroadcastUsecase) schedulePrompt() string {
+	return fmt.Sprintf("Когда отправить? Время — %s.\n"+
+		"Один раз: 25.10.2026 10:00\n"+
+		"Повтор: каждый понедельник 10:00 или каждый день 09:30\n"+
+		"Или нажмите «%s».", u.location(), btnCancel)
+}
+
+// ScheduleInput разбирает время запуска и сохраняет расписание для черновика рассылки
+func (u *BroadcastUsecase) ScheduleInput(adminChatID int64, s *BroadcastSession, text string) (string, []string) {
+	if text == btnCancel {
+		s.Reset()
+		return "Рассылка отменена.", nil
+	}
+	sch, ok := u.parseSchedule(text, time.Now())
+	if !ok {
+		return "Не понял время или оно уже прошло.\n\n" + u.schedulePrompt(), []string{btnCancel}
+	}
+	sch.AdminChatID = adminChatID
+	sch.Content = s.Content
+	sch.Segment = s.Segment
+	sch.Status = ScheduleActive
+	if err := u.Schedules.CreateSchedule(&sch); err != nil {
+		return "Не удалось сохранить расписание. Попробуйте ещё раз:", []string{btnCancel}
+	}
+	s.Reset()
+	return fmt.Sprintf("Рассылка запланирована (#%d): %s.\nБлижайший запуск: %s.",
+		sch.ID, sch.describeRepeat(), sch.NextRunAt.In(u.location()).Format(scheduleLayout)), nil
+}
+
+// parseSchedule понимает дату «02.01.2006 15:04» и повторы «каждый <день недели|день> 15:04»
+func (u *BroadcastUsecase) parseSchedule(text string, now time.Time) (BroadcastSchedule, bool) {
+	loc := u.location()
+	text = strings.Join(strings.Fields(strings.ToLower(text)), " ")
+	if t, err := time.ParseInLocation(scheduleLayout, text, loc); err == nil {
+		if !t.After(now) {
+			return BroadcastSchedule{}, false
+		}
+		return BroadcastSchedule{Repeat: RepeatOnce, Hour: t.Hour(), Minute: t.Minute(), NextRunAt: t}, true
+	}
+	m := repeatRe.FindStringSubmatch(text)
+	if m == nil {
+		return BroadcastSchedule{}, false
+	}
+	hour, _ := strconv.Atoi(m[2])
+	minute, _ := strconv.Atoi(m[3])
+	if hour > 23 || minute > 59 {
+		return BroadcastSchedule{}, false
+	}
+	sch := BroadcastSchedule{Repeat: RepeatDaily, Hour: hour, Minute: minute}
+	if m[1] != "день" {
+		wd, ok := weekdayNames[m[1]]
+		if !ok {
+			return BroadcastSchedule{}, false
+		}
+		sch.Repeat, sch.Weekday = RepeatWeekly, wd
+	}
+	sch.NextRunAt = sch.next(now, loc)
+	return sch, true
+}
+
+// next возвращает ближайший после after момент запуска повторяющегося расписания
+func (sch BroadcastSchedule) next(after time.Time, loc *time.Location) time.Time {
+	a := after.In(loc)
+	t := time.Date(a.Year(), a.Month(), a.Day(), sch.Hour, sch.Minute, 0, 0, loc)
+	for !t.After(after) || (sch.Repeat == RepeatWeekly && t.Weekday() != sch.Weekday) {
+		t = time.Date(t.Year(), t.Month(), t.Day()+1, sch.Hour, sch.Minute, 0, 0, loc)
+	}
+	return t
+}
+
+func (sch BroadcastSchedule) describeRepeat() string {
+	at := fmt.Sprintf("%02d:%02d", sch.Hour, sch.Minute)
+	switch sch.Repeat {
+	case RepeatDaily:
+		return "каждый день в " + at
+	case RepeatWeekly:
+		return weekdayEvery[sch.Weekday] + " в " + at
+	}
+	return "однократно"
+}
+
+// ScheduleList — список активных расписаний для админ-меню и их ID для кнопок отмены
+func (u *BroadcastUsecase) ScheduleList(n int) (string, []int64) {
+	list, err := u.Schedules.ListSchedules()
+	if err != nil {
+		return "Не удалось получить расписание рассылок", nil
+	}
+	if len(list) == 0 {
+		return "Запланированных рассылок нет", nil
+	}
+	if len(list) > n {
+		list = list[:n]
+	}
+	var b strings.Builder
+	b.WriteString("Запланированные рассылки:\n")
+	ids := make([]int64, 0, len(list))
+	for _, sch := range list {
+		fmt.Fprintf(&b, "#%d %s, ближайшая: %s\n   аудитория: %s\n   %s\n", sch.ID, sch.describeRepeat(),
+			sch.NextRunAt.In(u.location()).Format(scheduleLayout), sch.Segment.Describe(), contentPreview(sch.Content))
+		ids = append(ids, sch.ID)
+	}
+	return b.String(), ids
+}
+
+// CancelSchedule отменяет расписание; уже идущая по нему рассылка не прерывается
+func (u *BroadcastUsecase) CancelSchedule(id int64) (string, error) {
+	ok, err := u.Schedules.SetScheduleStatus(id, ScheduleCancelled)
+	if err != nil {
+		return "Не удалось отменить расписание", err
+	}
+	if !ok {
+		return fmt.Sprintf("Расписание #%d уже не активно", id), nil
+	}
+	return fmt.Sprintf("Расписание #%d отменено", id), nil
+}
+
+// RunSchedules раз в SchedulePoll запускает наступившие рассылки, пока не отменён ctx.
+// Сами задания живут в jobCtx, как и подтверждённые вручную. Пропущенные за время простоя
+// запуски выполняются один раз, а повтор переносится на ближайшее время в будущем.
+func (u *BroadcastUsecase) RunSchedules(ctx, jobCtx context.Context) {
+	ticker := time.NewTicker(u.SchedulePoll)
+	defer ticker.Stop()
+	for {
+		u.fireDue(jobCtx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (u *BroadcastUsecase) fireDue(ctx context.Context, now time.Time) {
+	due, err := u.Schedules.DueSchedules(now)
+	if err != nil {
+		return
+	}
+	for _, sch := range due {
+		// сначала двигаем расписание: при падении между шагами лучше пропустить запуск, чем отправить дважды
+		if sch.Repeat == RepeatOnce {
+			if ok, err := u.Schedules.SetScheduleStatus(sch.ID, ScheduleDone); err != nil || !ok {
+				continue
+			}
+		} else if ok, err := u.Schedules.Reschedule(sch.ID, sch.NextRunAt, sch.next(now, u.location())); err != nil || !ok {
+			continue
+		}
+		// аудитория повторяющейся рассылки растёт, поэтому порог проверяется при каждом запуске
+		if u.Approvals != nil && u.ApprovalThreshold > 0 {
+			n, err := u.countRecipients(sch.Segment)
+			if err != nil {
+				_, _ = u.Notifier.PostStatus(sch.AdminChatID, fmt.Sprintf("Не удалось запустить запланированную рассылку #%d: %v", sch.ID, err))
+				continue
+			}
+			if u.needsApproval(n) {
+				draft := &BroadcastSession{Content: sch.Content, Segment: sch.Segment}
+				msg, _ := u.requestApproval(sch.AdminChatID, draft, n)
+				_, _ = u.Notifier.PostStatus(sch.AdminChatID, fmt.Sprintf("Запланированная рассылка #%d: %s", sch.ID, msg))
+				continue
+			}
+		}
+		if _, err := u.startJob(ctx, sch.AdminChatID, sch.Content, sch.Segment); err != nil {
+			_, _ = u.Notifier.PostStatus(sch.AdminChatID, fmt.Sprintf("Не удалось запустить запланированную рассылку #%d: %v", sch.ID, err))
+		}
+	}
+}
+
+func contentPreview(c BroadcastContent) string {
+	c = c.Normalized()
+	text := c.Text
+	switch {
+	case len(c.Media) > 1:
+		text = fmt.Sprintf("[альбом, %d] ", len(c.Media)) + text
+	case len(c.Media) == 1:
+		text = "[" + mediaKindLabel(c.Media[0].Kind) + "] " + text
+	}
+	if r := []rune(text); len(r) > 60 {
+		text = string(r[:60]) + "…"
+	}
+	return text
+}
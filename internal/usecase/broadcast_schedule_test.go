@@ -0,0 +1,118 @@
+package usecase
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func samara(t *testing.T) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation("Europe/Samara")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func TestParseSchedule(t *testing.T) {
+	loc := samara(t)
+	u := &BroadcastUsecase{Location: loc}
+	at := func(y int, m time.Month, d, h, min int) time.Time { return time.Date(y, m, d, h, min, 0, 0, loc) }
+	// четверг, последний день года
+	now := at(2026, time.December, 31, 12, 0)
+
+	tests := []struct {
+		text    string
+		repeat  ScheduleRepeat
+		weekday time.Weekday
+		next    time.Time
+	}{
+		{"31.12.2026 15:00", RepeatOnce, 0, at(2026, time.December, 31, 15, 0)},
+		{"01.01.2027 00:05", RepeatOnce, 0, at(2027, time.January, 1, 0, 5)},
+		{"каждый день 18:30", RepeatDaily, 0, at(2026, time.December, 31, 18, 30)},
+		// время сегодня уже прошло — запуск завтра, в следующем году
+		{"каждый день 10:00", RepeatDaily, 0, at(2027, time.January, 1, 10, 0)},
+		{"каждый день в 9:05", RepeatDaily, 0, at(2027, time.January, 1, 9, 5)},
+		{"  Каждую   СРЕДУ в 9:30 ", RepeatWeekly, time.Wednesday, at(2027, time.January, 6, 9, 30)},
+		{"каждый четверг 13:00", RepeatWeekly, time.Thursday, at(2026, time.December, 31, 13, 0)},
+		// ровно сейчас — уже не будущее, следующий четверг
+		{"каждый четверг 12:00", RepeatWeekly, time.Thursday, at(2027, time.January, 7, 12, 0)},
+		{"каждое воскресенье 23:59", RepeatWeekly, time.Sunday, at(2027, time.January, 3, 23, 59)},
+	}
+	for _, tt := range tests {
+		sch, ok := u.parseSchedule(tt.text, now)
+		if !ok {
+			t.Errorf("%q: not parsed", tt.text)
+			continue
+		}
+		if sch.Repeat != tt.repeat || sch.Weekday != tt.weekday || !sch.NextRunAt.Equal(tt.next) {
+			t.Errorf("%q: got %s %s %s, want %s %s %s", tt.text, sch.Repeat, sch.Weekday, sch.NextRunAt,
+				tt.repeat, tt.weekday, tt.next)
+		}
+		if sch.Hour != tt.next.Hour() || sch.Minute != tt.next.Minute() {
+			t.Errorf("%q: got time %02d:%02d", tt.text, sch.Hour, sch.Minute)
+		}
+	}
+
+	for _, text := range []string{
+		"",
+		"завтра",
+		"31.12.2026 12:00", // уже наступило
+		"30.12.2026 15:00",
+		"32.01.2027 10:00",
+		"31.12.2026 25:00",
+		"каждый день 24:00",
+		"каждый день 10:60",
+		"каждый день 10",
+		"каждый праздник 10:00",
+		"каждый понедельник",
+	} {
+		if sch, ok := u.parseSchedule(text, now); ok {
+			t.Errorf("%q: parsed as %+v", text, sch)
+		}
+	}
+}
+
+func TestBroadcastScheduleNext(t *testing.T) {
+	loc := samara(t)
+	at := func(y int, m time.Month, d, h, min int) time.Time { return time.Date(y, m, d, h, min, 0, 0, loc) }
+
+	tests := []struct {
+		name  string
+		sch   BroadcastSchedule
+		after time.Time
+		want  time.Time
+	}{
+		{"daily later today", BroadcastSchedule{Repeat: RepeatDaily, Hour: 18},
+			at(2026, time.October, 17, 9, 0), at(2026, time.October, 17, 18, 0)},
+		{"daily passed today", BroadcastSchedule{Repeat: RepeatDaily, Hour: 9},
+			at(2026, time.October, 17, 9, 1), at(2026, time.October, 18, 9, 0)},
+		{"daily month rollover", BroadcastSchedule{Repeat: RepeatDaily, Hour: 9, Minute: 30},
+			at(2026, time.January, 31, 23, 0), at(2026, time.February, 1, 9, 30)},
+		{"daily year rollover", BroadcastSchedule{Repeat: RepeatDaily, Hour: 0},
+			at(2026, time.December, 31, 0, 0), at(2027, time.January, 1, 0, 0)},
+		{"weekly same day later", BroadcastSchedule{Repeat: RepeatWeekly, Weekday: time.Saturday, Hour: 20},
+			at(2026, time.October, 17, 9, 0), at(2026, time.October, 17, 20, 0)},
+		{"weekly same day passed", BroadcastSchedule{Repeat: RepeatWeekly, Weekday: time.Saturday, Hour: 8},
+			at(2026, time.October, 17, 9, 0), at(2026, time.October, 24, 8, 0)},
+		{"weekly month rollover", BroadcastSchedule{Repeat: RepeatWeekly, Weekday: time.Monday, Hour: 10},
+			at(2026, time.February, 27, 12, 0), at(2026, time.March, 2, 10, 0)},
+		{"weekly year rollover", BroadcastSchedule{Repeat: RepeatWeekly, Weekday: time.Tuesday, Hour: 10},
+			at(2026, time.December, 30, 12, 0), at(2027, time.January, 5, 10, 0)},
+		// в UTC ещё 1 марта, в Самаре уже 2-е и 01:00 прошло
+		{"day taken in schedule zone", BroadcastSchedule{Repeat: RepeatDaily, Hour: 1},
+			time.Date(2026, time.March, 1, 21, 30, 0, 0, time.UTC), at(2026, time.March, 3, 1, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.sch.next(tt.after, loc)
+			if !got.Equal(tt.want) {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+			if got.Location() != loc {
+				t.Fatalf("got location %s, want %s", got.Location(), loc)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package usecase
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// События, которые приписываются рассылке
+const (
+	ConversionQuizStart = "quiz_start"
+	ConversionLead      = "lead"
+)
+
+// BroadcastEngagement — уникальные пользователи, отреагировавшие на рассылку
+type BroadcastEngagement struct {
+	Clickers   int
+	QuizStarts int
+	Leads      int
+}
+
+// BroadcastTracker хранит клики по кнопкам рассылок и приписанные им конверсии
+type BroadcastTracker interface {
+	RecordClick(jobID, chatID int64, button int, at time.Time) error
+	// RecordConversion приписывает событие последней рассылке, доставленной chatID не раньше since,
+	// и возвращает её ID (0 — подходящей рассылки нет). Повтор события не учитывается дважды.
+	RecordConversion(chatID int64, kind string, since, at time.Time) (int64, error)
+	Engagement(jobID int64) (BroadcastEngagement, error)
+}
+
+// trackedPrefix — callback_data отслеживаемой кнопки: "bc:<ID рассылки>:<номер кнопки>"
+const trackedPrefix = "bc:"
+
+// trackButtons подменяет callback-данные кнопок на отслеживаемые; исходные данные
+// хранятся в задании и возвращаются из Click
+func (u *BroadcastUsecase) trackButtons(jobID int64, c BroadcastContent) BroadcastContent {
+	if u.Tracker == nil || len(c.Buttons) == 0 {
+		return c
+	}
+	buttons := make([]BroadcastButton, len(c.Buttons))
+	for i, b := range c.Buttons {
+		if b.URL == "" {
+			b.Data = fmt.Sprintf("%s%d:%d", trackedPrefix, jobID, i)
+		}
+		buttons[i] = b
+	}
+	c.Buttons = buttons
+	return c
+}
+
+// IsTrackedClick сообщает, что callback пришёл с отслеживаемой кнопки рассылки
+func IsTrackedClick(data string) bool { return strings.HasPrefix(data, trackedPrefix) }
+
+// Click записывает нажатие и возвращает исходные данные кнопки, которые нужно обработать
+// как сообщение пользователя
+func (u *BroadcastUsecase) Click(chatID int64, data string) (string, error) {
+	jobPart, btnPart, ok := strings.Cut(strings.TrimPrefix(data, trackedPrefix), ":")
+	jobID, err1 := strconv.ParseInt(jobPart, 10, 64)
+	idx, err2 := strconv.Atoi(btnPart)
+	if !ok || err1 != nil || err2 != nil {
+		return "", fmt.Errorf("bad tracked callback %q", data)
+	}
+	job, err := u.Jobs.GetJob(jobID)
+	if err != nil {
+		return "", err
+	}
+	c := job.Content.Normalized()
+	if idx < 0 || idx >= len(c.Buttons) {
+		return "", fmt.Errorf("broadcast %d has no button %d", jobID, idx)
+	}
+	if u.Tracker != nil {
+		if err := u.Tracker.RecordClick(jobID, chatID, idx, time.Now()); err != nil {
+			return c.Buttons[idx].Data, err
+		}
+	}
+	return c.Buttons[idx].Data, nil
+}
+
+// Attribute приписывает старт квиза или лид рассылке, полученной в пределах AttributionWindow
+func (u *BroadcastUsecase) Attribute(chatID int64, kind string) (int64, error) {
+	if u.Tracker == nil {
+		return 0, nil
+	}
+	now := time.Now()
+	return u.Tracker.RecordConversion(chatID, kind, now.Add(-u.AttributionWindow), now)
+}
+
+// engagementLine — CTR и конверсии рассылки от числа доставленных сообщений
+func (u *BroadcastUsecase) engagementLine(job BroadcastJob) (string, bool) {
+	e, err := u.Tracker.Engagement(job.ID)
+	if err != nil {
+		return "", false
+	}
+	return fmt.Sprintf("#%d %s: доставлено %d, кликнули %d (CTR %d%%), начали квиз %d, лиды %d (конверсия %.1f%%)",
+		job.ID, job.CreatedAt.Format("2006-01-02 15:04"), job.Sent, e.Clickers, percent(e.Clickers, job.Sent),
+		e.QuizStarts, e.Leads, ratio(e.Leads, job.Sent)), true
+}
+
+func ratio(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) * 100 / float64(total)
+}
+
+func formatWindow(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%d дн.", int(d/(24*time.Hour)))
+	}
+	return fmt.Sprintf("%d ч", int(d.Hours()))
+}
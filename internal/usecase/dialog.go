@@ -1,6 +1,9 @@
 package usecase
 
-// Логические состояния и ответы, независимые от Telegram
+import "time"
+
+// Логические состояния и ответы, независимые от Telegram.
+// Тексты, кнопки и переходы квиза описываются в сценарии (см. Scenario).
 
 type State string
 
@@ -13,23 +16,16 @@ const (
 	StateFinalMessage       = "final_message"
 	StateRequestPhone       = "request_phone"
 	StateLeadSaved          = "lead_saved"
+	// необязательные вопросы после сохранения лида, см. FollowUp
+	StateAskName     = "ask_name"
+	StateAskCallTime = "ask_call_time"
 )
 
+// Поля сессии, которые сценарий может заполнять ответами
 const (
-	PurposeSelf     = "Для жизни"
-	PurposeRelative = "Для близких"
-	PurposeInvest   = "Для инвестиций"
-
-	Bedrooms1     = "1 спальня"
-	Bedrooms2     = "2 спальни"
-	Bedrooms3Plus = "3 и более спален"
-
-	PaymentCash        = "100% собственных средств"
-	PaymentInstallment = "Бесплатная рассрочка"
-	PaymentMortgage    = "Ипотека"
-	PaymentTradeIn     = "Трейд-ин"
-
-	StartBtn = "Хочу"
+	FieldPurpose  = "purpose"
+	FieldBedrooms = "bedrooms"
+	FieldPayment  = "payment"
 )
 
 type Session struct {
@@ -38,6 +34,47 @@ type Session struct {
 	Bedrooms string
 	Payment  string
 	Phone    string
+	// LeadID — сохранённый лид, который дополняют ответы на необязательные вопросы
+	LeadID int64
+	// SuggestedName — имя из профиля Telegram, которое подтверждают кнопкой
+	SuggestedName string
+	ClientName    string
+	CallTime      string
+	// ResetAt — когда завершённую сессию нужно начать заново; хранится вместе с сессией,
+	// чтобы сброс, не успевший выполниться до остановки бота, сработал при следующем обращении
+	ResetAt time.Time
+}
+
+// Field возвращает ответ пользователя по имени поля сценария
+func (s *Session) Field(name string) string {
+	switch name {
+	case FieldPurpose:
+		return s.Purpose
+	case FieldBedrooms:
+		return s.Bedrooms
+	case FieldPayment:
+		return s.Payment
+	}
+	return ""
+}
+
+func (s *Session) setField(name, value string) {
+	switch name {
+	case FieldPurpose:
+		s.Purpose = value
+	case FieldBedrooms:
+		s.Bedrooms = value
+	case FieldPayment:
+		s.Payment = value
+	}
+}
+
+func isSessionField(name string) bool {
+	switch name {
+	case FieldPurpose, FieldBedrooms, FieldPayment:
+		return true
+	}
+	return false
 }
 
 type Reply struct {
@@ -45,105 +82,75 @@ type Reply struct {
 	Options        []string
 	RemoveKeyboard bool
 	AdvanceTo      State
+	// Notice — короткое сообщение, которое нужно отправить перед Text
+	Notice string
 }
 
-type Dialog struct{}
+// Dialog исполняет сценарий: хранит шаги по состояниям и заполняет Session ответами
+type Dialog struct {
+	sc    *Scenario
+	steps map[State]*Step
+}
 
-func NewDialog() *Dialog { return &Dialog{} }
+func NewDialog(sc *Scenario) *Dialog {
+	steps := make(map[State]*Step, len(sc.Steps))
+	for i := range sc.Steps {
+		steps[sc.Steps[i].State] = &sc.Steps[i]
+	}
+	return &Dialog{sc: sc, steps: steps}
+}
 
 func (d *Dialog) Handle(s *Session, text string) Reply {
-	if text == "/start" || s.State == StateStart {
-		s.State = StateIntro
-		greet := "Вас приветствует команда концептуального жилого комплекса «ЗИМ Галерея» - новаторского проекта бизнес-класса в Самаре с уникальным домом галерейного типа и квартирами-ячейками, вдохновлёнными легендарным Домом Наркомфина."
-		return Reply{Text: greet, Options: []string{StartBtn}, AdvanceTo: StateIntro}
+	if text == "/start" || s.State == StateStart || s.State == "" {
+		return d.enter(s, d.sc.Start)
 	}
 
-	switch s.State {
-	case StateIntro:
-		if text == StartBtn {
-			// Сразу задаем первый вопрос
-			s.State = StatePurpose
-			return Reply{Text: "Для каких целей рассматриваете квартиру?", Options: []string{PurposeSelf, PurposeRelative, PurposeInvest}, AdvanceTo: StatePurpose}
-		}
-		return Reply{Text: "Нажмите 'Хочу'", Options: []string{StartBtn}}
-
-	case StatePurpose:
-		if text == PurposeSelf || text == PurposeRelative || text == PurposeInvest {
-			s.Purpose = text
-			s.State = StateBedrooms
-			return Reply{Text: "Сколько спален необходимо?", Options: []string{Bedrooms1, Bedrooms2, Bedrooms3Plus}, AdvanceTo: StateBedrooms}
-		}
-		return Reply{Text: "Пожалуйста, выберите вариант", Options: []string{PurposeSelf, PurposeRelative, PurposeInvest}}
-
-	case StateBedrooms:
-		if text == Bedrooms1 || text == Bedrooms2 || text == Bedrooms3Plus {
-			s.Bedrooms = text
-			s.State = StatePayment
-			return Reply{Text: "Какая форма оплаты предпочтительна?", Options: []string{PaymentCash, PaymentInstallment, PaymentMortgage, PaymentTradeIn}, AdvanceTo: StatePayment}
-		}
-		return Reply{Text: "Пожалуйста, выберите количество спален", Options: []string{Bedrooms1, Bedrooms2, Bedrooms3Plus}}
-
-	case StatePayment:
-		if text == PaymentCash || text == PaymentInstallment || text == PaymentMortgage || text == PaymentTradeIn {
-			s.Payment = text
-			// Сразу отдаём ценность и просим номер
-			s.State = StateRequestPhone
-			msg := finalTextForSelection(s) + "\n\n" + "Оставьте номер — вышлю точный расчет и 2–3 альтернативы."
-			return Reply{Text: msg, AdvanceTo: StateRequestPhone}
+	st, ok := d.steps[s.State]
+	if !ok || len(st.Options) == 0 {
+		return Reply{Text: d.sc.Fallback}
+	}
+	opt, ok := st.option(text)
+	if !ok {
+		retry := st.Retry
+		if retry == "" {
+			retry = d.sc.DefaultRetry
 		}
-		return Reply{Text: "Пожалуйста, выберите способ оплаты", Options: []string{PaymentCash, PaymentInstallment, PaymentMortgage, PaymentTradeIn}}
-
-		// Шаг выбора канала удалён
+		return Reply{Text: retry, Options: st.labels()}
 	}
-
-	return Reply{Text: "Не понял команду"}
+	if st.Field != "" {
+		s.setField(st.Field, opt.Label)
+	}
+	r := d.enter(s, opt.next(st))
+	r.Notice = opt.Notice
+	return r
 }
 
-func finalTextForSelection(s *Session) string {
-	// Сообщение по финансовой программе
-	var offer string
-	switch s.Payment {
-	case PaymentCash:
-		offer = "Те, кто использует 100% собственных средств при оплате, могут получить специальную премию от 3% до 7% от цены квартиры. Хотите получить подробный расчет?"
-	case PaymentInstallment:
-		offer = "Бесплатная рассрочка от застройщика гибко подстраивается под ваши запросы, можно выбрать размер первого взноса от 20% и удобную схему платежей – каждый месяц/квартал/полгода. Хотите получить подробный расчет?"
-	case PaymentMortgage:
-		offer = "Для тех, кто использует ипотеку при оплате, существует специальная премия до 3% от цены квартиры. Кроме того, мы можем предложить вам траншевую ипотеку, которая уменьшает вам ежемесячные платежи в 2 раза, и вы не отказываетесь от привычных повседневных радостей. Хотите получить подробный расчет?"
-	case PaymentTradeIn:
-		offer = "Функция трейд-ин позволит вам обменять старую квартиру на новую: мы бесплатно реализуем ваш актив, высвободим ресурсы для нового выбора, при этом вы входите в сделку с минимальным 5% первым взносом. Хотите получить подробный расчет?"
-	default:
-		// Фолбэк на нейтральную формулировку
-		offer = "Подготовим персональную подборку и расчёты с учётом ваших параметров. Хотите получить подробный расчет?"
+func (d *Dialog) enter(s *Session, state State) Reply {
+	st := d.steps[state]
+	s.State = state
+	text := st.Prompt
+	if st.WithOffer {
+		// Сразу отдаём ценность, затем вопрос шага
+		text = d.Offer(s) + "\n\n" + text
 	}
-
-	return offer
+	return Reply{Text: text, Options: st.labels(), AdvanceTo: state}
 }
 
-// CatalogTitleFor был удалён за ненадобностью (выбор канала исключён)
-
-// CatalogFileFor возвращает путь к PDF в папке collections согласно выбору пользователя.
-func CatalogFileFor(s *Session) string {
-	if s.Purpose == PurposeInvest {
-		return "collections/топ-10_эксклюзивных_квартир.pdf"
-	}
-	switch s.Purpose {
-	case PurposeSelf:
-		switch s.Bedrooms {
-		case Bedrooms1:
-			return "collections/топ_квартир_с_одной_спальней_для_жизни.pdf"
-		case Bedrooms2:
-			return "collections/топ_квартир_с_двумя_спальнями_для_жизни.pdf"
-		case Bedrooms3Plus:
-			return "collections/топ_квартир_с_тремя_и_более_спальнями_для_жизни.pdf"
+// Offer возвращает текст финансового предложения по ответам пользователя
+func (d *Dialog) Offer(s *Session) string {
+	for _, r := range d.sc.Offers {
+		if r.matches(s) {
+			return r.Text
 		}
-	case PurposeRelative:
-		switch s.Bedrooms {
-		case Bedrooms1:
-			return "collections/топ_квартир_с_одной_спальней_для_близких.pdf"
-		case Bedrooms2:
-			return "collections/топ_квартир_с_двумя_спальнями_для_близких.pdf"
-		case Bedrooms3Plus:
-			return "collections/топ_квартир_с_тремя_и_более_спальнями_для_близких.pdf"
+	}
+	return d.sc.DefaultOffer
+}
+
+// CatalogFile возвращает путь к PDF в папке collections согласно выбору пользователя.
+func (d *Dialog) CatalogFile(s *Session) string {
+	for _, r := range d.sc.Catalogs {
+		if r.matches(s) {
+			return r.File
 		}
 	}
 	return ""
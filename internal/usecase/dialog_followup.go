@@ -0,0 +1,63 @@
+package usecase
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// maxFollowUpAnswer — ограничение длины свободного ответа, чтобы в CRM не ушло сочинение
+const maxFollowUpAnswer = 100
+
+// HasFollowUp сообщает, настроены ли вопросы после номера телефона
+func (d *Dialog) HasFollowUp() bool { return d.sc.FollowUp != nil }
+
+// IsFollowUpState — сессия ждёт ответа на необязательный вопрос
+func IsFollowUpState(state State) bool {
+	return state == StateAskName || state == StateAskCallTime
+}
+
+// StartFollowUp переводит сессию к вопросу об имени для сохранённого лида.
+// suggested — имя из профиля Telegram; если оно есть, его можно подтвердить одной кнопкой.
+func (d *Dialog) StartFollowUp(s *Session, leadID int64, suggested string) Reply {
+	f := d.sc.FollowUp
+	s.State, s.LeadID, s.SuggestedName, s.ClientName, s.CallTime = StateAskName, leadID, suggested, "", ""
+	r := Reply{Text: f.NamePrompt, Options: []string{f.Skip}, AdvanceTo: StateAskName, Notice: f.Thanks}
+	if suggested != "" && f.NameConfirmPrompt != "" {
+		r.Text = strings.ReplaceAll(f.NameConfirmPrompt, "{name}", suggested)
+		r.Options = []string{f.Confirm, f.Skip}
+	}
+	return r
+}
+
+// FollowUpInput принимает ответ на вопрос об имени или времени звонка.
+// Кроме кнопок принимается свободный текст; done — вопросы закончились.
+func (d *Dialog) FollowUpInput(s *Session, text string) (r Reply, done bool) {
+	f := d.sc.FollowUp
+	text = strings.TrimSpace(text)
+	switch s.State {
+	case StateAskName:
+		switch {
+		case text == f.Skip:
+		case text == f.Confirm && s.SuggestedName != "":
+			s.ClientName = s.SuggestedName
+		case text != f.Confirm:
+			s.ClientName = truncateAnswer(text)
+		}
+		s.State = StateAskCallTime
+		return Reply{Text: f.CallTimePrompt, Options: append(append([]string{}, f.CallTimeSlots...), f.Skip), AdvanceTo: StateAskCallTime}, false
+	case StateAskCallTime:
+		if text != f.Skip {
+			s.CallTime = truncateAnswer(text)
+		}
+		s.State = StateLeadSaved
+		return Reply{Text: f.Done, AdvanceTo: StateLeadSaved}, true
+	}
+	return Reply{}, true
+}
+
+func truncateAnswer(s string) string {
+	if utf8.RuneCountInString(s) <= maxFollowUpAnswer {
+		return s
+	}
+	return string([]rune(s)[:maxFollowUpAnswer])
+}
@@ -3,16 +3,74 @@ package usecase
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
 type FunnelRepository interface {
-	Hit(state State, chatID int64) error
+	// Hit записывает заход на шаг вместе с ответами, которые пользователь дал к этому моменту
+	Hit(state State, chatID int64, a FunnelAnswers) error
 	Counts() map[State]int
+	// CountsBetween считает уникальных пользователей по шагам среди заходов за [from, to)
+	CountsBetween(from, to time.Time) (map[State]int, error)
+	// WeeklyCohorts группирует впервые зашедших за [from, to) по неделе первого захода
+	WeeklyCohorts(from, to time.Time) ([]FunnelCohort, error)
+	// AnswerConversions — ответившие и дошедшие до лида по каждому ответу на поле field
+	AnswerConversions(field string, from, to time.Time) ([]AnswerConversion, error)
+	// Journeys — первые заходы на шаги у пользователей, впервые попавших в воронку за [from, to)
+	Journeys(from, to time.Time) ([]FunnelJourney, error)
 }
 
+// FunnelAnswers — ответы квиза, сохраняемые с каждым заходом в воронку
+type FunnelAnswers struct {
+	Purpose  string
+	Bedrooms string
+	Payment  string
+}
+
+// AnswerConversion — конверсия в лид пользователей, выбравших ответ Answer на поле Field
+type AnswerConversion struct {
+	Field  string
+	Answer string
+	Users  int
+	Leads  int
+}
+
+// answerFields — поля квиза в порядке вопросов для разбивки воронки
+var answerFields = []string{FieldPurpose, FieldBedrooms, FieldPayment}
+
+// FunnelCohort — пользователи, впервые попавшие в воронку на неделе Week, и шаги, до которых они дошли
+type FunnelCohort struct {
+	Week   time.Time
+	Counts map[State]int
+}
+
+// FunnelPeriod — период отчёта [From, To); Key однозначно задаёт период в callback-данных
+type FunnelPeriod struct {
+	Key   string
+	Label string
+	From  time.Time
+	To    time.Time
+}
+
+const (
+	FunnelToday = "today"
+	FunnelWeek  = "7d"
+	FunnelMonth = "30d"
+	FunnelAll   = "all"
+
+	// сколько последних когорт показывать в отчёте
+	maxCohorts = 12
+)
+
 type FunnelUsecase struct {
 	repo  FunnelRepository
 	order []State
+	// Location — часовой пояс, в котором считаются границы дней и недель
+	Location *time.Location
+	// Daily включает графики динамики по дням
+	Daily ActivityRepository
+	// StuckAfter — сколько пользователь может ждать на запросе номера, прежде чем считаться застрявшим
+	StuckAfter time.Duration
 }
 
 func NewFunnelUsecase(repo FunnelRepository) *FunnelUsecase {
@@ -29,15 +87,31 @@ func NewFunnelUsecase(repo FunnelRepository) *FunnelUsecase {
 	}
 }
 
-func (u *FunnelUsecase) Reach(chatID int64, state State) {
+func (u *FunnelUsecase) Reach(chatID int64, state State, s *Session) {
 	if state == "" {
 		return
 	}
-	_ = u.repo.Hit(state, chatID)
+	var a FunnelAnswers
+	if s != nil {
+		a = FunnelAnswers{Purpose: s.Purpose, Bedrooms: s.Bedrooms, Payment: s.Payment}
+	}
+	_ = u.repo.Hit(state, chatID, a)
 }
 
 func (u *FunnelUsecase) Chart() string {
-	counts := u.repo.Counts()
+	return u.render(u.repo.Counts(), "Воронка по шагам:\n")
+}
+
+// ChartFor — текстовая воронка по заходам за период
+func (u *FunnelUsecase) ChartFor(p FunnelPeriod) string {
+	counts, err := u.repo.CountsBetween(p.From, p.To)
+	if err != nil {
+		return "Не удалось получить данные воронки"
+	}
+	return u.render(counts, "Воронка по шагам, "+strings.ToLower(p.Label)+":\n")
+}
+
+func (u *FunnelUsecase) render(counts map[State]int, title string) string {
 	if len(counts) == 0 {
 		return "Данных по воронке пока нет"
 	}
@@ -56,7 +130,7 @@ func (u *FunnelUsecase) Chart() string {
 	}
 	var prev int
 	var b strings.Builder
-	b.WriteString("Воронка по шагам:\n")
+	b.WriteString(title)
 	for i, s := range u.order {
 		c := counts[s]
 		relBase := percent(c, base)
@@ -75,7 +149,20 @@ func (u *FunnelUsecase) Chart() string {
 
 // GraphData возвращает метки и значения по порядку шагов для построения графика
 func (u *FunnelUsecase) GraphData() ([]string, []int) {
-	counts := u.repo.Counts()
+	return u.graph(u.repo.Counts())
+}
+
+// GraphDataFor — данные графика по заходам за период
+func (u *FunnelUsecase) GraphDataFor(p FunnelPeriod) ([]string, []int, error) {
+	counts, err := u.repo.CountsBetween(p.From, p.To)
+	if err != nil {
+		return nil, nil, err
+	}
+	labels, values := u.graph(counts)
+	return labels, values, nil
+}
+
+func (u *FunnelUsecase) graph(counts map[State]int) ([]string, []int) {
 	labels := make([]string, 0, len(u.order))
 	values := make([]int, 0, len(u.order))
 	for _, s := range u.order {
@@ -126,3 +213,118 @@ func stateLabel(s State) string {
 		return string(s)
 	}
 }
+
+func (u *FunnelUsecase) location() *time.Location {
+	if u.Location != nil {
+		return u.Location
+	}
+	return time.Local
+}
+
+// Period разбирает ключ периода в часовом поясе отчётов воронки
+func (u *FunnelUsecase) Period(key string, now time.Time) (FunnelPeriod, bool) {
+	return ReportPeriod(key, now, u.location())
+}
+
+// ReportPeriod разбирает ключ периода: today, 7d, 30d, all или «01.09.2025-30.09.2025»
+func ReportPeriod(key string, now time.Time, loc *time.Location) (FunnelPeriod, bool) {
+	n := now.In(loc)
+	today := time.Date(n.Year(), n.Month(), n.Day(), 0, 0, 0, 0, loc)
+	tomorrow := today.AddDate(0, 0, 1)
+	switch key {
+	case FunnelToday:
+		return FunnelPeriod{Key: key, Label: "Сегодня", From: today, To: tomorrow}, true
+	case FunnelWeek:
+		return FunnelPeriod{Key: key, Label: "Последние 7 дней", From: today.AddDate(0, 0, -6), To: tomorrow}, true
+	case FunnelMonth:
+		return FunnelPeriod{Key: key, Label: "Последние 30 дней", From: today.AddDate(0, 0, -29), To: tomorrow}, true
+	case FunnelAll:
+		return FunnelPeriod{Key: key, Label: "За всё время", From: time.Unix(0, 0).In(loc), To: tomorrow}, true
+	}
+	from, to, ok := parseDateRangeIn(key, loc)
+	if !ok {
+		return FunnelPeriod{}, false
+	}
+	key = from.Format(segmentDateLayout) + "-" + to.AddDate(0, 0, -1).Format(segmentDateLayout)
+	return FunnelPeriod{Key: key, Label: "Период " + strings.Replace(key, "-", "–", 1), From: from, To: to}, true
+}
+
+// CohortReport — конверсия по шагам для недельных когорт пользователей, впервые пришедших за период
+func (u *FunnelUsecase) CohortReport(p FunnelPeriod) string {
+	cohorts, err := u.repo.WeeklyCohorts(p.From, p.To)
+	if err != nil {
+		return "Не удалось получить когорты"
+	}
+	if len(cohorts) == 0 {
+		return "За период новых пользователей в воронке нет"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Когорты по неделе первого визита, %s.\nДоля дошедших до шага от пришедших за неделю:\n", strings.ToLower(p.Label))
+	if len(cohorts) > maxCohorts {
+		cohorts = cohorts[len(cohorts)-maxCohorts:]
+	}
+	for _, c := range cohorts {
+		base := 0
+		for _, s := range u.order {
+			if c.Counts[s] > base {
+				base = c.Counts[s]
+			}
+		}
+		end := c.Week.AddDate(0, 0, 6)
+		fmt.Fprintf(&b, "\n%s–%s: %d польз.\n", c.Week.Format("02.01"), end.Format("02.01"), base)
+		parts := make([]string, 0, len(u.order))
+		for _, s := range u.order {
+			parts = append(parts, fmt.Sprintf("%s %d%%", stateLabel(s), percent(c.Counts[s], base)))
+		}
+		b.WriteString(strings.Join(parts, " → ") + "\n")
+	}
+	return b.String()
+}
+
+// AnswerBreakdown — конверсия в лид по ответам на каждый вопрос квиза за период
+func (u *FunnelUsecase) AnswerBreakdown(p FunnelPeriod) ([]AnswerConversion, error) {
+	var out []AnswerConversion
+	for _, f := range answerFields {
+		list, err := u.repo.AnswerConversions(f, p.From, p.To)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, list...)
+	}
+	return out, nil
+}
+
+// AnswerReport — текстовая разбивка конверсии в лид по ответам
+func (u *FunnelUsecase) AnswerReport(p FunnelPeriod) string {
+	list, err := u.AnswerBreakdown(p)
+	if err != nil {
+		return "Не удалось получить разбивку по ответам"
+	}
+	if len(list) == 0 {
+		return "За период ответов на вопросы квиза нет"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Конверсия в лид по ответам, %s:\n", strings.ToLower(p.Label))
+	field := ""
+	for _, c := range list {
+		if c.Field != field {
+			field = c.Field
+			fmt.Fprintf(&b, "\n%s:\n", FieldLabel(field))
+		}
+		fmt.Fprintf(&b, "- %s: ответили %d, лиды %d (%.1f%%)\n", c.Answer, c.Users, c.Leads, ratio(c.Leads, c.Users))
+	}
+	return b.String()
+}
+
+// FieldLabel — название вопроса квиза для отчётов
+func FieldLabel(field string) string {
+	switch field {
+	case FieldPurpose:
+		return segBtnPurpose
+	case FieldBedrooms:
+		return segBtnBedrooms
+	case FieldPayment:
+		return segBtnPayment
+	}
+	return field
+}
@@ -0,0 +1,161 @@
+package usecase
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FunnelJourney — время первого захода пользователя на каждый пройденный шаг
+type FunnelJourney struct {
+	ChatID  int64
+	Reached map[State]time.Time
+}
+
+// StepTiming — сколько времени пользователи тратят на переход From → To
+type StepTiming struct {
+	From   State
+	To     State
+	Users  int
+	Median time.Duration
+	P90    time.Duration
+}
+
+// DropOff — где и как долго пользователи задерживаются в воронке
+type DropOff struct {
+	// Users — пользователи, впервые пришедшие в воронку за период
+	Users   int
+	Timings []StepTiming
+	// LastStep — последний пройденный шаг у пользователей, не оставивших номер
+	LastStep map[State]int
+	NonLeads int
+	// AtPhone — дошли до запроса номера; Stuck — из них без лида дольше StuckAfter
+	AtPhone int
+	Stuck   int
+}
+
+// defaultStuckAfter — через сколько пользователь без номера на шаге запроса считается застрявшим
+const defaultStuckAfter = 24 * time.Hour
+
+func (u *FunnelUsecase) stuckAfter() time.Duration {
+	if u.StuckAfter > 0 {
+		return u.StuckAfter
+	}
+	return defaultStuckAfter
+}
+
+// DropOff считает время между шагами и отвал для пользователей, впервые пришедших за период
+func (u *FunnelUsecase) DropOff(p FunnelPeriod, now time.Time) (DropOff, error) {
+	journeys, err := u.repo.Journeys(p.From, p.To)
+	if err != nil {
+		return DropOff{}, err
+	}
+	d := DropOff{Users: len(journeys), LastStep: map[State]int{}}
+	gaps := make([][]time.Duration, len(u.order)-1)
+	for _, j := range journeys {
+		for i := 1; i < len(u.order); i++ {
+			from, ok1 := j.Reached[u.order[i-1]]
+			to, ok2 := j.Reached[u.order[i]]
+			// повторный /start может дать обратный порядок — такие пары не показательны
+			if ok1 && ok2 && !to.Before(from) {
+				gaps[i-1] = append(gaps[i-1], to.Sub(from))
+			}
+		}
+		if _, lead := j.Reached[StateLeadSaved]; lead {
+			if _, ok := j.Reached[StateRequestPhone]; ok {
+				d.AtPhone++
+			}
+			continue
+		}
+		d.NonLeads++
+		for i := len(u.order) - 1; i >= 0; i-- {
+			if _, ok := j.Reached[u.order[i]]; ok {
+				d.LastStep[u.order[i]]++
+				break
+			}
+		}
+		if at, ok := j.Reached[StateRequestPhone]; ok {
+			d.AtPhone++
+			if now.Sub(at) > u.stuckAfter() {
+				d.Stuck++
+			}
+		}
+	}
+	for i, g := range gaps {
+		t := StepTiming{From: u.order[i], To: u.order[i+1], Users: len(g)}
+		if len(g) > 0 {
+			sort.Slice(g, func(a, b int) bool { return g[a] < g[b] })
+			t.Median, t.P90 = quantile(g, 0.5), quantile(g, 0.9)
+		}
+		d.Timings = append(d.Timings, t)
+	}
+	return d, nil
+}
+
+// quantile — значение по методу ближайшего ранга; sorted упорядочен по возрастанию
+func quantile(sorted []time.Duration, q float64) time.Duration {
+	idx := int(math.Ceil(q*float64(len(sorted)))) - 1
+	return sorted[max(idx, 0)]
+}
+
+// DropOffReport — время между шагами, где останавливаются и сколько застряли на запросе номера
+func (u *FunnelUsecase) DropOffReport(p FunnelPeriod, d DropOff) string {
+	if d.Users == 0 {
+		return "За период новых пользователей в воронке нет"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Время между шагами, %s (медиана / 90%%):\n", strings.ToLower(p.Label))
+	for _, t := range d.Timings {
+		if t.Users == 0 {
+			fmt.Fprintf(&b, "- %s → %s: нет переходов\n", stateLabel(t.From), stateLabel(t.To))
+			continue
+		}
+		fmt.Fprintf(&b, "- %s → %s: %s / %s (польз. %d)\n", stateLabel(t.From), stateLabel(t.To),
+			humanDuration(t.Median), humanDuration(t.P90), t.Users)
+	}
+	fmt.Fprintf(&b, "\nГде остановились не оставившие номер (%d):\n", d.NonLeads)
+	for _, s := range u.order {
+		if n := d.LastStep[s]; n > 0 {
+			fmt.Fprintf(&b, "- %s: %d (%d%%)\n", stateLabel(s), n, percent(n, d.NonLeads))
+		}
+	}
+	fmt.Fprintf(&b, "\nНа запросе номера без лида дольше %s: %d из %d дошедших (%.1f%%)",
+		humanDuration(u.stuckAfter()), d.Stuck, d.AtPhone, ratio(d.Stuck, d.AtPhone))
+	return b.String()
+}
+
+// DropOffGraph — данные графика: сколько пользователей без лида остановились на каждом шаге
+func (u *FunnelUsecase) DropOffGraph(d DropOff) ([]string, []int) {
+	labels := make([]string, 0, len(u.order))
+	values := make([]int, 0, len(u.order))
+	for _, s := range u.order {
+		if s == StateLeadSaved {
+			continue
+		}
+		labels = append(labels, stateLabel(s))
+		values = append(values, d.LastStep[s])
+	}
+	return labels, values
+}
+
+func humanDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%d с", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%d мин", int(d.Minutes()))
+	case d < 24*time.Hour:
+		h := int(d.Hours())
+		if m := int(d.Minutes()) % 60; m > 0 {
+			return fmt.Sprintf("%d ч %d мин", h, m)
+		}
+		return fmt.Sprintf("%d ч", h)
+	}
+	days := int(d / (24 * time.Hour))
+	if h := int(d.Hours()) % 24; h > 0 {
+		return fmt.Sprintf("%d дн. %d ч", days, h)
+	}
+	return fmt.Sprintf("%d дн.", days)
+}
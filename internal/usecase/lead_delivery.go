@@ -9,4 +9,6 @@ import (
 // LeadDelivery описывает внешний канал доставки лида (CRM, вебхуки и т.п.)
 type LeadDelivery interface {
 	SendLead(ctx context.Context, lead domain.Lead) error
+	// UpdateLead сообщает об изменившихся ответах по уже отправленной заявке
+	UpdateLead(ctx context.Context, lead domain.Lead) error
 }
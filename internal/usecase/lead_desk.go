@@ -0,0 +1,268 @@
+package usecase
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"alliance-management-telegram-bot/internal/domain"
+)
+
+// LeadEvent — запись истории лида: кто и когда перевёл его в статус
+type LeadEvent struct {
+	LeadID      int64
+	Status      domain.LeadStatus
+	ManagerID   int64
+	ManagerName string
+	At          time.Time
+}
+
+// LeadQuery — фильтр списка лидов; пустые Statuses — любой статус, OlderThan — лиды старше этого срока
+type LeadQuery struct {
+	Statuses  []domain.LeadStatus
+	OlderThan time.Duration
+}
+
+// LeadBook читает лиды и меняет их статус
+type LeadBook interface {
+	GetLead(id int64) (domain.Lead, error)
+	// UpdateLeadStatus меняет статус и ответственного и пишет переход в историю
+	UpdateLeadStatus(id int64, status domain.LeadStatus, managerID int64, managerName string, at time.Time) error
+	// ListLeads возвращает до limit лидов под фильтр, новые первыми
+	ListLeads(q LeadQuery, now time.Time, limit int) ([]domain.Lead, error)
+	LeadHistory(id int64) ([]LeadEvent, error)
+	// SetLeadCard и LeadCard хранят последнюю карточку лида в чате менеджеров; 0 — карточки нет
+	SetLeadCard(id int64, messageID int) error
+	LeadCard(id int64) (int, error)
+}
+
+// LeadCardSender присылает карточку лида с кнопками смены статуса и обновляет её
+type LeadCardSender interface {
+	SendLeadCard(chatID int64, leadID int64, text string) (int, error)
+	EditLeadCard(chatID int64, messageID int, leadID int64, text string) error
+}
+
+// openLeadStatuses — лиды, с которыми ещё нужно работать
+var openLeadStatuses = []domain.LeadStatus{domain.LeadNew, domain.LeadInWork, domain.LeadNoAnswer}
+
+const maxLeadList = 20
+
+// LeadDesk — работа менеджеров с лидами в чате менеджеров: уведомления о новых лидах,
+// смена статуса кнопками и список открытых лидов
+type LeadDesk struct {
+	Leads LeadBook
+	Cards LeadCardSender
+	// ChatID — чат менеджеров, куда приходят новые лиды
+	ChatID   int64
+	Location *time.Location
+}
+
+func NewLeadDesk(leads LeadBook, cards LeadCardSender, chatID int64) *LeadDesk {
+	return &LeadDesk{Leads: leads, Cards: cards, ChatID: chatID}
+}
+
+func (d *LeadDesk) location() *time.Location {
+	if d.Location != nil {
+		return d.Location
+	}
+	return time.Local
+}
+
+// Announce присылает карточку лида в чат менеджеров; repeat — повторная заявка обновила существующий лид
+func (d *LeadDesk) Announce(leadID int64, repeat bool) error {
+	l, err := d.Leads.GetLead(leadID)
+	if err != nil {
+		return err
+	}
+	header := "Новый лид"
+	if repeat {
+		header = "Повторная заявка, ответы обновлены"
+	}
+	messageID, err := d.Cards.SendLeadCard(d.ChatID, l.ID, header+"\n"+d.Card(l))
+	if err != nil {
+		return err
+	}
+	return d.Leads.SetLeadCard(l.ID, messageID)
+}
+
+// Refresh обновляет уже отправленную карточку, например когда клиент назвал имя и время звонка.
+// Если карточки ещё нет, ничего не делает: Announce сам прочитает свежие данные лида
+func (d *LeadDesk) Refresh(leadID int64) error {
+	messageID, err := d.Leads.LeadCard(leadID)
+	if err != nil || messageID == 0 {
+		return err
+	}
+	l, err := d.Leads.GetLead(leadID)
+	if err != nil {
+		return err
+	}
+	return d.Cards.EditLeadCard(d.ChatID, messageID, l.ID, "Лид дополнен ответами клиента\n"+d.Card(l))
+}
+
+// Card — описание лида для карточки
+func (d *LeadDesk) Card(l domain.Lead) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Лид #%d от %s\nТелефон: %s\n", l.ID, l.CreatedAt.In(d.location()).Format("02.01.2006 15:04"), l.Phone)
+	name := l.Name()
+	if name != "" {
+		fmt.Fprintf(&b, "Имя: %s\n", name)
+	}
+	if l.Username != "" && name != "@"+l.Username {
+		fmt.Fprintf(&b, "Telegram: @%s\n", l.Username)
+	}
+	if l.CallTime != "" {
+		fmt.Fprintf(&b, "Удобное время звонка: %s\n", l.CallTime)
+	}
+	for _, f := range []struct{ label, value string }{{"Цель", l.Purpose}, {"Спальни", l.Bedrooms}, {"Оплата", l.Payment}} {
+		if f.value != "" {
+			fmt.Fprintf(&b, "%s: %s\n", f.label, f.value)
+		}
+	}
+	fmt.Fprintf(&b, "Статус: %s", LeadStatusLabel(l.Status))
+	if l.AssigneeName != "" {
+		fmt.Fprintf(&b, " (%s)", l.AssigneeName)
+	}
+	return b.String()
+}
+
+// SetStatus меняет статус лида от имени менеджера. Возвращает обновлённую карточку
+// (пустую, если статус не изменён) и короткое уведомление для менеджера.
+func (d *LeadDesk) SetStatus(leadID int64, status domain.LeadStatus, managerID int64, managerName string) (string, string, error) {
+	switch status {
+	case domain.LeadInWork, domain.LeadNoAnswer, domain.LeadClosed:
+	default:
+		return "", "Неизвестный статус", nil
+	}
+	l, err := d.Leads.GetLead(leadID)
+	if err != nil {
+		return "", "Лид не найден", err
+	}
+	// взятый в работу лид не перехватывается другим менеджером молча
+	if status == domain.LeadInWork && l.Status == domain.LeadInWork && l.AssigneeID != 0 && l.AssigneeID != managerID {
+		return "", "Лид уже в работе у " + l.AssigneeName, nil
+	}
+	if err := d.Leads.UpdateLeadStatus(leadID, status, managerID, managerName, time.Now()); err != nil {
+		return "", "Не удалось изменить статус", err
+	}
+	if l, err = d.Leads.GetLead(leadID); err != nil {
+		return "", "Не удалось изменить статус", err
+	}
+	return d.Card(l), "Статус: " + LeadStatusLabel(status), nil
+}
+
+// Details — карточка лида с историей статусов
+func (d *LeadDesk) Details(leadID int64) (string, error) {
+	l, err := d.Leads.GetLead(leadID)
+	if err != nil {
+		return "", err
+	}
+	events, err := d.Leads.LeadHistory(leadID)
+	if err != nil {
+		return "", err
+	}
+	text := d.Card(l)
+	if len(events) > 0 {
+		lines := make([]string, 0, len(events))
+		for _, e := range events {
+			lines = append(lines, fmt.Sprintf("%s — %s, %s", e.At.In(d.location()).Format("02.01 15:04"), LeadStatusLabel(e.Status), e.ManagerName))
+		}
+		text += "\n\nИстория:\n" + strings.Join(lines, "\n")
+	}
+	return text, nil
+}
+
+// List разбирает аргументы /leads (статус и возраст, например «new 2d») и возвращает список лидов и их ID
+func (d *LeadDesk) List(args string, now time.Time) (string, []int64) {
+	q, ok := ParseLeadQuery(args)
+	if !ok {
+		return "Формат: /leads [open|new|in_work|no_answer|closed|all] [возраст, например 24h или 3d]", nil
+	}
+	leads, err := d.Leads.ListLeads(q, now, maxLeadList)
+	if err != nil {
+		return "Не удалось получить лиды", nil
+	}
+	if len(leads) == 0 {
+		return "Лидов под фильтр нет", nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Лиды (%s), последние %d:\n", describeLeadQuery(q), len(leads))
+	ids := make([]int64, 0, len(leads))
+	for _, l := range leads {
+		fmt.Fprintf(&b, "#%d %s, %s — %s", l.ID, l.CreatedAt.In(d.location()).Format("02.01 15:04"), l.Phone, LeadStatusLabel(l.Status))
+		if l.AssigneeName != "" {
+			fmt.Fprintf(&b, " (%s)", l.AssigneeName)
+		}
+		b.WriteString("\n")
+		ids = append(ids, l.ID)
+	}
+	return b.String(), ids
+}
+
+// ParseLeadQuery разбирает фильтр /leads; по умолчанию — открытые лиды любого возраста
+func ParseLeadQuery(args string) (LeadQuery, bool) {
+	q := LeadQuery{Statuses: openLeadStatuses}
+	for _, f := range strings.Fields(strings.ToLower(args)) {
+		switch f {
+		case "open":
+			q.Statuses = openLeadStatuses
+		case "all":
+			q.Statuses = nil
+		case string(domain.LeadNew), string(domain.LeadInWork), string(domain.LeadNoAnswer), string(domain.LeadClosed):
+			q.Statuses = []domain.LeadStatus{domain.LeadStatus(f)}
+		default:
+			age, ok := parseAge(f)
+			if !ok {
+				return LeadQuery{}, false
+			}
+			q.OlderThan = age
+		}
+	}
+	return q, true
+}
+
+// parseAge понимает длительности Go и дни: «3d»
+func parseAge(s string) (time.Duration, bool) {
+	if n, ok := strings.CutSuffix(s, "d"); ok {
+		days, err := strconv.Atoi(n)
+		if err != nil || days <= 0 {
+			return 0, false
+		}
+		return time.Duration(days) * 24 * time.Hour, true
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, false
+	}
+	return d, true
+}
+
+func describeLeadQuery(q LeadQuery) string {
+	var status string
+	switch {
+	case len(q.Statuses) == 0:
+		status = "все"
+	case len(q.Statuses) == len(openLeadStatuses):
+		status = "открытые"
+	default:
+		status = "статус «" + LeadStatusLabel(q.Statuses[0]) + "»"
+	}
+	if q.OlderThan > 0 {
+		status += ", старше " + humanDuration(q.OlderThan)
+	}
+	return status
+}
+
+func LeadStatusLabel(s domain.LeadStatus) string {
+	switch s {
+	case domain.LeadNew, "":
+		return "новый"
+	case domain.LeadInWork:
+		return "в работе"
+	case domain.LeadNoAnswer:
+		return "не дозвонились"
+	case domain.LeadClosed:
+		return "закрыт"
+	}
+	return string(s)
+}
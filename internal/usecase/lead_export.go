@@ -0,0 +1,160 @@
+package usecase
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strconv"
+	"strings"
+	"time"
+
+	"alliance-management-telegram-bot/internal/domain"
+)
+
+// LeadExportRow — лид со всем, что о нём известно: шаги воронки и доставка в CRM
+type LeadExportRow struct {
+	Lead        domain.Lead
+	Submissions int
+	// Reached — первый заход пользователя на каждый шаг воронки
+	Reached map[State]time.Time
+	// Created — запись очереди о создании заявки в CRM; nil — лид в CRM не отправлялся
+	Created *OutboxItem
+	// Updated — последняя запись об обновлении заявки; nil — обновлений не было
+	Updated *OutboxItem
+}
+
+// LeadExportSource выбирает лиды, созданные в [from, to), по возрастанию ID
+type LeadExportSource interface {
+	ExportLeads(from, to time.Time) ([]LeadExportRow, error)
+}
+
+// exportSteps — шаги воронки, время которых попадает в выгрузку; время лида — это дата заявки
+var exportSteps = []State{StateIntro, StatePurpose, StateBedrooms, StatePayment, StateRequestPhone}
+
+const exportTimeLayout = "02.01.2006 15:04"
+
+// LeadExport собирает выгрузку лидов за период для отдела продаж в CSV и XLSX
+type LeadExport struct {
+	Source LeadExportSource
+	// Location — часовой пояс периода и дат в выгрузке
+	Location *time.Location
+}
+
+func NewLeadExport(src LeadExportSource) *LeadExport {
+	return &LeadExport{Source: src}
+}
+
+func (e *LeadExport) location() *time.Location {
+	if e.Location != nil {
+		return e.Location
+	}
+	return time.Local
+}
+
+// Period разбирает ключ периода так же, как отчёты воронки
+func (e *LeadExport) Period(key string, now time.Time) (FunnelPeriod, bool) {
+	return ReportPeriod(key, now, e.location())
+}
+
+// Export возвращает выгрузку за период в CSV и XLSX и число лидов в ней
+func (e *LeadExport) Export(p FunnelPeriod) (csvData, xlsxData []byte, n int, err error) {
+	rows, err := e.Source.ExportLeads(p.From, p.To)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	table := e.table(rows)
+	if csvData, err = tableCSV(table); err != nil {
+		return nil, nil, 0, err
+	}
+	if xlsxData, err = writeXLSX("Лиды", table); err != nil {
+		return nil, nil, 0, err
+	}
+	return csvData, xlsxData, len(rows), nil
+}
+
+func (e *LeadExport) table(rows []LeadExportRow) [][]string {
+	header := []string{"ID", "Дата заявки", "Статус", "Менеджер", "Телефон", "Username", "Имя", "Фамилия",
+		"Имя из контакта", "Язык", "Как обращаться", "Время звонка", "Цель", "Спальни", "Оплата", "Заявок"}
+	for _, s := range exportSteps {
+		header = append(header, "Шаг «"+stateLabel(s)+"»")
+	}
+	header = append(header, "CRM", "CRM: попыток", "CRM: ошибка", "CRM: обновление", "CRM: ошибка обновления")
+
+	table := make([][]string, 0, len(rows)+1)
+	table = append(table, header)
+	for _, r := range rows {
+		l := r.Lead
+		username := ""
+		if l.Username != "" {
+			username = "@" + l.Username
+		}
+		line := []string{strconv.FormatInt(l.ID, 10), e.format(l.CreatedAt), LeadStatusLabel(l.Status), l.AssigneeName, l.Phone,
+			username, l.FirstName, l.LastName, l.ContactName, l.LanguageCode, l.ClientName, l.CallTime,
+			l.Purpose, l.Bedrooms, l.Payment, strconv.Itoa(max(r.Submissions, 1))}
+		for _, s := range exportSteps {
+			line = append(line, e.format(r.Reached[s]))
+		}
+		if d := r.Created; d != nil {
+			line = append(line, e.deliveryLabel(d), strconv.Itoa(d.Attempts), d.LastError)
+		} else {
+			line = append(line, "не отправлялся", "", "")
+		}
+		if d := r.Updated; d != nil {
+			line = append(line, e.deliveryLabel(d), d.LastError)
+		} else {
+			line = append(line, "", "")
+		}
+		table = append(table, line)
+	}
+	return table
+}
+
+func (e *LeadExport) format(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.In(e.location()).Format(exportTimeLayout)
+}
+
+func (e *LeadExport) deliveryLabel(it *OutboxItem) string {
+	switch {
+	case it.Status == OutboxDone:
+		return "доставлено"
+	case it.Status == OutboxDead:
+		return "не доставлено"
+	case it.Attempts > 0:
+		return "повтор " + e.format(it.NextAttemptAt)
+	default:
+		return "в очереди"
+	}
+}
+
+// tableCSV пишет CSV с BOM, чтобы Excel открыл кириллицу в UTF-8
+func tableCSV(table [][]string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("\uFEFF")
+	w := csv.NewWriter(&buf)
+	line := make([]string, 0)
+	for _, row := range table {
+		line = line[:0]
+		for _, v := range row {
+			line = append(line, csvSafe(v))
+		}
+		if err := w.Write(line); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// csvSafe не даёт табличному редактору выполнить присланный клиентом текст как формулу:
+// такие ячейки начинаются с апострофа. В XLSX все ячейки — строки, там это не нужно
+func csvSafe(v string) string {
+	if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
@@ -0,0 +1,63 @@
+package usecase
+
+import (
+	"bytes"
+	"encoding/csv"
+	"slices"
+	"testing"
+)
+
+func TestCSVSafe(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"=HYPERLINK(\"http://x\")", "'=HYPERLINK(\"http://x\")"},
+		{"+79271234567", "'+79271234567"},
+		{"-1+2", "'-1+2"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+		{"", ""},
+		{"Иван", "Иван"},
+		{"a=1", "a=1"},
+		{"'=1", "'=1"},
+		{"2 спальни", "2 спальни"},
+	}
+	for _, tt := range tests {
+		if got := csvSafe(tt.in); got != tt.want {
+			t.Errorf("csvSafe(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTableCSV(t *testing.T) {
+	table := [][]string{
+		{"ID", "Имя", "Комментарий"},
+		{"1", "=cmd|' /C calc'!A0", "строка, с запятой"},
+		{"2", "Анна \"Ань\"", "две\nстроки"},
+		{"3", "", "@me"},
+	}
+	data, err := tableCSV(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// BOM нужен Excel, чтобы открыть UTF-8 без кракозябр
+	bom := []byte("\uFEFF")
+	if !bytes.HasPrefix(data, bom) {
+		t.Fatalf("no BOM: %q", data[:min(len(data), 8)])
+	}
+	got, err := csv.NewReader(bytes.NewReader(data[len(bom):])).ReadAll()
+	if err != nil {
+		t.Fatalf("read back: %v", err)
+	}
+	if len(got) != len(table) {
+		t.Fatalf("got %d rows, want %d", len(got), len(table))
+	}
+	for i, row := range table {
+		want := make([]string, len(row))
+		for j, v := range row {
+			want[j] = csvSafe(v)
+		}
+		if !slices.Equal(got[i], want) {
+			t.Errorf("row %d: got %q, want %q", i, got[i], want)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"alliance-management-telegram-bot/internal/domain"
+)
+
+type OutboxStatus string
+
+const (
+	OutboxPending OutboxStatus = "pending"
+	OutboxDone    OutboxStatus = "done"
+	// OutboxDead — попытки исчерпаны, нужна ручная повторная отправка
+	OutboxDead OutboxStatus = "dead"
+)
+
+// OutboxKind — что нужно сделать во внешнем канале: создать заявку или обновить уже отправленную
+type OutboxKind string
+
+const (
+	OutboxCreate OutboxKind = "create"
+	OutboxUpdate OutboxKind = "update"
+)
+
+// OutboxItem — запись очереди доставки лида во внешний канал
+type OutboxItem struct {
+	ID            int64
+	Kind          OutboxKind
+	Lead          domain.Lead
+	Status        OutboxStatus
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+}
+
+// LeadOutbox — durable-очередь доставки лидов; записи создаются вместе с лидом в LeadRepository
+type LeadOutbox interface {
+	// ClaimDue забирает до limit записей, готовых к отправке, и откладывает их на lease,
+	// чтобы параллельный диспетчер не отправил их повторно
+	ClaimDue(now time.Time, lease time.Duration, limit int) ([]OutboxItem, error)
+	MarkDone(id int64) error
+	MarkFailed(id int64, attempts int, nextAttemptAt time.Time, lastErr string, dead bool) error
+	// ListStuck возвращает записи с неудачными попытками и dead-записи
+	ListStuck(limit int) ([]OutboxItem, error)
+	// RetryNow возвращает запись в очередь с немедленной отправкой
+	RetryNow(id int64) error
+	// ReleaseHeld снимает задержку с ещё не отправленной записи лида, ждущей ответов клиента
+	ReleaseHeld(leadID int64) error
+}
+
+// LeadDispatcher в фоне доставляет лиды из outbox через LeadDelivery с экспоненциальной задержкой
+type LeadDispatcher struct {
+	Outbox       LeadOutbox
+	Delivery     LeadDelivery
+	Logger       *slog.Logger
+	MaxAttempts  int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	PollInterval time.Duration
+	Lease        time.Duration
+	BatchSize    int
+
+	wake chan struct{}
+}
+
+func NewLeadDispatcher(outbox LeadOutbox, delivery LeadDelivery, logger *slog.Logger) *LeadDispatcher {
+	return &LeadDispatcher{
+		Outbox:       outbox,
+		Delivery:     delivery,
+		Logger:       logger,
+		MaxAttempts:  8,
+		BaseDelay:    30 * time.Second,
+		MaxDelay:     time.Hour,
+		PollInterval: 15 * time.Second,
+		Lease:        5 * time.Minute,
+		BatchSize:    20,
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// Notify будит диспетчер, например сразу после сохранения нового лида
+func (d *LeadDispatcher) Notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Release отправляет придержанный лид сразу, не дожидаясь конца задержки
+func (d *LeadDispatcher) Release(leadID int64) error {
+	if err := d.Outbox.ReleaseHeld(leadID); err != nil {
+		return err
+	}
+	d.Notify()
+	return nil
+}
+
+// Run обрабатывает очередь до отмены ctx. Прерванная остановкой отправка не считается попыткой.
+func (d *LeadDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+	for {
+		d.drain(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+func (d *LeadDispatcher) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		items, err := d.Outbox.ClaimDue(time.Now(), d.Lease, d.BatchSize)
+		if err != nil {
+			d.log().Error("outbox claim failed", "error", err)
+			return
+		}
+		if len(items) == 0 {
+			return
+		}
+		for _, it := range items {
+			if ctx.Err() != nil {
+				return
+			}
+			d.deliver(ctx, it)
+		}
+	}
+}
+
+func (d *LeadDispatcher) deliver(ctx context.Context, it OutboxItem) {
+	d.log().Info("lead delivery start", "outbox_id", it.ID, "chat_id", it.Lead.ChatID, "kind", it.Kind, "attempt", it.Attempts+1)
+	var err error
+	if it.Kind == OutboxUpdate {
+		err = d.Delivery.UpdateLead(ctx, it.Lead)
+	} else {
+		err = d.Delivery.SendLead(ctx, it.Lead)
+	}
+	if err == nil {
+		if err := d.Outbox.MarkDone(it.ID); err != nil {
+			d.log().Error("outbox mark done failed", "outbox_id", it.ID, "error", err)
+		}
+		d.log().Info("lead delivery success", "outbox_id", it.ID, "chat_id", it.Lead.ChatID)
+		return
+	}
+	if ctx.Err() != nil {
+		// остановка бота: запись вернётся в работу после истечения lease
+		return
+	}
+	attempts := it.Attempts + 1
+	dead := attempts >= d.MaxAttempts
+	next := time.Now().Add(d.backoff(attempts))
+	if err := d.Outbox.MarkFailed(it.ID, attempts, next, err.Error(), dead); err != nil {
+		d.log().Error("outbox mark failed failed", "outbox_id", it.ID, "error", err)
+	}
+	if dead {
+		d.log().Error("lead delivery dead", "outbox_id", it.ID, "chat_id", it.Lead.ChatID, "attempts", attempts, "error", err)
+		return
+	}
+	d.log().Warn("lead delivery failed", "outbox_id", it.ID, "chat_id", it.Lead.ChatID, "attempts", attempts, "next_attempt_at", next, "error", err)
+}
+
+// backoff — BaseDelay * 2^(attempts-1), но не больше MaxDelay
+func (d *LeadDispatcher) backoff(attempts int) time.Duration {
+	delay := d.BaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= d.MaxDelay {
+			return d.MaxDelay
+		}
+	}
+	return delay
+}
+
+// Stuck возвращает текст для админа и ID записей, которые можно отправить повторно
+func (d *LeadDispatcher) Stuck(n int) (string, []int64) {
+	items, err := d.Outbox.ListStuck(n)
+	if err != nil {
+		return "Не удалось получить очередь доставки", nil
+	}
+	if len(items) == 0 {
+		return "Все лиды доставлены в CRM", nil
+	}
+	var b strings.Builder
+	b.WriteString("Недоставленные лиды:\n")
+	ids := make([]int64, 0, len(items))
+	for _, it := range items {
+		state := fmt.Sprintf("попыток: %d, следующая: %s", it.Attempts, it.NextAttemptAt.Format("2006-01-02 15:04"))
+		if it.Status == OutboxDead {
+			state = fmt.Sprintf("попытки исчерпаны (%d)", it.Attempts)
+		}
+		if it.Kind == OutboxUpdate {
+			state = "обновление, " + state
+		}
+		fmt.Fprintf(&b, "#%d %s, %s — %s\n   ошибка: %s\n", it.ID, it.Lead.Phone, it.Lead.CreatedAt.Format("2006-01-02 15:04"), state, it.LastError)
+		ids = append(ids, it.ID)
+	}
+	return b.String(), ids
+}
+
+// RetryNow ставит запись на немедленную отправку и будит диспетчер
+func (d *LeadDispatcher) RetryNow(id int64) error {
+	if err := d.Outbox.RetryNow(id); err != nil {
+		return err
+	}
+	d.Notify()
+	return nil
+}
+
+func (d *LeadDispatcher) log() *slog.Logger {
+	if d.Logger != nil {
+		return d.Logger
+	}
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
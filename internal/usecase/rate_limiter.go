@@ -0,0 +1,72 @@
+package usecase
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter — token bucket: rate токенов в секунду, не больше burst подряд.
+// Один экземпляр делится между всеми рассылками, чтобы держать общий лимит Telegram.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if rate <= 0 {
+		rate = 1
+	}
+	if burst <= 0 {
+		burst = 1
+	}
+	return &RateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Wait блокируется до получения токена или отмены ctx
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		var wait time.Duration
+		if now.Before(l.last) {
+			// действует пауза после retry_after
+			wait = l.last.Sub(now)
+		} else {
+			l.tokens += now.Sub(l.last).Seconds() * l.rate
+			if l.tokens > l.burst {
+				l.tokens = l.burst
+			}
+			l.last = now
+			if l.tokens >= 1 {
+				l.tokens--
+				l.mu.Unlock()
+				return nil
+			}
+			wait = time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		}
+		l.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Pause останавливает выдачу токенов на d — так соблюдается retry_after из ответа 429
+func (l *RateLimiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	until := time.Now().Add(d)
+	if until.After(l.last) {
+		l.last = until
+	}
+	l.tokens = 0
+}
@@ -0,0 +1,328 @@
+package usecase
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Scenario — декларативное описание квиза: шаги, кнопки, переходы и финальные тексты.
+// Загружается из JSON-файла, чтобы менять формулировки без правок кода.
+type Scenario struct {
+	Start        State  `json:"start"`
+	Fallback     string `json:"fallback"`
+	DefaultRetry string `json:"default_retry"`
+	Steps        []Step `json:"steps"`
+	Offers       []Rule `json:"offers"`
+	DefaultOffer string `json:"default_offer"`
+	Catalogs     []Rule `json:"catalogs"`
+	// FollowUp — необязательные вопросы после номера телефона; nil — сразу благодарим
+	FollowUp *FollowUp `json:"follow_up"`
+}
+
+// FollowUp — вопросы об имени и удобном времени звонка. Оба можно пропустить:
+// лид к этому моменту уже сохранён, ответы только дополняют его.
+type FollowUp struct {
+	// Thanks отправляется сразу после номера, до вопросов
+	Thanks string `json:"thanks"`
+	// NamePrompt — вопрос об имени; NameConfirmPrompt — тот же вопрос, когда имя известно
+	// из профиля: {name} заменяется на него, а кнопка Confirm подтверждает
+	NamePrompt        string   `json:"name_prompt"`
+	NameConfirmPrompt string   `json:"name_confirm_prompt"`
+	Confirm           string   `json:"confirm"`
+	CallTimePrompt    string   `json:"call_time_prompt"`
+	CallTimeSlots     []string `json:"call_time_slots"`
+	Skip              string   `json:"skip"`
+	Done              string   `json:"done"`
+}
+
+// Step — один шаг сценария. Шаг без вариантов ответа считается конечным
+// (дальнейший ввод, например телефон, обрабатывает адаптер).
+type Step struct {
+	State     State    `json:"state"`
+	Prompt    string   `json:"prompt"`
+	Field     string   `json:"field"`
+	Options   []Option `json:"options"`
+	Retry     string   `json:"retry"`
+	Next      State    `json:"next"`
+	WithOffer bool     `json:"with_offer"`
+}
+
+// Option — кнопка ответа. Next переопределяет переход шага, Notice отправляется перед следующим вопросом.
+type Option struct {
+	Label  string `json:"label"`
+	Next   State  `json:"next"`
+	Notice string `json:"notice"`
+}
+
+// Rule сопоставляет ответы пользователя с текстом оффера или файлом каталога.
+// Правило срабатывает, если совпали все поля из When; побеждает первое совпавшее.
+type Rule struct {
+	When map[string]string `json:"when"`
+	Text string            `json:"text"`
+	File string            `json:"file"`
+}
+
+// LoadScenario читает сценарий из JSON-файла и валидирует его
+func LoadScenario(path string) (*Scenario, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var sc Scenario
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&sc); err != nil {
+		return nil, fmt.Errorf("scenario %s: %w", path, err)
+	}
+	if err := sc.Validate(); err != nil {
+		return nil, fmt.Errorf("scenario %s: %w", path, err)
+	}
+	return &sc, nil
+}
+
+// Validate проверяет целостность сценария: дубли шагов и кнопок, висячие переходы,
+// недостижимые шаги и ссылки правил на несуществующие ответы.
+func (sc *Scenario) Validate() error {
+	var errs []error
+	steps := make(map[State]*Step, len(sc.Steps))
+	for i := range sc.Steps {
+		st := &sc.Steps[i]
+		if st.State == "" {
+			errs = append(errs, fmt.Errorf("step #%d: empty state", i+1))
+			continue
+		}
+		if st.State == StateStart {
+			errs = append(errs, fmt.Errorf("step %q: state is reserved", st.State))
+		}
+		if _, dup := steps[st.State]; dup {
+			errs = append(errs, fmt.Errorf("step %q: duplicate state", st.State))
+			continue
+		}
+		steps[st.State] = st
+		if strings.TrimSpace(st.Prompt) == "" {
+			errs = append(errs, fmt.Errorf("step %q: empty prompt", st.State))
+		}
+		if st.Field != "" && !isSessionField(st.Field) {
+			errs = append(errs, fmt.Errorf("step %q: unknown field %q", st.State, st.Field))
+		}
+		labels := map[string]struct{}{}
+		for _, o := range st.Options {
+			if strings.TrimSpace(o.Label) == "" {
+				errs = append(errs, fmt.Errorf("step %q: empty option label", st.State))
+				continue
+			}
+			if _, dup := labels[o.Label]; dup {
+				errs = append(errs, fmt.Errorf("step %q: duplicate option %q", st.State, o.Label))
+			}
+			labels[o.Label] = struct{}{}
+		}
+	}
+
+	if sc.Start == "" {
+		errs = append(errs, errors.New("start state is not set"))
+	} else if _, ok := steps[sc.Start]; !ok {
+		errs = append(errs, fmt.Errorf("start state %q is not defined", sc.Start))
+	}
+	if _, ok := steps[StateRequestPhone]; !ok {
+		errs = append(errs, fmt.Errorf("step %q is required", StateRequestPhone))
+	}
+
+	for i := range sc.Steps {
+		st := &sc.Steps[i]
+		if steps[st.State] != st {
+			continue
+		}
+		for _, o := range st.Options {
+			next := o.next(st)
+			if next == "" {
+				errs = append(errs, fmt.Errorf("step %q: option %q has no transition", st.State, o.Label))
+				continue
+			}
+			if _, ok := steps[next]; !ok {
+				errs = append(errs, fmt.Errorf("step %q: option %q leads to undefined state %q", st.State, o.Label, next))
+			}
+		}
+		if len(st.Options) == 0 && st.Next != "" {
+			errs = append(errs, fmt.Errorf("step %q: next is set but step has no options", st.State))
+		}
+	}
+
+	// обход в ширину от стартового шага
+	if start, ok := steps[sc.Start]; ok {
+		reached := map[State]struct{}{start.State: {}}
+		queue := []*Step{start}
+		for len(queue) > 0 {
+			st := queue[0]
+			queue = queue[1:]
+			for _, o := range st.Options {
+				next, ok := steps[o.next(st)]
+				if !ok {
+					continue
+				}
+				if _, seen := reached[next.State]; seen {
+					continue
+				}
+				reached[next.State] = struct{}{}
+				queue = append(queue, next)
+			}
+		}
+		for _, st := range sc.Steps {
+			if _, ok := reached[st.State]; !ok && st.State != "" {
+				errs = append(errs, fmt.Errorf("step %q is unreachable from %q", st.State, sc.Start))
+			}
+		}
+	}
+
+	answers := map[string]map[string]struct{}{}
+	for _, st := range steps {
+		if st.Field == "" {
+			continue
+		}
+		if answers[st.Field] == nil {
+			answers[st.Field] = map[string]struct{}{}
+		}
+		for _, o := range st.Options {
+			answers[st.Field][o.Label] = struct{}{}
+		}
+	}
+	checkRules := func(kind string, rules []Rule, needFile bool) {
+		for i, r := range rules {
+			for field, value := range r.When {
+				known, ok := answers[field]
+				if !ok {
+					errs = append(errs, fmt.Errorf("%s #%d: field %q is not asked in any step", kind, i+1, field))
+					continue
+				}
+				if _, ok := known[value]; !ok {
+					errs = append(errs, fmt.Errorf("%s #%d: %q is not an option of field %q", kind, i+1, value, field))
+				}
+			}
+			if needFile && strings.TrimSpace(r.File) == "" {
+				errs = append(errs, fmt.Errorf("%s #%d: empty file", kind, i+1))
+			}
+			if !needFile && strings.TrimSpace(r.Text) == "" {
+				errs = append(errs, fmt.Errorf("%s #%d: empty text", kind, i+1))
+			}
+		}
+	}
+	checkRules("offer", sc.Offers, false)
+	checkRules("catalog", sc.Catalogs, true)
+	if sc.FollowUp != nil {
+		errs = append(errs, sc.FollowUp.validate()...)
+	}
+
+	return errors.Join(errs...)
+}
+
+// FieldOptions возвращает варианты ответов по полям сессии, например для фильтров рассылки
+func (sc *Scenario) FieldOptions() map[string][]string {
+	out := map[string][]string{}
+	for i := range sc.Steps {
+		st := &sc.Steps[i]
+		if st.Field == "" {
+			continue
+		}
+		for _, o := range st.Options {
+			if !contains(out[st.Field], o.Label) {
+				out[st.Field] = append(out[st.Field], o.Label)
+			}
+		}
+	}
+	return out
+}
+
+// FirstQuestion возвращает первый шаг с вопросом квиза (шаг с полем), до которого пользователь
+// доходит от старта по первым кнопкам; заход на него считается стартом квиза
+func (sc *Scenario) FirstQuestion() State {
+	steps := map[State]*Step{}
+	for i := range sc.Steps {
+		steps[sc.Steps[i].State] = &sc.Steps[i]
+	}
+	state := sc.Start
+	for range sc.Steps {
+		st, ok := steps[state]
+		if !ok || len(st.Options) == 0 {
+			break
+		}
+		if st.Field != "" {
+			return st.State
+		}
+		state = st.Options[0].next(st)
+	}
+	return StatePurpose
+}
+
+func (f *FollowUp) validate() []error {
+	var errs []error
+	for _, field := range []struct{ name, value string }{
+		{"thanks", f.Thanks},
+		{"name_prompt", f.NamePrompt},
+		{"call_time_prompt", f.CallTimePrompt},
+		{"skip", f.Skip},
+		{"done", f.Done},
+	} {
+		if strings.TrimSpace(field.value) == "" {
+			errs = append(errs, fmt.Errorf("follow_up: empty %s", field.name))
+		}
+	}
+	if f.NameConfirmPrompt != "" {
+		if !strings.Contains(f.NameConfirmPrompt, "{name}") {
+			errs = append(errs, errors.New("follow_up: name_confirm_prompt must contain {name}"))
+		}
+		if strings.TrimSpace(f.Confirm) == "" || f.Confirm == f.Skip {
+			errs = append(errs, errors.New("follow_up: confirm must be set and differ from skip"))
+		}
+	}
+	seen := map[string]struct{}{f.Skip: {}}
+	for _, slot := range f.CallTimeSlots {
+		if strings.TrimSpace(slot) == "" {
+			errs = append(errs, errors.New("follow_up: empty call time slot"))
+			continue
+		}
+		if _, dup := seen[slot]; dup {
+			errs = append(errs, fmt.Errorf("follow_up: duplicate call time slot %q", slot))
+		}
+		seen[slot] = struct{}{}
+	}
+	return errs
+}
+
+func (o Option) next(st *Step) State {
+	if o.Next != "" {
+		return o.Next
+	}
+	return st.Next
+}
+
+func (st *Step) option(text string) (Option, bool) {
+	for _, o := range st.Options {
+		if o.Label == text {
+			return o, true
+		}
+	}
+	return Option{}, false
+}
+
+func (st *Step) labels() []string {
+	if len(st.Options) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(st.Options))
+	for _, o := range st.Options {
+		out = append(out, o.Label)
+	}
+	return out
+}
+
+func (r Rule) matches(s *Session) bool {
+	for field, value := range r.When {
+		if s.Field(field) != value {
+			return false
+		}
+	}
+	return true
+}
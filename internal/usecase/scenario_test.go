@@ -0,0 +1,146 @@
+package usecase
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// validScenario — минимальный корректный сценарий; кейсы портят его по одному правилу
+func validScenario() *Scenario {
+	return &Scenario{
+		Start:    "intro",
+		Fallback: "Нажмите /start",
+		Steps: []Step{
+			{State: "intro", Prompt: "Привет", Options: []Option{{Label: "Хочу"}}, Next: "purpose"},
+			{State: "purpose", Prompt: "Цель?", Field: FieldPurpose, Options: []Option{{Label: "Жить"}, {Label: "Инвестиции"}}, Next: StateRequestPhone},
+			{State: StateRequestPhone, Prompt: "Оставьте номер"},
+		},
+		Offers:   []Rule{{When: map[string]string{FieldPurpose: "Жить"}, Text: "Оффер"}},
+		Catalogs: []Rule{{When: map[string]string{FieldPurpose: "Инвестиции"}, File: "invest.pdf"}},
+	}
+}
+
+func TestScenarioValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(sc *Scenario)
+		want   string // подстрока ошибки; пусто — сценарий корректен
+	}{
+		{"valid", func(sc *Scenario) {}, ""},
+		{"start not set", func(sc *Scenario) { sc.Start = "" }, "start state is not set"},
+		{"start undefined", func(sc *Scenario) { sc.Start = "nope" }, `start state "nope" is not defined`},
+		{"empty state", func(sc *Scenario) { sc.Steps[1].State = "" }, "step #2: empty state"},
+		{"reserved state", func(sc *Scenario) {
+			sc.Steps = append(sc.Steps, Step{State: StateStart, Prompt: "x"})
+		}, "state is reserved"},
+		{"duplicate state", func(sc *Scenario) {
+			sc.Steps = append(sc.Steps, Step{State: "purpose", Prompt: "Ещё раз"})
+		}, `step "purpose": duplicate state`},
+		{"empty prompt", func(sc *Scenario) { sc.Steps[0].Prompt = " " }, `step "intro": empty prompt`},
+		{"unknown field", func(sc *Scenario) { sc.Steps[1].Field = "budget" }, `unknown field "budget"`},
+		{"empty label", func(sc *Scenario) { sc.Steps[1].Options[1].Label = "" }, "empty option label"},
+		{"duplicate label", func(sc *Scenario) { sc.Steps[1].Options[1].Label = "Жить" }, `duplicate option "Жить"`},
+		{"no transition", func(sc *Scenario) { sc.Steps[0].Next = "" }, `option "Хочу" has no transition`},
+		{"dangling next", func(sc *Scenario) { sc.Steps[1].Next = "missing" }, `leads to undefined state "missing"`},
+		{"dangling option next", func(sc *Scenario) { sc.Steps[1].Options[0].Next = "missing" }, `option "Жить" leads to undefined state "missing"`},
+		{"next without options", func(sc *Scenario) { sc.Steps[2].Next = "intro" }, "next is set but step has no options"},
+		{"request phone missing", func(sc *Scenario) {
+			sc.Steps = sc.Steps[:2]
+			sc.Steps[1].Next = "intro"
+		}, `step "request_phone" is required`},
+		{"unreachable step", func(sc *Scenario) {
+			sc.Steps = append(sc.Steps, Step{State: "orphan", Prompt: "Никто не придёт", Options: []Option{{Label: "Ок"}}, Next: "intro"})
+		}, `step "orphan" is unreachable`},
+		{"rule unknown field", func(sc *Scenario) { sc.Offers[0].When = map[string]string{FieldPayment: "Ипотека"} }, "is not asked in any step"},
+		{"rule unknown value", func(sc *Scenario) { sc.Offers[0].When[FieldPurpose] = "Отдых" }, `"Отдых" is not an option`},
+		{"offer without text", func(sc *Scenario) { sc.Offers[0].Text = "" }, "offer #1: empty text"},
+		{"catalog without file", func(sc *Scenario) { sc.Catalogs[0].File = "" }, "catalog #1: empty file"},
+		{"follow-up without prompts", func(sc *Scenario) { sc.FollowUp = &FollowUp{} }, "follow_up: empty thanks"},
+		{"follow-up confirm without placeholder", func(sc *Scenario) {
+			sc.FollowUp = &FollowUp{Thanks: "Спасибо", NamePrompt: "Имя?", NameConfirmPrompt: "Вы Иван?", Confirm: "Да",
+				CallTimePrompt: "Когда?", Skip: "Пропустить", Done: "Готово"}
+		}, "must contain {name}"},
+		{"follow-up duplicate slot", func(sc *Scenario) {
+			sc.FollowUp = &FollowUp{Thanks: "Спасибо", NamePrompt: "Имя?", CallTimePrompt: "Когда?", Skip: "Пропустить", Done: "Готово",
+				CallTimeSlots: []string{"Утром", "Утром"}}
+		}, `duplicate call time slot "Утром"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := validScenario()
+			tt.modify(sc)
+			err := sc.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got error %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadScenarioRejectsUnknownField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenario.json")
+	data := `{"start": "intro", "steps": [], "greeting": "Привет"}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := LoadScenario(path)
+	if err == nil || !strings.Contains(err.Error(), `unknown field "greeting"`) {
+		t.Fatalf("got error %v, want unknown field", err)
+	}
+}
+
+func TestLoadScenarioRejectsBrokenJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenario.json")
+	if err := os.WriteFile(path, []byte(`{"start": "intro",`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadScenario(path); err == nil {
+		t.Fatal("broken JSON accepted")
+	}
+}
+
+// сценарий из репозитория, с которым бот стартует по умолчанию, должен проходить проверку
+func TestLoadDefaultScenario(t *testing.T) {
+	sc, err := LoadScenario("../../scenario.json")
+	if err != nil {
+		t.Fatalf("default scenario: %v", err)
+	}
+	if _, ok := NewDialog(sc).steps[sc.Start]; !ok {
+		t.Fatalf("start step %q is missing", sc.Start)
+	}
+	if sc.FieldOptions()[FieldPurpose] == nil {
+		t.Fatal("default scenario does not ask purpose")
+	}
+}
+
+func TestScenarioFirstQuestion(t *testing.T) {
+	sc := validScenario()
+	if got := sc.FirstQuestion(); got != "purpose" {
+		t.Errorf("first question = %q, want purpose", got)
+	}
+	// переход кнопки важнее перехода шага
+	sc.Steps = append(sc.Steps, Step{State: "budget_intro", Prompt: "Пара вопросов", Options: []Option{{Label: "Ок"}}, Next: "purpose"})
+	sc.Steps[0].Options[0].Next = "budget_intro"
+	if got := sc.FirstQuestion(); got != "purpose" {
+		t.Errorf("first question via option = %q, want purpose", got)
+	}
+	// сценарий сразу с вопроса
+	sc.Start = "purpose"
+	if got := sc.FirstQuestion(); got != "purpose" {
+		t.Errorf("first question from start = %q, want purpose", got)
+	}
+	// без вопросов до номера — шаг по умолчанию
+	sc = validScenario()
+	sc.Steps[1].Field = ""
+	if got := sc.FirstQuestion(); got != StatePurpose {
+		t.Errorf("first question without fields = %q, want %q", got, StatePurpose)
+	}
+}
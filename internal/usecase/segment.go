@@ -0,0 +1,279 @@
+package usecase
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type LeadFilter string
+
+const (
+	LeadAny LeadFilter = ""
+	LeadYes LeadFilter = "yes"
+	LeadNo  LeadFilter = "no"
+)
+
+// Segment — фильтр аудитории рассылки; пустые поля означают «любое значение»
+type Segment struct {
+	Purpose        string
+	Bedrooms       string
+	Payment        string
+	Reached        State
+	Lead           LeadFilter
+	RegisteredFrom time.Time
+	RegisteredTo   time.Time
+}
+
+// SegmentResolver возвращает chat_id пользователей, подходящих под сегмент
+type SegmentResolver interface {
+	Resolve(seg Segment) ([]int64, error)
+}
+
+func (seg Segment) IsEmpty() bool {
+	return seg.Purpose == "" && seg.Bedrooms == "" && seg.Payment == "" && seg.Reached == "" &&
+		seg.Lead == LeadAny && seg.RegisteredFrom.IsZero() && seg.RegisteredTo.IsZero()
+}
+
+// Describe — человекочитаемое описание фильтров для админа
+func (seg Segment) Describe() string {
+	if seg.IsEmpty() {
+		return "все пользователи"
+	}
+	var parts []string
+	if seg.Purpose != "" {
+		parts = append(parts, "цель: "+seg.Purpose)
+	}
+	if seg.Bedrooms != "" {
+		parts = append(parts, "спальни: "+seg.Bedrooms)
+	}
+	if seg.Payment != "" {
+		parts = append(parts, "оплата: "+seg.Payment)
+	}
+	if seg.Reached != "" {
+		parts = append(parts, "дошли до шага: "+stateLabel(seg.Reached))
+	}
+	switch seg.Lead {
+	case LeadYes:
+		parts = append(parts, "оставили номер")
+	case LeadNo:
+		parts = append(parts, "без номера")
+	}
+	if !seg.RegisteredFrom.IsZero() || !seg.RegisteredTo.IsZero() {
+		from, to := "…", "…"
+		if !seg.RegisteredFrom.IsZero() {
+			from = seg.RegisteredFrom.Format(segmentDateLayout)
+		}
+		if !seg.RegisteredTo.IsZero() {
+			to = seg.RegisteredTo.Add(-time.Nanosecond).Format(segmentDateLayout)
+		}
+		parts = append(parts, "регистрация: "+from+"–"+to)
+	}
+	return strings.Join(parts, "; ")
+}
+
+const (
+	BStateSegment      BroadcastState = "segment"
+	BStateSegmentValue BroadcastState = "segment_value"
+
+	segmentDateLayout = "02.01.2006"
+
+	segBtnPurpose    = "Цель"
+	segBtnBedrooms   = "Спальни"
+	segBtnPayment    = "Оплата"
+	segBtnReached    = "Шаг воронки"
+	segBtnLead       = "Лид"
+	segBtnRegistered = "Дата регистрации"
+	segBtnReset      = "Сбросить фильтры"
+	segBtnNext       = "Далее"
+
+	segAny       = "Любой вариант"
+	segLeadYes   = "Оставили номер"
+	segLeadNo    = "Без номера"
+	segLast7     = "Последние 7 дней"
+	segLast30    = "Последние 30 дней"
+	segAnyPeriod = "За всё время"
+)
+
+// funnelStates — шаги, по которым можно отфильтровать «дошли до шага»
+var funnelStates = []State{StateIntro, StatePurpose, StateBedrooms, StatePayment, StateRequestPhone}
+
+// SegmentMenu показывает текущие фильтры и число получателей
+func (u *BroadcastUsecase) SegmentMenu(s *BroadcastSession) (string, []string) {
+	s.State = BStateSegment
+	s.SegmentField = ""
+	n, err := u.countRecipients(s.Segment)
+	count := fmt.Sprint(n)
+	if err != nil {
+		count = "не удалось посчитать"
+	}
+	msg := fmt.Sprintf("Аудитория: %s\nПолучателей: %s\n\nНастройте фильтры или нажмите «%s».", s.Segment.Describe(), count, segBtnNext)
+	return msg, []string{segBtnPurpose, segBtnBedrooms, segBtnPayment, segBtnReached, segBtnLead, segBtnRegistered, segBtnReset, segBtnNext, "Отмена"}
+}
+
+// SegmentInput обрабатывает выбор в меню сегмента и ввод значения фильтра
+func (u *BroadcastUsecase) SegmentInput(s *BroadcastSession, text string) (string, []string) {
+	if text == "Отмена" {
+		s.Reset()
+		return "Рассылка отменена.", nil
+	}
+	if s.State == BStateSegmentValue {
+		if !u.applySegmentValue(s, text) {
+			return "Не понял значение. Выберите вариант из списка:", u.segmentValueOptions(s.SegmentField)
+		}
+		return u.SegmentMenu(s)
+	}
+	switch text {
+	case segBtnPurpose, segBtnBedrooms, segBtnPayment, segBtnReached, segBtnLead, segBtnRegistered:
+		s.State = BStateSegmentValue
+		s.SegmentField = text
+		msg := "Выберите значение фильтра «" + text + "»:"
+		if text == segBtnRegistered {
+			msg += "\nИли введите период в формате 01.09.2025-30.09.2025"
+		}
+		return msg, u.segmentValueOptions(text)
+	case segBtnReset:
+		s.Segment = Segment{}
+		return u.SegmentMenu(s)
+	case segBtnNext:
+		n, err := u.countRecipients(s.Segment)
+		if err != nil {
+			return "Не удалось получить список пользователей", nil
+		}
+		if n == 0 {
+			msg, opts := u.SegmentMenu(s)
+			return "Под фильтры не попал ни один пользователь.\n\n" + msg, opts
+		}
+		s.State = BStateConfirm
+		msg := fmt.Sprintf("Аудитория: %s\nПолучателей: %d\n\nПодтвердите отправку рассылки:", s.Segment.Describe(), n)
+		if len(s.Variants) > 0 {
+			msg = describeSplit(s) + "\n" + msg
+		}
+		return msg, u.ConfirmOptions(s)
+	}
+	return u.SegmentMenu(s)
+}
+
+func (u *BroadcastUsecase) segmentValueOptions(field string) []string {
+	var opts []string
+	switch field {
+	case segBtnPurpose:
+		opts = append(opts, u.AnswerOptions[FieldPurpose]...)
+	case segBtnBedrooms:
+		opts = append(opts, u.AnswerOptions[FieldBedrooms]...)
+	case segBtnPayment:
+		opts = append(opts, u.AnswerOptions[FieldPayment]...)
+	case segBtnReached:
+		for _, st := range funnelStates {
+			opts = append(opts, stateLabel(st))
+		}
+	case segBtnLead:
+		opts = append(opts, segLeadYes, segLeadNo)
+	case segBtnRegistered:
+		return []string{segLast7, segLast30, segAnyPeriod}
+	}
+	return append(opts, segAny)
+}
+
+func (u *BroadcastUsecase) applySegmentValue(s *BroadcastSession, text string) bool {
+	seg := &s.Segment
+	switch s.SegmentField {
+	case segBtnPurpose, segBtnBedrooms, segBtnPayment:
+		field := map[string]string{segBtnPurpose: FieldPurpose, segBtnBedrooms: FieldBedrooms, segBtnPayment: FieldPayment}[s.SegmentField]
+		value := ""
+		if text != segAny {
+			if !contains(u.AnswerOptions[field], text) {
+				return false
+			}
+			value = text
+		}
+		switch field {
+		case FieldPurpose:
+			seg.Purpose = value
+		case FieldBedrooms:
+			seg.Bedrooms = value
+		case FieldPayment:
+			seg.Payment = value
+		}
+		return true
+	case segBtnReached:
+		if text == segAny {
+			seg.Reached = ""
+			return true
+		}
+		for _, st := range funnelStates {
+			if stateLabel(st) == text {
+				seg.Reached = st
+				return true
+			}
+		}
+	case segBtnLead:
+		switch text {
+		case segLeadYes:
+			seg.Lead = LeadYes
+		case segLeadNo:
+			seg.Lead = LeadNo
+		case segAny:
+			seg.Lead = LeadAny
+		default:
+			return false
+		}
+		return true
+	case segBtnRegistered:
+		// границы дней — в часовом поясе рассылок, как и у расписания
+		loc := u.location()
+		now := time.Now().In(loc)
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+		switch text {
+		case segLast7:
+			seg.RegisteredFrom, seg.RegisteredTo = today.AddDate(0, 0, -6), time.Time{}
+		case segLast30:
+			seg.RegisteredFrom, seg.RegisteredTo = today.AddDate(0, 0, -29), time.Time{}
+		case segAnyPeriod, segAny:
+			seg.RegisteredFrom, seg.RegisteredTo = time.Time{}, time.Time{}
+		default:
+			from, to, ok := parseDateRangeIn(text, loc)
+			if !ok {
+				return false
+			}
+			seg.RegisteredFrom, seg.RegisteredTo = from, to
+		}
+		return true
+	}
+	return false
+}
+
+// parseDateRangeIn разбирает «01.09.2025-30.09.2025» в поясе loc; конец периода включительно
+func parseDateRangeIn(text string, loc *time.Location) (time.Time, time.Time, bool) {
+	parts := strings.Split(strings.ReplaceAll(text, " ", ""), "-")
+	if len(parts) != 2 {
+		return time.Time{}, time.Time{}, false
+	}
+	from, err1 := time.ParseInLocation(segmentDateLayout, parts[0], loc)
+	to, err2 := time.ParseInLocation(segmentDateLayout, parts[1], loc)
+	if err1 != nil || err2 != nil || to.Before(from) {
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to.AddDate(0, 0, 1), true
+}
+
+func (u *BroadcastUsecase) recipients(seg Segment) ([]int64, error) {
+	if u.Segments == nil {
+		return u.Repo.ListChatIDs()
+	}
+	return u.Segments.Resolve(seg)
+}
+
+func (u *BroadcastUsecase) countRecipients(seg Segment) (int, error) {
+	ids, err := u.recipients(seg)
+	return len(ids), err
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
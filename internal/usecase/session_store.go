@@ -0,0 +1,13 @@
+package usecase
+
+// SessionStore хранит состояние квиза пользователей и черновики рассылок админов,
+// чтобы они переживали перезапуск бота. Get-методы возвращают nil, если сессии нет
+// или она устарела (TTL задаётся реализацией).
+type SessionStore interface {
+	GetSession(chatID int64) (*Session, error)
+	SaveSession(chatID int64, s *Session) error
+	GetBroadcastSession(chatID int64) (*BroadcastSession, error)
+	SaveBroadcastSession(chatID int64, s *BroadcastSession) error
+	// PurgeExpired удаляет брошенные сессии старше TTL и возвращает их количество
+	PurgeExpired() (int, error)
+}
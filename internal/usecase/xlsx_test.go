@@ -0,0 +1,117 @@
+package usecase
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"testing"
+)
+
+func TestWriteXLSX(t *testing.T) {
+	table := [][]string{
+		{"ID", "Имя"},
+		{"1", "<b>Tom & \"Jerry\"</b>"},
+		{"2", "управляющий\x01символ\x00"},
+		{"3", "+79271234567"},
+	}
+	data, err := writeXLSX("Лиды & <итоги>", table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("open zip: %v", err)
+	}
+	parts := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		body, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("read %s: %v", f.Name, err)
+		}
+		parts[f.Name] = body
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml",
+		"xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml"} {
+		body, ok := parts[name]
+		if !ok {
+			t.Errorf("part %s is missing", name)
+			continue
+		}
+		// каждая часть — корректный XML
+		d := xml.NewDecoder(bytes.NewReader(body))
+		for {
+			if _, err := d.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Errorf("part %s: %v", name, err)
+				break
+			}
+		}
+	}
+
+	var wb struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.Unmarshal(parts["xl/workbook.xml"], &wb); err != nil {
+		t.Fatal(err)
+	}
+	if len(wb.Sheets) != 1 || wb.Sheets[0].Name != "Лиды & <итоги>" {
+		t.Errorf("sheets: %+v", wb.Sheets)
+	}
+
+	var sheet struct {
+		Rows []struct {
+			R     string `xml:"r,attr"`
+			Cells []struct {
+				R string `xml:"r,attr"`
+				T string `xml:"t,attr"`
+				S string `xml:"s,attr"`
+				V string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.Unmarshal(parts["xl/worksheets/sheet1.xml"], &sheet); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"ID", "Имя"},
+		{"1", "<b>Tom & \"Jerry\"</b>"},
+		{"2", "управляющий\uFFFDсимвол\uFFFD"},
+		{"3", "+79271234567"},
+	}
+	if len(sheet.Rows) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(sheet.Rows), len(want))
+	}
+	for i, row := range sheet.Rows {
+		if len(row.Cells) != len(want[i]) {
+			t.Fatalf("row %s: got %d cells, want %d", row.R, len(row.Cells), len(want[i]))
+		}
+		for j, c := range row.Cells {
+			if c.V != want[i][j] || c.T != "inlineStr" {
+				t.Errorf("cell %s: got %q (%s), want %q", c.R, c.V, c.T, want[i][j])
+			}
+			if (i == 0) != (c.S == "1") {
+				t.Errorf("cell %s: style %q", c.R, c.S)
+			}
+		}
+	}
+	if c := sheet.Rows[1].Cells[1]; c.R != "B2" {
+		t.Errorf("cell reference %q, want B2", c.R)
+	}
+}
+
+func TestXLSXColumn(t *testing.T) {
+	for n, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"} {
+		if got := xlsxColumn(n); got != want {
+			t.Errorf("xlsxColumn(%d) = %q, want %q", n, got, want)
+		}
+	}
+}